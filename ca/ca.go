@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/RedactableBlockChain/pki"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var caDir string
+var name string
+var dataPath string
+var hosts string
+var outDir string
+
+func init() {
+	flag.StringVar(&caDir, "dir", "./ca", "CA directory")
+	flag.StringVar(&name, "name", "", "init: CA name. issue: node name, the content of <data-path>/name")
+	flag.StringVar(&dataPath, "data", "", "issue: data path of the node, to read its name from")
+	flag.StringVar(&hosts, "hosts", "localhost,127.0.0.1", "issue: comma separated host names and IPs the node serves on")
+	flag.StringVar(&outDir, "out", "./storage/tls", "issue: directory for <name>.crt and <name>.key")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments] init|issue\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  init:  create a CA in -dir\n")
+		fmt.Fprintf(os.Stderr, "  issue: issue a node certificate from the CA in -dir\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+
+func main() {
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch flag.Arg(0) {
+	case "init":
+		if name == "" {
+			name = "RedactableBlockChain CA"
+		}
+		if err = pki.InitCA(caDir, name); err == nil {
+			fmt.Printf("CA created in %s, give %s to every node and client\n", caDir, filepath.Join(caDir, pki.CACert))
+		}
+	case "issue":
+		if name == "" && dataPath != "" {
+			var b []byte
+			if b, err = ioutil.ReadFile(filepath.Join(dataPath, "name")); err == nil {
+				name = strings.TrimSpace(string(b))
+			}
+		}
+		if err == nil && name == "" {
+			err = fmt.Errorf("need -name or -data")
+		}
+		if err == nil {
+			err = pki.Issue(caDir, name, strings.Split(hosts, ","), outDir)
+		}
+		if err == nil {
+			fmt.Printf("certificate for %s written to %s\n", name, outDir)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
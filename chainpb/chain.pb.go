@@ -0,0 +1,1118 @@
+// The gRPC API of a chain node. It mirrors the queries and submissions of
+// the v1 REST API and adds streams of new blocks and redactions.
+//
+// Regenerate the Go code with `go generate ./chainpb`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: chain.proto
+
+package chainpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TxReceipt_Status int32
+
+const (
+	TxReceipt_STATUS_UNSPECIFIED TxReceipt_Status = 0
+	// In the pool, waiting for a block.
+	TxReceipt_PENDING TxReceipt_Status = 1
+	// Replaced on the chain.
+	TxReceipt_MODIFIED TxReceipt_Status = 2
+)
+
+// Enum value maps for TxReceipt_Status.
+var (
+	TxReceipt_Status_name = map[int32]string{
+		0: "STATUS_UNSPECIFIED",
+		1: "PENDING",
+		2: "MODIFIED",
+	}
+	TxReceipt_Status_value = map[string]int32{
+		"STATUS_UNSPECIFIED": 0,
+		"PENDING":            1,
+		"MODIFIED":           2,
+	}
+)
+
+func (x TxReceipt_Status) Enum() *TxReceipt_Status {
+	p := new(TxReceipt_Status)
+	*p = x
+	return p
+}
+
+func (x TxReceipt_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TxReceipt_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_chain_proto_enumTypes[0].Descriptor()
+}
+
+func (TxReceipt_Status) Type() protoreflect.EnumType {
+	return &file_chain_proto_enumTypes[0]
+}
+
+func (x TxReceipt_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TxReceipt_Status.Descriptor instead.
+func (TxReceipt_Status) EnumDescriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{11, 0}
+}
+
+type Transaction struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Payload            []byte                 `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	Proof              []byte                 `protobuf:"bytes,2,opt,name=proof,proto3" json:"proof,omitempty"`
+	ChameleonPublicKey []byte                 `protobuf:"bytes,3,opt,name=chameleon_public_key,json=chameleonPublicKey,proto3" json:"chameleon_public_key,omitempty"`
+	CheckString        [][]byte               `protobuf:"bytes,4,rep,name=check_string,json=checkString,proto3" json:"check_string,omitempty"`
+	Hash               []byte                 `protobuf:"bytes,5,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Transaction) Reset() {
+	*x = Transaction{}
+	mi := &file_chain_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Transaction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transaction) ProtoMessage() {}
+
+func (x *Transaction) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transaction.ProtoReflect.Descriptor instead.
+func (*Transaction) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Transaction) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Transaction) GetProof() []byte {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+func (x *Transaction) GetChameleonPublicKey() []byte {
+	if x != nil {
+		return x.ChameleonPublicKey
+	}
+	return nil
+}
+
+func (x *Transaction) GetCheckString() [][]byte {
+	if x != nil {
+		return x.CheckString
+	}
+	return nil
+}
+
+func (x *Transaction) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+type BlockHead struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Height             int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Timestamp          int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	TxCount            int64                  `protobuf:"varint,3,opt,name=tx_count,json=txCount,proto3" json:"tx_count,omitempty"`
+	HashRoot           []byte                 `protobuf:"bytes,4,opt,name=hash_root,json=hashRoot,proto3" json:"hash_root,omitempty"`
+	PreviousRoot       []byte                 `protobuf:"bytes,5,opt,name=previous_root,json=previousRoot,proto3" json:"previous_root,omitempty"`
+	ChameleonParameter [][]byte               `protobuf:"bytes,6,rep,name=chameleon_parameter,json=chameleonParameter,proto3" json:"chameleon_parameter,omitempty"`
+	Sealer             string                 `protobuf:"bytes,7,opt,name=sealer,proto3" json:"sealer,omitempty"`
+	SealerKey          []byte                 `protobuf:"bytes,8,opt,name=sealer_key,json=sealerKey,proto3" json:"sealer_key,omitempty"`
+	Signature          []byte                 `protobuf:"bytes,9,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *BlockHead) Reset() {
+	*x = BlockHead{}
+	mi := &file_chain_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockHead) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockHead) ProtoMessage() {}
+
+func (x *BlockHead) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockHead.ProtoReflect.Descriptor instead.
+func (*BlockHead) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BlockHead) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *BlockHead) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *BlockHead) GetTxCount() int64 {
+	if x != nil {
+		return x.TxCount
+	}
+	return 0
+}
+
+func (x *BlockHead) GetHashRoot() []byte {
+	if x != nil {
+		return x.HashRoot
+	}
+	return nil
+}
+
+func (x *BlockHead) GetPreviousRoot() []byte {
+	if x != nil {
+		return x.PreviousRoot
+	}
+	return nil
+}
+
+func (x *BlockHead) GetChameleonParameter() [][]byte {
+	if x != nil {
+		return x.ChameleonParameter
+	}
+	return nil
+}
+
+func (x *BlockHead) GetSealer() string {
+	if x != nil {
+		return x.Sealer
+	}
+	return ""
+}
+
+func (x *BlockHead) GetSealerKey() []byte {
+	if x != nil {
+		return x.SealerKey
+	}
+	return nil
+}
+
+func (x *BlockHead) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+type Block struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Head          *BlockHead             `protobuf:"bytes,1,opt,name=head,proto3" json:"head,omitempty"`
+	Transactions  []*Transaction         `protobuf:"bytes,2,rep,name=transactions,proto3" json:"transactions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Block) Reset() {
+	*x = Block{}
+	mi := &file_chain_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Block) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Block) ProtoMessage() {}
+
+func (x *Block) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Block.ProtoReflect.Descriptor instead.
+func (*Block) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Block) GetHead() *BlockHead {
+	if x != nil {
+		return x.Head
+	}
+	return nil
+}
+
+func (x *Block) GetTransactions() []*Transaction {
+	if x != nil {
+		return x.Transactions
+	}
+	return nil
+}
+
+type GetHeightRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHeightRequest) Reset() {
+	*x = GetHeightRequest{}
+	mi := &file_chain_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHeightRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHeightRequest) ProtoMessage() {}
+
+func (x *GetHeightRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHeightRequest.ProtoReflect.Descriptor instead.
+func (*GetHeightRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{3}
+}
+
+type GetHeightResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Height        int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHeightResponse) Reset() {
+	*x = GetHeightResponse{}
+	mi := &file_chain_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHeightResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHeightResponse) ProtoMessage() {}
+
+func (x *GetHeightResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHeightResponse.ProtoReflect.Descriptor instead.
+func (*GetHeightResponse) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetHeightResponse) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type GetBlockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Height        int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBlockRequest) Reset() {
+	*x = GetBlockRequest{}
+	mi := &file_chain_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBlockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBlockRequest) ProtoMessage() {}
+
+func (x *GetBlockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBlockRequest.ProtoReflect.Descriptor instead.
+func (*GetBlockRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetBlockRequest) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+// The place of a transaction on the chain.
+type TxLocation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Height        int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	TxId          int64                  `protobuf:"varint,2,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxLocation) Reset() {
+	*x = TxLocation{}
+	mi := &file_chain_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxLocation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxLocation) ProtoMessage() {}
+
+func (x *TxLocation) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxLocation.ProtoReflect.Descriptor instead.
+func (*TxLocation) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TxLocation) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *TxLocation) GetTxId() int64 {
+	if x != nil {
+		return x.TxId
+	}
+	return 0
+}
+
+type GetTxRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Key:
+	//
+	//	*GetTxRequest_Location
+	//	*GetTxRequest_Hash
+	Key           isGetTxRequest_Key `protobuf_oneof:"key"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTxRequest) Reset() {
+	*x = GetTxRequest{}
+	mi := &file_chain_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTxRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTxRequest) ProtoMessage() {}
+
+func (x *GetTxRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTxRequest.ProtoReflect.Descriptor instead.
+func (*GetTxRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetTxRequest) GetKey() isGetTxRequest_Key {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *GetTxRequest) GetLocation() *TxLocation {
+	if x != nil {
+		if x, ok := x.Key.(*GetTxRequest_Location); ok {
+			return x.Location
+		}
+	}
+	return nil
+}
+
+func (x *GetTxRequest) GetHash() string {
+	if x != nil {
+		if x, ok := x.Key.(*GetTxRequest_Hash); ok {
+			return x.Hash
+		}
+	}
+	return ""
+}
+
+type isGetTxRequest_Key interface {
+	isGetTxRequest_Key()
+}
+
+type GetTxRequest_Location struct {
+	Location *TxLocation `protobuf:"bytes,1,opt,name=location,proto3,oneof"`
+}
+
+type GetTxRequest_Hash struct {
+	// Hex encoded hash.
+	Hash string `protobuf:"bytes,2,opt,name=hash,proto3,oneof"`
+}
+
+func (*GetTxRequest_Location) isGetTxRequest_Key() {}
+
+func (*GetTxRequest_Hash) isGetTxRequest_Key() {}
+
+type LocatedTx struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Height        int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	TxId          int64                  `protobuf:"varint,2,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	Transaction   *Transaction           `protobuf:"bytes,3,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LocatedTx) Reset() {
+	*x = LocatedTx{}
+	mi := &file_chain_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LocatedTx) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LocatedTx) ProtoMessage() {}
+
+func (x *LocatedTx) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LocatedTx.ProtoReflect.Descriptor instead.
+func (*LocatedTx) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *LocatedTx) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *LocatedTx) GetTxId() int64 {
+	if x != nil {
+		return x.TxId
+	}
+	return 0
+}
+
+func (x *LocatedTx) GetTransaction() *Transaction {
+	if x != nil {
+		return x.Transaction
+	}
+	return nil
+}
+
+type SubmitTxRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Transaction *Transaction           `protobuf:"bytes,1,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	// Only used by the priority pool ordering.
+	Priority      int32 `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitTxRequest) Reset() {
+	*x = SubmitTxRequest{}
+	mi := &file_chain_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitTxRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitTxRequest) ProtoMessage() {}
+
+func (x *SubmitTxRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitTxRequest.ProtoReflect.Descriptor instead.
+func (*SubmitTxRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SubmitTxRequest) GetTransaction() *Transaction {
+	if x != nil {
+		return x.Transaction
+	}
+	return nil
+}
+
+func (x *SubmitTxRequest) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+type ModifyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Height        int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	TxId          int64                  `protobuf:"varint,2,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	Transaction   *Transaction           `protobuf:"bytes,3,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ModifyRequest) Reset() {
+	*x = ModifyRequest{}
+	mi := &file_chain_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ModifyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModifyRequest) ProtoMessage() {}
+
+func (x *ModifyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModifyRequest.ProtoReflect.Descriptor instead.
+func (*ModifyRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ModifyRequest) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *ModifyRequest) GetTxId() int64 {
+	if x != nil {
+		return x.TxId
+	}
+	return 0
+}
+
+func (x *ModifyRequest) GetTransaction() *Transaction {
+	if x != nil {
+		return x.Transaction
+	}
+	return nil
+}
+
+type TxReceipt struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Hex encoded hash.
+	Hash   string           `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Status TxReceipt_Status `protobuf:"varint,2,opt,name=status,proto3,enum=redactable.chain.v1.TxReceipt_Status" json:"status,omitempty"`
+	// Set once the transaction is on the chain.
+	Location      *TxLocation `protobuf:"bytes,3,opt,name=location,proto3" json:"location,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxReceipt) Reset() {
+	*x = TxReceipt{}
+	mi := &file_chain_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxReceipt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxReceipt) ProtoMessage() {}
+
+func (x *TxReceipt) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxReceipt.ProtoReflect.Descriptor instead.
+func (*TxReceipt) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *TxReceipt) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *TxReceipt) GetStatus() TxReceipt_Status {
+	if x != nil {
+		return x.Status
+	}
+	return TxReceipt_STATUS_UNSPECIFIED
+}
+
+func (x *TxReceipt) GetLocation() *TxLocation {
+	if x != nil {
+		return x.Location
+	}
+	return nil
+}
+
+type SubscribeBlocksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The first block to send. Blocks up to the current height are sent
+	// from the store before new ones.
+	FromHeight    int64 `protobuf:"varint,1,opt,name=from_height,json=fromHeight,proto3" json:"from_height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeBlocksRequest) Reset() {
+	*x = SubscribeBlocksRequest{}
+	mi := &file_chain_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeBlocksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeBlocksRequest) ProtoMessage() {}
+
+func (x *SubscribeBlocksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeBlocksRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeBlocksRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SubscribeBlocksRequest) GetFromHeight() int64 {
+	if x != nil {
+		return x.FromHeight
+	}
+	return 0
+}
+
+type SubscribeRedactionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRedactionsRequest) Reset() {
+	*x = SubscribeRedactionsRequest{}
+	mi := &file_chain_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRedactionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRedactionsRequest) ProtoMessage() {}
+
+func (x *SubscribeRedactionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRedactionsRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRedactionsRequest) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{13}
+}
+
+type Redaction struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Height int64                  `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	TxId   int64                  `protobuf:"varint,2,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	// The transaction after the redaction.
+	Transaction   *Transaction `protobuf:"bytes,3,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Redaction) Reset() {
+	*x = Redaction{}
+	mi := &file_chain_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Redaction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Redaction) ProtoMessage() {}
+
+func (x *Redaction) ProtoReflect() protoreflect.Message {
+	mi := &file_chain_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Redaction.ProtoReflect.Descriptor instead.
+func (*Redaction) Descriptor() ([]byte, []int) {
+	return file_chain_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Redaction) GetHeight() int64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Redaction) GetTxId() int64 {
+	if x != nil {
+		return x.TxId
+	}
+	return 0
+}
+
+func (x *Redaction) GetTransaction() *Transaction {
+	if x != nil {
+		return x.Transaction
+	}
+	return nil
+}
+
+var File_chain_proto protoreflect.FileDescriptor
+
+const file_chain_proto_rawDesc = "" +
+	"\n" +
+	"\vchain.proto\x12\x13redactable.chain.v1\"\xa6\x01\n" +
+	"\vTransaction\x12\x18\n" +
+	"\apayload\x18\x01 \x01(\fR\apayload\x12\x14\n" +
+	"\x05proof\x18\x02 \x01(\fR\x05proof\x120\n" +
+	"\x14chameleon_public_key\x18\x03 \x01(\fR\x12chameleonPublicKey\x12!\n" +
+	"\fcheck_string\x18\x04 \x03(\fR\vcheckString\x12\x12\n" +
+	"\x04hash\x18\x05 \x01(\fR\x04hash\"\xa4\x02\n" +
+	"\tBlockHead\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x19\n" +
+	"\btx_count\x18\x03 \x01(\x03R\atxCount\x12\x1b\n" +
+	"\thash_root\x18\x04 \x01(\fR\bhashRoot\x12#\n" +
+	"\rprevious_root\x18\x05 \x01(\fR\fpreviousRoot\x12/\n" +
+	"\x13chameleon_parameter\x18\x06 \x03(\fR\x12chameleonParameter\x12\x16\n" +
+	"\x06sealer\x18\a \x01(\tR\x06sealer\x12\x1d\n" +
+	"\n" +
+	"sealer_key\x18\b \x01(\fR\tsealerKey\x12\x1c\n" +
+	"\tsignature\x18\t \x01(\fR\tsignature\"\x81\x01\n" +
+	"\x05Block\x122\n" +
+	"\x04head\x18\x01 \x01(\v2\x1e.redactable.chain.v1.BlockHeadR\x04head\x12D\n" +
+	"\ftransactions\x18\x02 \x03(\v2 .redactable.chain.v1.TransactionR\ftransactions\"\x12\n" +
+	"\x10GetHeightRequest\"+\n" +
+	"\x11GetHeightResponse\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\")\n" +
+	"\x0fGetBlockRequest\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\"9\n" +
+	"\n" +
+	"TxLocation\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\x12\x13\n" +
+	"\x05tx_id\x18\x02 \x01(\x03R\x04txId\"j\n" +
+	"\fGetTxRequest\x12=\n" +
+	"\blocation\x18\x01 \x01(\v2\x1f.redactable.chain.v1.TxLocationH\x00R\blocation\x12\x14\n" +
+	"\x04hash\x18\x02 \x01(\tH\x00R\x04hashB\x05\n" +
+	"\x03key\"|\n" +
+	"\tLocatedTx\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\x12\x13\n" +
+	"\x05tx_id\x18\x02 \x01(\x03R\x04txId\x12B\n" +
+	"\vtransaction\x18\x03 \x01(\v2 .redactable.chain.v1.TransactionR\vtransaction\"q\n" +
+	"\x0fSubmitTxRequest\x12B\n" +
+	"\vtransaction\x18\x01 \x01(\v2 .redactable.chain.v1.TransactionR\vtransaction\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\x05R\bpriority\"\x80\x01\n" +
+	"\rModifyRequest\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\x12\x13\n" +
+	"\x05tx_id\x18\x02 \x01(\x03R\x04txId\x12B\n" +
+	"\vtransaction\x18\x03 \x01(\v2 .redactable.chain.v1.TransactionR\vtransaction\"\xd8\x01\n" +
+	"\tTxReceipt\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\tR\x04hash\x12=\n" +
+	"\x06status\x18\x02 \x01(\x0e2%.redactable.chain.v1.TxReceipt.StatusR\x06status\x12;\n" +
+	"\blocation\x18\x03 \x01(\v2\x1f.redactable.chain.v1.TxLocationR\blocation\";\n" +
+	"\x06Status\x12\x16\n" +
+	"\x12STATUS_UNSPECIFIED\x10\x00\x12\v\n" +
+	"\aPENDING\x10\x01\x12\f\n" +
+	"\bMODIFIED\x10\x02\"9\n" +
+	"\x16SubscribeBlocksRequest\x12\x1f\n" +
+	"\vfrom_height\x18\x01 \x01(\x03R\n" +
+	"fromHeight\"\x1c\n" +
+	"\x1aSubscribeRedactionsRequest\"|\n" +
+	"\tRedaction\x12\x16\n" +
+	"\x06height\x18\x01 \x01(\x03R\x06height\x12\x13\n" +
+	"\x05tx_id\x18\x02 \x01(\x03R\x04txId\x12B\n" +
+	"\vtransaction\x18\x03 \x01(\v2 .redactable.chain.v1.TransactionR\vtransaction2\xe5\x04\n" +
+	"\x05Chain\x12Z\n" +
+	"\tGetHeight\x12%.redactable.chain.v1.GetHeightRequest\x1a&.redactable.chain.v1.GetHeightResponse\x12L\n" +
+	"\bGetBlock\x12$.redactable.chain.v1.GetBlockRequest\x1a\x1a.redactable.chain.v1.Block\x12J\n" +
+	"\x05GetTx\x12!.redactable.chain.v1.GetTxRequest\x1a\x1e.redactable.chain.v1.LocatedTx\x12P\n" +
+	"\bSubmitTx\x12$.redactable.chain.v1.SubmitTxRequest\x1a\x1e.redactable.chain.v1.TxReceipt\x12L\n" +
+	"\x06Modify\x12\".redactable.chain.v1.ModifyRequest\x1a\x1e.redactable.chain.v1.TxReceipt\x12\\\n" +
+	"\x0fSubscribeBlocks\x12+.redactable.chain.v1.SubscribeBlocksRequest\x1a\x1a.redactable.chain.v1.Block0\x01\x12h\n" +
+	"\x13SubscribeRedactions\x12/.redactable.chain.v1.SubscribeRedactionsRequest\x1a\x1e.redactable.chain.v1.Redaction0\x01B)Z'github.com/RedactableBlockChain/chainpbb\x06proto3"
+
+var (
+	file_chain_proto_rawDescOnce sync.Once
+	file_chain_proto_rawDescData []byte
+)
+
+func file_chain_proto_rawDescGZIP() []byte {
+	file_chain_proto_rawDescOnce.Do(func() {
+		file_chain_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_chain_proto_rawDesc), len(file_chain_proto_rawDesc)))
+	})
+	return file_chain_proto_rawDescData
+}
+
+var file_chain_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_chain_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_chain_proto_goTypes = []any{
+	(TxReceipt_Status)(0),              // 0: redactable.chain.v1.TxReceipt.Status
+	(*Transaction)(nil),                // 1: redactable.chain.v1.Transaction
+	(*BlockHead)(nil),                  // 2: redactable.chain.v1.BlockHead
+	(*Block)(nil),                      // 3: redactable.chain.v1.Block
+	(*GetHeightRequest)(nil),           // 4: redactable.chain.v1.GetHeightRequest
+	(*GetHeightResponse)(nil),          // 5: redactable.chain.v1.GetHeightResponse
+	(*GetBlockRequest)(nil),            // 6: redactable.chain.v1.GetBlockRequest
+	(*TxLocation)(nil),                 // 7: redactable.chain.v1.TxLocation
+	(*GetTxRequest)(nil),               // 8: redactable.chain.v1.GetTxRequest
+	(*LocatedTx)(nil),                  // 9: redactable.chain.v1.LocatedTx
+	(*SubmitTxRequest)(nil),            // 10: redactable.chain.v1.SubmitTxRequest
+	(*ModifyRequest)(nil),              // 11: redactable.chain.v1.ModifyRequest
+	(*TxReceipt)(nil),                  // 12: redactable.chain.v1.TxReceipt
+	(*SubscribeBlocksRequest)(nil),     // 13: redactable.chain.v1.SubscribeBlocksRequest
+	(*SubscribeRedactionsRequest)(nil), // 14: redactable.chain.v1.SubscribeRedactionsRequest
+	(*Redaction)(nil),                  // 15: redactable.chain.v1.Redaction
+}
+var file_chain_proto_depIdxs = []int32{
+	2,  // 0: redactable.chain.v1.Block.head:type_name -> redactable.chain.v1.BlockHead
+	1,  // 1: redactable.chain.v1.Block.transactions:type_name -> redactable.chain.v1.Transaction
+	7,  // 2: redactable.chain.v1.GetTxRequest.location:type_name -> redactable.chain.v1.TxLocation
+	1,  // 3: redactable.chain.v1.LocatedTx.transaction:type_name -> redactable.chain.v1.Transaction
+	1,  // 4: redactable.chain.v1.SubmitTxRequest.transaction:type_name -> redactable.chain.v1.Transaction
+	1,  // 5: redactable.chain.v1.ModifyRequest.transaction:type_name -> redactable.chain.v1.Transaction
+	0,  // 6: redactable.chain.v1.TxReceipt.status:type_name -> redactable.chain.v1.TxReceipt.Status
+	7,  // 7: redactable.chain.v1.TxReceipt.location:type_name -> redactable.chain.v1.TxLocation
+	1,  // 8: redactable.chain.v1.Redaction.transaction:type_name -> redactable.chain.v1.Transaction
+	4,  // 9: redactable.chain.v1.Chain.GetHeight:input_type -> redactable.chain.v1.GetHeightRequest
+	6,  // 10: redactable.chain.v1.Chain.GetBlock:input_type -> redactable.chain.v1.GetBlockRequest
+	8,  // 11: redactable.chain.v1.Chain.GetTx:input_type -> redactable.chain.v1.GetTxRequest
+	10, // 12: redactable.chain.v1.Chain.SubmitTx:input_type -> redactable.chain.v1.SubmitTxRequest
+	11, // 13: redactable.chain.v1.Chain.Modify:input_type -> redactable.chain.v1.ModifyRequest
+	13, // 14: redactable.chain.v1.Chain.SubscribeBlocks:input_type -> redactable.chain.v1.SubscribeBlocksRequest
+	14, // 15: redactable.chain.v1.Chain.SubscribeRedactions:input_type -> redactable.chain.v1.SubscribeRedactionsRequest
+	5,  // 16: redactable.chain.v1.Chain.GetHeight:output_type -> redactable.chain.v1.GetHeightResponse
+	3,  // 17: redactable.chain.v1.Chain.GetBlock:output_type -> redactable.chain.v1.Block
+	9,  // 18: redactable.chain.v1.Chain.GetTx:output_type -> redactable.chain.v1.LocatedTx
+	12, // 19: redactable.chain.v1.Chain.SubmitTx:output_type -> redactable.chain.v1.TxReceipt
+	12, // 20: redactable.chain.v1.Chain.Modify:output_type -> redactable.chain.v1.TxReceipt
+	3,  // 21: redactable.chain.v1.Chain.SubscribeBlocks:output_type -> redactable.chain.v1.Block
+	15, // 22: redactable.chain.v1.Chain.SubscribeRedactions:output_type -> redactable.chain.v1.Redaction
+	16, // [16:23] is the sub-list for method output_type
+	9,  // [9:16] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_chain_proto_init() }
+func file_chain_proto_init() {
+	if File_chain_proto != nil {
+		return
+	}
+	file_chain_proto_msgTypes[7].OneofWrappers = []any{
+		(*GetTxRequest_Location)(nil),
+		(*GetTxRequest_Hash)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_chain_proto_rawDesc), len(file_chain_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_chain_proto_goTypes,
+		DependencyIndexes: file_chain_proto_depIdxs,
+		EnumInfos:         file_chain_proto_enumTypes,
+		MessageInfos:      file_chain_proto_msgTypes,
+	}.Build()
+	File_chain_proto = out.File
+	file_chain_proto_goTypes = nil
+	file_chain_proto_depIdxs = nil
+}
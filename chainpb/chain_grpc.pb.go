@@ -0,0 +1,379 @@
+// The gRPC API of a chain node. It mirrors the queries and submissions of
+// the v1 REST API and adds streams of new blocks and redactions.
+//
+// Regenerate the Go code with `go generate ./chainpb`.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: chain.proto
+
+package chainpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Chain_GetHeight_FullMethodName           = "/redactable.chain.v1.Chain/GetHeight"
+	Chain_GetBlock_FullMethodName            = "/redactable.chain.v1.Chain/GetBlock"
+	Chain_GetTx_FullMethodName               = "/redactable.chain.v1.Chain/GetTx"
+	Chain_SubmitTx_FullMethodName            = "/redactable.chain.v1.Chain/SubmitTx"
+	Chain_Modify_FullMethodName              = "/redactable.chain.v1.Chain/Modify"
+	Chain_SubscribeBlocks_FullMethodName     = "/redactable.chain.v1.Chain/SubscribeBlocks"
+	Chain_SubscribeRedactions_FullMethodName = "/redactable.chain.v1.Chain/SubscribeRedactions"
+)
+
+// ChainClient is the client API for Chain service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChainClient interface {
+	// The height of the last block.
+	GetHeight(ctx context.Context, in *GetHeightRequest, opts ...grpc.CallOption) (*GetHeightResponse, error)
+	// A block by height.
+	GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*Block, error)
+	// A committed transaction by its place on the chain or by hash.
+	GetTx(ctx context.Context, in *GetTxRequest, opts ...grpc.CallOption) (*LocatedTx, error)
+	// Adds a transaction to the pool of the leader. Requires the submitter
+	// role.
+	SubmitTx(ctx context.Context, in *SubmitTxRequest, opts ...grpc.CallOption) (*TxReceipt, error)
+	// Replaces a committed transaction by one with the same chameleon hash.
+	// Requires the redactor role.
+	Modify(ctx context.Context, in *ModifyRequest, opts ...grpc.CallOption) (*TxReceipt, error)
+	// Sends the blocks from from_height on, then every new block.
+	SubscribeBlocks(ctx context.Context, in *SubscribeBlocksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Block], error)
+	// Sends every redaction applied after the call.
+	SubscribeRedactions(ctx context.Context, in *SubscribeRedactionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Redaction], error)
+}
+
+type chainClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChainClient(cc grpc.ClientConnInterface) ChainClient {
+	return &chainClient{cc}
+}
+
+func (c *chainClient) GetHeight(ctx context.Context, in *GetHeightRequest, opts ...grpc.CallOption) (*GetHeightResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetHeightResponse)
+	err := c.cc.Invoke(ctx, Chain_GetHeight_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainClient) GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*Block, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Block)
+	err := c.cc.Invoke(ctx, Chain_GetBlock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainClient) GetTx(ctx context.Context, in *GetTxRequest, opts ...grpc.CallOption) (*LocatedTx, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LocatedTx)
+	err := c.cc.Invoke(ctx, Chain_GetTx_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainClient) SubmitTx(ctx context.Context, in *SubmitTxRequest, opts ...grpc.CallOption) (*TxReceipt, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TxReceipt)
+	err := c.cc.Invoke(ctx, Chain_SubmitTx_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainClient) Modify(ctx context.Context, in *ModifyRequest, opts ...grpc.CallOption) (*TxReceipt, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TxReceipt)
+	err := c.cc.Invoke(ctx, Chain_Modify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainClient) SubscribeBlocks(ctx context.Context, in *SubscribeBlocksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Block], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Chain_ServiceDesc.Streams[0], Chain_SubscribeBlocks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeBlocksRequest, Block]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chain_SubscribeBlocksClient = grpc.ServerStreamingClient[Block]
+
+func (c *chainClient) SubscribeRedactions(ctx context.Context, in *SubscribeRedactionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Redaction], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Chain_ServiceDesc.Streams[1], Chain_SubscribeRedactions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRedactionsRequest, Redaction]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chain_SubscribeRedactionsClient = grpc.ServerStreamingClient[Redaction]
+
+// ChainServer is the server API for Chain service.
+// All implementations must embed UnimplementedChainServer
+// for forward compatibility.
+type ChainServer interface {
+	// The height of the last block.
+	GetHeight(context.Context, *GetHeightRequest) (*GetHeightResponse, error)
+	// A block by height.
+	GetBlock(context.Context, *GetBlockRequest) (*Block, error)
+	// A committed transaction by its place on the chain or by hash.
+	GetTx(context.Context, *GetTxRequest) (*LocatedTx, error)
+	// Adds a transaction to the pool of the leader. Requires the submitter
+	// role.
+	SubmitTx(context.Context, *SubmitTxRequest) (*TxReceipt, error)
+	// Replaces a committed transaction by one with the same chameleon hash.
+	// Requires the redactor role.
+	Modify(context.Context, *ModifyRequest) (*TxReceipt, error)
+	// Sends the blocks from from_height on, then every new block.
+	SubscribeBlocks(*SubscribeBlocksRequest, grpc.ServerStreamingServer[Block]) error
+	// Sends every redaction applied after the call.
+	SubscribeRedactions(*SubscribeRedactionsRequest, grpc.ServerStreamingServer[Redaction]) error
+	mustEmbedUnimplementedChainServer()
+}
+
+// UnimplementedChainServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChainServer struct{}
+
+func (UnimplementedChainServer) GetHeight(context.Context, *GetHeightRequest) (*GetHeightResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHeight not implemented")
+}
+func (UnimplementedChainServer) GetBlock(context.Context, *GetBlockRequest) (*Block, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
+}
+func (UnimplementedChainServer) GetTx(context.Context, *GetTxRequest) (*LocatedTx, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTx not implemented")
+}
+func (UnimplementedChainServer) SubmitTx(context.Context, *SubmitTxRequest) (*TxReceipt, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTx not implemented")
+}
+func (UnimplementedChainServer) Modify(context.Context, *ModifyRequest) (*TxReceipt, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Modify not implemented")
+}
+func (UnimplementedChainServer) SubscribeBlocks(*SubscribeBlocksRequest, grpc.ServerStreamingServer[Block]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeBlocks not implemented")
+}
+func (UnimplementedChainServer) SubscribeRedactions(*SubscribeRedactionsRequest, grpc.ServerStreamingServer[Redaction]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeRedactions not implemented")
+}
+func (UnimplementedChainServer) mustEmbedUnimplementedChainServer() {}
+func (UnimplementedChainServer) testEmbeddedByValue()               {}
+
+// UnsafeChainServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChainServer will
+// result in compilation errors.
+type UnsafeChainServer interface {
+	mustEmbedUnimplementedChainServer()
+}
+
+func RegisterChainServer(s grpc.ServiceRegistrar, srv ChainServer) {
+	// If the following call pancis, it indicates UnimplementedChainServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Chain_ServiceDesc, srv)
+}
+
+func _Chain_GetHeight_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHeightRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainServer).GetHeight(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chain_GetHeight_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainServer).GetHeight(ctx, req.(*GetHeightRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chain_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainServer).GetBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chain_GetBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainServer).GetBlock(ctx, req.(*GetBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chain_GetTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainServer).GetTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chain_GetTx_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainServer).GetTx(ctx, req.(*GetTxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chain_SubmitTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitTxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainServer).SubmitTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chain_SubmitTx_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainServer).SubmitTx(ctx, req.(*SubmitTxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chain_Modify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainServer).Modify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Chain_Modify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainServer).Modify(ctx, req.(*ModifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Chain_SubscribeBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeBlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChainServer).SubscribeBlocks(m, &grpc.GenericServerStream[SubscribeBlocksRequest, Block]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chain_SubscribeBlocksServer = grpc.ServerStreamingServer[Block]
+
+func _Chain_SubscribeRedactions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRedactionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChainServer).SubscribeRedactions(m, &grpc.GenericServerStream[SubscribeRedactionsRequest, Redaction]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Chain_SubscribeRedactionsServer = grpc.ServerStreamingServer[Redaction]
+
+// Chain_ServiceDesc is the grpc.ServiceDesc for Chain service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Chain_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "redactable.chain.v1.Chain",
+	HandlerType: (*ChainServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetHeight",
+			Handler:    _Chain_GetHeight_Handler,
+		},
+		{
+			MethodName: "GetBlock",
+			Handler:    _Chain_GetBlock_Handler,
+		},
+		{
+			MethodName: "GetTx",
+			Handler:    _Chain_GetTx_Handler,
+		},
+		{
+			MethodName: "SubmitTx",
+			Handler:    _Chain_SubmitTx_Handler,
+		},
+		{
+			MethodName: "Modify",
+			Handler:    _Chain_Modify_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeBlocks",
+			Handler:       _Chain_SubscribeBlocks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeRedactions",
+			Handler:       _Chain_SubscribeRedactions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "chain.proto",
+}
@@ -0,0 +1,6 @@
+// Package chainpb holds the messages and the service of the gRPC API,
+// generated from chain.proto. The server is raft.Server, the Go client
+// raft.GRPCClient.
+package chainpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative chain.proto
@@ -1,26 +1,43 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	ch "github.com/RedactableBlockChain/chameleon"
 	"github.com/RedactableBlockChain/data"
-	"github.com/RedactableBlockChain/path"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/pki"
 	raftc "github.com/RedactableBlockChain/raft"
+	"github.com/RedactableBlockChain/store"
+	"io"
+	"os"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 )
 
 var host string
 var function int
 var configPath string
-var txPoolPath string
-var blockPath string
+var consistency string
+var tlsCA string
+var tlsCert string
+var tlsKey string
+var token string
+var output string
+var limit int
 
 func init() {
 	flag.StringVar(&host, "h", "http://localhost:6666", "Restful url. default: http://localhost:6666")
 	flag.StringVar(&configPath, "config", "./storage/config", "Config file path")
-	flag.StringVar(&txPoolPath, "pool", "./storage/pool/", "Transaction pool dir")
-	flag.StringVar(&blockPath, "block", "./storage/block/", "Block storage dir")
+	flag.StringVar(&consistency, "consistency", "", "Read consistency: local, leader or linearizable. default: server default")
+	flag.StringVar(&tlsCA, "ca", "", "CA certificate of the cluster, for https urls")
+	flag.StringVar(&tlsCert, "cert", "", "client certificate, when the cluster asks for one")
+	flag.StringVar(&tlsKey, "key", "", "key of -cert")
+	flag.StringVar(&token, "token", "", "API token, when the cluster requires one")
+	flag.StringVar(&output, "o", "table", "Output of list functions: table or json")
+	flag.IntVar(&limit, "limit", 0, "Page size of list functions. default: server default")
 	flag.IntVar(&function, "func", 0,
 		"Choose one function below:\n"+
 			"0: get current height (args: nil)\n"+
@@ -32,21 +49,75 @@ func init() {
 			"6: generate chameleon key pair (args: flag)\n"+
 			"  -- flag is 0 : default key pair\n"+
 			"  -- else : new random key pair\n"+
-			"7: get current leader of raft (args: nil)")
+			"7: get current leader of raft (args: nil)\n"+
+			"8: list transactions of a public key (args: hk,[fromTime],[toTime])\n"+
+			"  -- times are unix seconds, 0 means unbounded\n"+
+			"9: search transaction payloads (args: query)\n"+
+			"10: get block policy (args: nil)\n"+
+			"11: set block policy (args: maxTxs,maxBytes,interval,maxWait,heartbeat)\n"+
+			"  -- durations are ms, 0 disables the rule\n"+
+			"12: get cluster status (args: nil)\n"+
+			"13: remove a node from the cluster (args: name)\n"+
+			"14: make the node at -h leave the cluster (args: nil)\n"+
+			"15: export a block with its finality certificate (args: height,blockFile,keysFile)\n"+
+			"  -- keysFile receives the node keys partners verify against\n"+
+			"16: verify an exported block offline (args: blockFile,keysFile)\n"+
+			"17: list API principals (args: nil)\n"+
+			"18: set the roles of an API principal (args: name,roles,[rotate])\n"+
+			"  -- roles are comma separated: reader, submitter, redactor, block-producer, admin\n"+
+			"  -- new principals and rotate=1 print a new token\n"+
+			"19: revoke an API principal (args: name)\n"+
+			"20: follow chain events as JSON lines (args: [types],[hk],[cursor])\n"+
+			"  -- types are comma separated: block, tx, redaction; empty for all\n"+
+			"  -- cursor resumes after an event printed before, 0 starts now\n"+
+			"21: list webhooks (args: nil)\n"+
+			"22: set a webhook (args: name,url,events,[rotate])\n"+
+			"  -- events are comma separated: redaction.proposed, tx.modified, redaction.rejected\n"+
+			"  -- new webhooks and rotate=1 print a new signing secret\n"+
+			"23: remove a webhook and its pending deliveries (args: name)\n"+
+			"24: list webhook deliveries (args: outbox|dead,[cursor])\n"+
+			"25: retry a dead letter (args: key)\n"+
+			"26: list block heads by height (args: [from],[to],[cursor])\n"+
+			"  -- to defaults to the current height\n"+
+			"27: list transactions of the chain (args: [fromTime],[toTime],[cursor])\n"+
+			"  -- times are unix seconds, 0 means unbounded\n"+
+			"28: list pooled transactions (args: [cursor])\n"+
+			"  -- list functions print one page of -limit entries and the cursor of the next\n"+
+			"29: get mempool config (args: nil)\n"+
+			"30: set mempool config (args: maxTxs,maxBytes,ttl,ordering)\n"+
+			"  -- ttl is seconds, 0 disables the limit, ordering is fifo or priority")
 
 	flag.Parse()
 }
 
 func main() {
+	if consistency != "" {
+		if err := raftc.ValidReadConsistency(consistency); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
-	path.SetBlockDirPath(blockPath)
-	path.SetConfigPath(configPath)
-	path.SetTxPoolPath(txPoolPath)
+	if tlsCA != "" {
+		config, err := pki.ClientConfig(tlsCA, tlsCert, tlsKey)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		pki.UseForDefaultClient(config)
+	}
+	if token != "" {
+		raftc.UseToken(token)
+	}
+	if output != "table" && output != "json" {
+		fmt.Println("unknown output: " + output)
+		return
+	}
 
 	switch function {
 	case 0:
 		{
-			height, err := raftc.GetCurrentHeight(host)
+			height, err := raftc.GetCurrentHeight(host, consistency)
 			if err != nil {
 				fmt.Println(err)
 				return
@@ -65,13 +136,22 @@ func main() {
 				fmt.Println(err)
 				return
 			}
-			block, err := raftc.GetBlockByHeight(host, height)
+			block, err := raftc.GetBlockByHeight(host, height, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 			//err = data.Write(&block, path.GetBlockPath(height))
 			//if err != nil {
 			//	fmt.Println(err)
 			//}
 			fmt.Printf("Height: %d\nTimestamp: %d\nTransactions amount: %d\nHash root: %x\nPrevious root: %x\n",
 				block.HeadB.Height, block.HeadB.Timestamp, block.HeadB.TxCount, block.HeadB.HashRoot, block.HeadB.PreviousRoot)
+			if err = raftc.VerifyBlock(host, block); err != nil {
+				fmt.Printf("Seal: invalid (%v)\n", err)
+			} else if block.HeadB.Height > 0 {
+				fmt.Printf("Seal: valid, sealed by %s\n", block.HeadB.Sealer)
+			}
 		}
 	case 2:
 		{
@@ -90,7 +170,7 @@ func main() {
 				fmt.Println(err)
 				return
 			}
-			tx, err := raftc.GetTxByIndex(host, height, txId)
+			tx, err := raftc.GetTxByIndex(host, height, txId, consistency)
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -110,17 +190,12 @@ func main() {
 				fmt.Println(err)
 				return
 			}
-			height, txId, tx, err := raftc.GetTxByHash(host, hash, start)
+			height, txId, tx, err := raftc.GetTxByHash(host, hash, start, consistency)
 			fmt.Printf("height: %d, txId: %d\n", height, txId)
 			fmt.Printf("Payload: %s\nProof: %s\nHk: %s", tx.Payload(), tx.Proof(), tx.ChameleonPk())
 		}
 	case 4:
 		{
-			leader, err := raftc.GetCurrentLeader(host)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
 			args := flag.Args()
 			if len(args) != 3 {
 				fmt.Printf("need %d args but get %d", 3, len(args))
@@ -129,20 +204,20 @@ func main() {
 			payload := []byte(args[0])
 			proof := []byte(args[1])
 			hk := []byte(args[2])
-			res, err := raftc.SendNewTxReq(leader, payload, proof, hk)
+			para, err := LocalChameleonParameter()
 			if err != nil {
 				fmt.Println(err)
 				return
 			}
-			fmt.Println(string(res))
-		}
-	case 5:
-		{
-			leader, err := raftc.GetCurrentLeader(host)
+			res, err := raftc.SendNewTxReq(host, para, payload, proof, hk)
 			if err != nil {
 				fmt.Println(err)
 				return
 			}
+			fmt.Println(string(res))
+		}
+	case 5:
+		{
 			args := flag.Args()
 			if len(args) != 5 {
 				fmt.Printf("need %d args but get %d", 5, len(args))
@@ -161,7 +236,12 @@ func main() {
 			payload := []byte(args[2])
 			proof := []byte(args[3])
 			tk := []byte(args[4])
-			res, err := raftc.SendModifyReq(leader, payload, proof, tk, height, txId)
+			para, err := LocalChameleonParameter()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			res, err := raftc.SendModifyReq(host, para, payload, proof, tk, height, txId)
 			if err != nil {
 				fmt.Println(err)
 				return
@@ -175,8 +255,7 @@ func main() {
 				fmt.Printf("need %d args but get %d", 1, len(args))
 				return
 			}
-			para := &data.GolbalParameter{}
-			err := data.Load(&para, path.GetConfigPath())
+			para, err := store.LoadParameter(configPath)
 			if err != nil {
 				fmt.Println(err)
 				return
@@ -191,13 +270,534 @@ func main() {
 		}
 	case 7:
 		{
-			leader, err := raftc.GetCurrentLeader(host)
+			leader, err := raftc.GetCurrentLeader(host, consistency)
 			if err != nil {
 				fmt.Println(err)
 				return
 			}
 			fmt.Println(leader)
 		}
+	case 8:
+		{
+			args := flag.Args()
+			if len(args) < 1 || len(args) > 3 {
+				fmt.Printf("need %d to %d args but get %d", 1, 3, len(args))
+				return
+			}
+			times := []int{0, 0}
+			for i := 1; i < len(args); i++ {
+				t, err := strconv.Atoi(args[i])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				times[i-1] = t
+			}
+			cursor := ""
+			for {
+				page, err := raftc.GetTxsByPk(host, args[0], times[0], times[1], cursor, 0, consistency)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				for _, e := range page.Transactions {
+					fmt.Printf("height: %d, txId: %d, timestamp: %d\nPayload: %s\nProof: %s\nHash: %x\n",
+						e.Height, e.TxId, e.Timestamp, e.Transaction.Payload(), e.Transaction.Proof(), e.Transaction.HashVal())
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+		}
+	case 9:
+		{
+			args := flag.Args()
+			if len(args) != 1 {
+				fmt.Printf("need %d args but get %d", 1, len(args))
+				return
+			}
+			cursor := ""
+			for {
+				page, err := raftc.Search(host, args[0], cursor, 0, consistency)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				for _, e := range page.Transactions {
+					fmt.Printf("height: %d, txId: %d\nPayload: %s\nHash: %x\n",
+						e.Height, e.TxId, e.Transaction.Payload(), e.Transaction.HashVal())
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+		}
+	case 10:
+		{
+			p, err := raftc.GetPolicy(host, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Max transactions: %d\nMax bytes: %d\nInterval: %d ms\nMax wait: %d ms\nHeartbeat: %d ms\n",
+				p.MaxTxs, p.MaxBytes, p.Interval, p.MaxWait, p.Heartbeat)
+		}
+	case 11:
+		{
+			args := flag.Args()
+			if len(args) != 5 {
+				fmt.Printf("need %d args but get %d", 5, len(args))
+				return
+			}
+			values := make([]int, len(args))
+			for i := range args {
+				v, err := strconv.Atoi(args[i])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				values[i] = v
+			}
+			res, err := raftc.SetPolicy(host, raftc.BlockPolicy{
+				MaxTxs:    values[0],
+				MaxBytes:  values[1],
+				Interval:  values[2],
+				MaxWait:   values[3],
+				Heartbeat: values[4],
+			})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	case 12:
+		{
+			cluster, err := raftc.GetCluster(host, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Leader: %s\n", cluster.Leader)
+			for _, n := range cluster.Nodes {
+				if n.Error != "" {
+					fmt.Printf("%s %s unreachable: %s\n", n.Name, n.ConnectionString, n.Error)
+					continue
+				}
+				fmt.Printf("%s %s state: %s, term: %d, commit index: %d, height: %d\n",
+					n.Name, n.ConnectionString, n.State, n.Term, n.CommitIndex, n.Height)
+			}
+		}
+	case 13:
+		{
+			args := flag.Args()
+			if len(args) != 1 {
+				fmt.Printf("need %d args but get %d", 1, len(args))
+				return
+			}
+			res, err := raftc.RemoveNode(host, args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	case 14:
+		{
+			res, err := raftc.Leave(host)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	case 15:
+		{
+			args := flag.Args()
+			if len(args) != 3 {
+				fmt.Printf("need %d args but get %d", 3, len(args))
+				return
+			}
+			height, err := strconv.Atoi(args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			cb, err := raftc.GetCertifiedBlock(host, height, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			keys, err := raftc.GetKeys(host, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if err = raftc.VerifyCertifiedBlock(cb, keys); err != nil {
+				fmt.Println(err)
+				return
+			}
+			if err = data.Write(cb, args[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			if err = data.Write(keys, args[2]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Block %d exported with %d votes", height, len(cb.Certificate.Votes))
+		}
+	case 16:
+		{
+			args := flag.Args()
+			if len(args) != 2 {
+				fmt.Printf("need %d args but get %d", 2, len(args))
+				return
+			}
+			cb, err := raftc.VerifyCertifiedBlockFile(args[0], args[1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Block %d is valid, sealed by %s and certified by %d nodes",
+				cb.Block.HeadB.Height, cb.Block.HeadB.Sealer, len(cb.Certificate.Votes))
+		}
+	case 17:
+		{
+			list, err := raftc.GetPrincipals(host, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			for _, p := range list {
+				fmt.Printf("%s %v\n", p.Name, p.Roles)
+			}
+		}
+	case 18:
+		{
+			args := flag.Args()
+			if len(args) != 2 && len(args) != 3 {
+				fmt.Printf("need %d args but get %d", 2, len(args))
+				return
+			}
+			var roles []raftc.Role
+			for _, r := range strings.Split(args[1], ",") {
+				roles = append(roles, raftc.Role(strings.TrimSpace(r)))
+			}
+			c, err := raftc.SetPrincipal(host, args[0], roles, len(args) == 3 && args[2] == "1")
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("%s %v\n", c.Name, c.Roles)
+			if c.Token != "" {
+				fmt.Printf("Token: %s\n", c.Token)
+			}
+		}
+	case 19:
+		{
+			args := flag.Args()
+			if len(args) != 1 {
+				fmt.Printf("need %d args but get %d", 1, len(args))
+				return
+			}
+			res, err := raftc.RevokePrincipal(host, args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	case 20:
+		{
+			args := flag.Args()
+			if len(args) > 3 {
+				fmt.Printf("need at most %d args but get %d", 3, len(args))
+				return
+			}
+			filter := raftc.EventFilter{}
+			if len(args) > 0 && args[0] != "" {
+				filter.Types = strings.Split(args[0], ",")
+			}
+			if len(args) > 1 {
+				filter.Pk = args[1]
+			}
+			var cursor uint64
+			if len(args) > 2 {
+				var err error
+				if cursor, err = strconv.ParseUint(args[2], 10, 64); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			err := raftc.SubscribeEvents(host, filter, cursor, func(e raftc.Event) error {
+				b, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(b))
+				return nil
+			})
+			fmt.Println(err)
+		}
+	case 21:
+		{
+			list, err := raftc.GetWebhooks(host, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			for _, h := range list {
+				fmt.Printf("%s %s %v\n", h.Name, h.URL, h.Events)
+			}
+		}
+	case 22:
+		{
+			args := flag.Args()
+			if len(args) != 3 && len(args) != 4 {
+				fmt.Printf("need %d args but get %d", 3, len(args))
+				return
+			}
+			var events []string
+			for _, e := range strings.Split(args[2], ",") {
+				events = append(events, strings.TrimSpace(e))
+			}
+			h, err := raftc.SetWebhook(host, args[0], args[1], events, len(args) == 4 && args[3] == "1")
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("%s %s %v\n", h.Name, h.URL, h.Events)
+			if h.Secret != "" {
+				fmt.Printf("Secret: %s\n", h.Secret)
+			}
+		}
+	case 23:
+		{
+			args := flag.Args()
+			if len(args) != 1 {
+				fmt.Printf("need %d args but get %d", 1, len(args))
+				return
+			}
+			res, err := raftc.RemoveWebhook(host, args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	case 24:
+		{
+			args := flag.Args()
+			if len(args) != 1 && len(args) != 2 {
+				fmt.Printf("need %d args but get %d", 1, len(args))
+				return
+			}
+			cursor := ""
+			if len(args) == 2 {
+				cursor = args[1]
+			}
+			var page *raftc.DeliveryPage
+			var err error
+			switch args[0] {
+			case "outbox":
+				page, err = raftc.GetOutbox(host, cursor, 0, consistency)
+			case "dead":
+				page, err = raftc.GetDeadLetters(host, cursor, 0, consistency)
+			default:
+				err = fmt.Errorf("unknown delivery list: %s", args[0])
+			}
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			for _, d := range page.Deliveries {
+				fmt.Printf("%s %s %s", d.Key, d.Webhook, d.Notification.Event)
+				if d.Attempts > 0 {
+					fmt.Printf(" attempts=%d error=%q", d.Attempts, d.LastError)
+				}
+				fmt.Println()
+			}
+			if page.NextCursor != "" {
+				fmt.Printf("Next cursor: %s\n", page.NextCursor)
+			}
+		}
+	case 25:
+		{
+			args := flag.Args()
+			if len(args) != 1 {
+				fmt.Printf("need %d args but get %d", 1, len(args))
+				return
+			}
+			res, err := raftc.RetryDeadLetter(host, args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	case 26:
+		{
+			args := flag.Args()
+			if len(args) > 3 {
+				fmt.Printf("need at most %d args but get %d", 3, len(args))
+				return
+			}
+			bounds, cursor, err := listArgs(args)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			page, err := raftc.GetBlocks(host, bounds[0], bounds[1], cursor, limit, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			printPage(page, page.NextCursor, func(w io.Writer) {
+				fmt.Fprintln(w, "HEIGHT\tTIMESTAMP\tTXS\tSEALER\tHASH ROOT")
+				for _, h := range page.Blocks {
+					fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%x\n", h.Height, h.Timestamp, h.TxCount, h.Sealer, h.HashRoot)
+				}
+			})
+		}
+	case 27:
+		{
+			args := flag.Args()
+			if len(args) > 3 {
+				fmt.Printf("need at most %d args but get %d", 3, len(args))
+				return
+			}
+			bounds, cursor, err := listArgs(args)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			page, err := raftc.GetTxs(host, bounds[0], bounds[1], cursor, limit, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			printPage(page, page.NextCursor, func(w io.Writer) {
+				fmt.Fprintln(w, "HEIGHT\tTX ID\tTIMESTAMP\tHASH\tPAYLOAD")
+				for _, e := range page.Transactions {
+					fmt.Fprintf(w, "%d\t%d\t%d\t%x\t%s\n", e.Height, e.TxId, e.Timestamp, e.Transaction.HashVal(), abbreviate(e.Transaction.PayloadB))
+				}
+			})
+		}
+	case 28:
+		{
+			args := flag.Args()
+			if len(args) > 1 {
+				fmt.Printf("need at most %d args but get %d", 1, len(args))
+				return
+			}
+			cursor := ""
+			if len(args) == 1 {
+				cursor = args[0]
+			}
+			page, err := raftc.GetPoolTxs(host, cursor, limit, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			printPage(page, page.NextCursor, func(w io.Writer) {
+				fmt.Fprintln(w, "HASH\tSEQ\tARRIVAL\tPRIORITY\tSIZE\tPAYLOAD")
+				for _, e := range page.Transactions {
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", e.Hash, e.Seq, e.Arrival, e.Priority, e.Size, abbreviate(e.Transaction.PayloadB))
+				}
+			})
+		}
+	case 29:
+		{
+			c, err := raftc.GetPoolConfig(host, consistency)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("Max transactions: %d\nMax bytes: %d\nTTL: %d s\nOrdering: %s\n",
+				c.MaxTxs, c.MaxBytes, c.TTL, c.Ordering)
+		}
+	case 30:
+		{
+			args := flag.Args()
+			if len(args) != 4 {
+				fmt.Printf("need %d args but get %d", 4, len(args))
+				return
+			}
+			values := make([]int, 3)
+			for i := range values {
+				v, err := strconv.Atoi(args[i])
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				values[i] = v
+			}
+			res, err := raftc.SetPoolConfig(host, mempool.Config{
+				MaxTxs:   values[0],
+				MaxBytes: values[1],
+				TTL:      values[2],
+				Ordering: args[3],
+			})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(string(res))
+		}
+	}
+
+}
+
+// listArgs reads the [from],[to],[cursor] args of list functions.
+func listArgs(args []string) (bounds [2]int, cursor string, err error) {
+	for i := 0; i < len(args) && i < 2; i++ {
+		if bounds[i], err = strconv.Atoi(args[i]); err != nil {
+			return bounds, "", err
+		}
+	}
+	if len(args) == 3 {
+		cursor = args[2]
+	}
+	return bounds, cursor, nil
+}
+
+// printPage prints a page of a list function as JSON, or as the table
+// rows writes followed by the cursor of the next page.
+func printPage(page interface{}, next string, rows func(w io.Writer)) {
+	if output == "json" {
+		b, err := json.MarshalIndent(page, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(b))
+		return
 	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	rows(w)
+	w.Flush()
+	if next != "" {
+		fmt.Printf("Next cursor: %s\n", next)
+	}
+}
 
+// abbreviate shortens payloads to fit a table row.
+func abbreviate(payload []byte) string {
+	s := strconv.Quote(string(payload))
+	if len(s) > 40 {
+		s = s[:37] + "..."
+	}
+	return s
+}
+
+// Reads [p,q,g] from the local config file.
+func LocalChameleonParameter() ([][]byte, error) {
+	para, err := store.LoadParameter(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{para.P, para.Q, para.G}, nil
 }
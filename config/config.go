@@ -3,21 +3,27 @@ package main
 import (
 	ch "github.com/RedactableBlockChain/chameleon"
 	"github.com/RedactableBlockChain/data"
-	"github.com/RedactableBlockChain/path"
+	"github.com/RedactableBlockChain/store"
 )
 
 func main() {
-	var p,q,g,hk,tk []byte
+	var p, q, g, hk, tk []byte
 	ch.ParameterGen(128, &p, &q, &g)
 	ch.Keygen(128, p, q, g, &hk, &tk)
 	config := &data.GolbalParameter{
-		0,
-		128,
-		p,
-		q,
-		g,
-		hk,
-		tk,
+		CurHeight: 0,
+		Bits:      128,
+		P:         p,
+		Q:         q,
+		G:         g,
+		Hk:        hk,
+		Tk:        tk,
 	}
-	data.Write(config, path.GetConfigPath())
-}
\ No newline at end of file
+	st, err := store.NewFileStore("./storage/config", "./storage/pool/", "./storage/block/")
+	if err != nil {
+		panic(err)
+	}
+	if err := st.PutParameter(config); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,126 @@
+// Package consensus orders the commands of the chain. An Engine replicates
+// commands and applies them, in the same order on every node, to the state
+// machine it was created with. Chain logic only talks to the Engine, so it
+// runs unchanged on any implementation.
+package consensus
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrNotLeader   = errors.New("consensus: not leader")
+	ErrStopped     = errors.New("consensus: engine stopped")
+	ErrUnsupported = errors.New("consensus: not supported by this engine")
+)
+
+// Node states reported in Status.
+const (
+	Leader   = "leader"
+	Follower = "follower"
+	Stopped  = "stopped"
+)
+
+// A Command changes the replicated state. Engines call Execute with the
+// state machine passed to their constructor.
+type Command interface {
+	CommandName() string
+	Execute(state interface{}) (interface{}, error)
+}
+
+// StateMachine is the replicated state. Engines which compact their log
+// save it and restore it, e.g. to catch up a new node.
+type StateMachine interface {
+	Save() ([]byte, error)
+	Recovery(b []byte) error
+}
+
+// A committed command and the outcome of applying it.
+type Committed struct {
+	Index   uint64
+	Command Command
+	Result  interface{}
+	Err     error
+}
+
+type Member struct {
+	Name             string `json:"name"`
+	ConnectionString string `json:"connectionString"`
+}
+
+// CommitIndex is the last entry known to be committed, AppliedIndex the
+// last one applied to the state machine, which may lag behind it.
+type Status struct {
+	Name         string
+	State        string
+	Leader       string
+	Term         uint64
+	CommitIndex  uint64
+	AppliedIndex uint64
+}
+
+type Engine interface {
+	// Starts the engine. With join set it joins the cluster led by join
+	// (host:port), otherwise it resumes its cluster or starts a new one.
+	Start(join string) error
+	Stop()
+
+	// Propose replicates cmd and returns once it was applied on this node.
+	Propose(cmd Command) (interface{}, error)
+	// Subscribe calls fn for every command this node applies, in order.
+	Subscribe(fn func(Committed))
+	// Barrier returns once this node, which must be the leader, is sure to
+	// still lead and has applied every command committed before the call.
+	// Engines without an agreed order return ErrUnsupported.
+	Barrier() error
+
+	Name() string
+	IsLeader() bool
+	// The current leader, the zero Member while none is known.
+	Leader() Member
+	// Every member of the cluster, this node included.
+	Members() []Member
+	Status() Status
+
+	AddMember(m Member) error
+	RemoveMember(name string) error
+	// Compacts the log into a snapshot of the state machine.
+	Snapshot() error
+}
+
+// Engines which tolerate faulty members, not only crashed ones, need more
+// than a majority of them to agree.
+type QuorumEngine interface {
+	// Quorum returns how many of members must agree.
+	Quorum(members int) int
+}
+
+// Quorum returns how many of members must agree on a decision of e, a
+// majority unless e is a QuorumEngine.
+func Quorum(e Engine, members int) int {
+	if q, ok := e.(QuorumEngine); ok {
+		return q.Quorum(members)
+	}
+	return members/2 + 1
+}
+
+// Subscribers of an engine, for engine implementations.
+type Subscribers struct {
+	mutex sync.RWMutex
+	fns   []func(Committed)
+}
+
+func (s *Subscribers) Add(fn func(Committed)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fns = append(s.fns, fn)
+}
+
+func (s *Subscribers) Notify(c Committed) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, fn := range s.fns {
+		fn(c)
+	}
+}
@@ -0,0 +1,273 @@
+package consensus
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/goraft/raft"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Goraft runs the raft protocol of github.com/goraft/raft. Its transport is
+// installed under /raft of the node's HTTP mux, and joining nodes post
+// their Member to /join of the leader, which calls AddMember.
+type Goraft struct {
+	name             string
+	path             string
+	connectionString string
+	mux              raft.HTTPMuxer
+	state            StateMachine
+	server           raft.Server
+	subs             Subscribers
+	tls              *tls.Config
+	// Index of the last entry applied to state, goraft's commit index
+	// moves ahead of it while an entry is applied.
+	applied uint64
+}
+
+func NewGoraft(name, path, connectionString string, mux raft.HTTPMuxer, state StateMachine) *Goraft {
+	return &Goraft{
+		name:             name,
+		path:             path,
+		connectionString: connectionString,
+		mux:              mux,
+		state:            state,
+	}
+}
+
+func init() {
+	raft.RegisterCommand(&barrierCommand{})
+}
+
+// The no-op of Barrier. Unlike goraft's own no-op it moves the applied
+// index, which followers wait on.
+type barrierCommand struct{}
+
+func (c *barrierCommand) CommandName() string {
+	return "consensus:barrier"
+}
+
+func (c *barrierCommand) Apply(ctx raft.Context) (interface{}, error) {
+	e := ctx.Server().Context().(*Goraft)
+	atomic.StoreUint64(&e.applied, ctx.CurrentIndex())
+	return nil, nil
+}
+
+// goraftState is the state machine as goraft sees it. Snapshots carry the
+// applied index along with the state.
+type goraftState struct {
+	e *Goraft
+}
+
+type goraftSnapshot struct {
+	Applied uint64 `json:"applied"`
+	State   []byte `json:"state"`
+}
+
+func (g goraftState) Save() ([]byte, error) {
+	applied := atomic.LoadUint64(&g.e.applied)
+	state, err := g.e.state.Save()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(goraftSnapshot{Applied: applied, State: state})
+}
+
+// Snapshots taken before the applied index was tracked hold the bare state.
+func (g goraftState) Recovery(b []byte) error {
+	snap := goraftSnapshot{}
+	if err := json.Unmarshal(b, &snap); err != nil || snap.State == nil {
+		return g.e.state.Recovery(b)
+	}
+	if err := g.e.state.Recovery(snap.State); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&g.e.applied, snap.Applied)
+	return nil
+}
+
+// Makes the transport and joins use TLS with the client side config, the
+// peers must serve https. Must be called before Start.
+func (e *Goraft) SetTLS(config *tls.Config) {
+	e.tls = config
+}
+
+// ApplyGoraft applies a command for goraft. Every Command replicated by the
+// Goraft engine calls it from its goraft Apply method.
+func ApplyGoraft(ctx raft.Context, cmd Command) (interface{}, error) {
+	e := ctx.Server().Context().(*Goraft)
+	res, err := cmd.Execute(e.state)
+	atomic.StoreUint64(&e.applied, ctx.CurrentIndex())
+	e.subs.Notify(Committed{Index: ctx.CurrentIndex(), Command: cmd, Result: res, Err: err})
+	return res, err
+}
+
+func (e *Goraft) Start(join string) error {
+	logging.Info("initializing raft server", "path", e.path)
+
+	transporter := raft.NewHTTPTransporter("/raft", 200*time.Millisecond)
+	if e.tls != nil {
+		transporter.Transport.TLSClientConfig = e.tls
+	}
+	server, err := raft.NewServer(e.name, e.path, transporter, goraftState{e}, e, "")
+	if err != nil {
+		return err
+	}
+	e.server = server
+	transporter.Install(server, e.mux)
+	if err = server.LoadSnapshot(); err != nil {
+		logging.Debug("no snapshot loaded", "err", err)
+	}
+	if err = server.Start(); err != nil {
+		return err
+	}
+
+	if join != "" {
+		logging.Info("attempting to join leader", "leader", join)
+		// A node with an existing log rejoins, the leader catches it up
+		// through the log or a snapshot.
+		if !server.IsLogEmpty() {
+			logging.Info("rejoining with an existing log")
+		}
+		return e.join(join)
+	}
+	if server.IsLogEmpty() {
+		// Initialize the cluster by joining itself.
+		logging.Info("initializing new cluster")
+		_, err = server.Do(&raft.DefaultJoinCommand{
+			Name:             e.name,
+			ConnectionString: e.connectionString,
+		})
+		return err
+	}
+	logging.Info("recovered from log")
+	return nil
+}
+
+func (e *Goraft) join(leader string) error {
+	var b bytes.Buffer
+	json.NewEncoder(&b).Encode(Member{Name: e.name, ConnectionString: e.connectionString})
+	scheme, client := "http", http.DefaultClient
+	if e.tls != nil {
+		scheme = "https"
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: e.tls}}
+	}
+	resp, err := client.Post(fmt.Sprintf("%s://%s/join", scheme, leader), "application/json", &b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(string(res))
+	}
+	return nil
+}
+
+func (e *Goraft) Stop() {
+	if e.server != nil && e.server.Running() {
+		e.server.Stop()
+	}
+}
+
+func (e *Goraft) do(cmd raft.Command) (interface{}, error) {
+	if e.server == nil {
+		return nil, ErrStopped
+	}
+	res, err := e.server.Do(cmd)
+	if err == raft.NotLeaderError {
+		err = ErrNotLeader
+	} else if err == raft.StopError {
+		err = ErrStopped
+	}
+	return res, err
+}
+
+func (e *Goraft) Propose(cmd Command) (interface{}, error) {
+	return e.do(cmd)
+}
+
+func (e *Goraft) Subscribe(fn func(Committed)) {
+	e.subs.Add(fn)
+}
+
+// A no-op committed through a quorum proves leadership, and goraft applies
+// entries before Do returns.
+func (e *Goraft) Barrier() error {
+	if !e.IsLeader() {
+		return ErrNotLeader
+	}
+	_, err := e.do(&barrierCommand{})
+	return err
+}
+
+func (e *Goraft) Name() string {
+	return e.name
+}
+
+func (e *Goraft) IsLeader() bool {
+	return e.server != nil && e.server.State() == raft.Leader
+}
+
+func (e *Goraft) Leader() Member {
+	if e.server == nil {
+		return Member{}
+	}
+	if e.IsLeader() {
+		return Member{Name: e.name, ConnectionString: e.connectionString}
+	}
+	if peer, ok := e.server.Peers()[e.server.Leader()]; ok {
+		return Member{Name: peer.Name, ConnectionString: peer.ConnectionString}
+	}
+	return Member{}
+}
+
+func (e *Goraft) Members() []Member {
+	members := []Member{{Name: e.name, ConnectionString: e.connectionString}}
+	if e.server == nil {
+		return members
+	}
+	for _, peer := range e.server.Peers() {
+		members = append(members, Member{Name: peer.Name, ConnectionString: peer.ConnectionString})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+func (e *Goraft) Status() Status {
+	if e.server == nil {
+		return Status{Name: e.name, State: Stopped}
+	}
+	return Status{
+		Name:         e.name,
+		State:        e.server.State(),
+		Leader:       e.server.Leader(),
+		Term:         e.server.Term(),
+		CommitIndex:  e.server.CommitIndex(),
+		AppliedIndex: atomic.LoadUint64(&e.applied),
+	}
+}
+
+func (e *Goraft) AddMember(m Member) error {
+	_, err := e.do(&raft.DefaultJoinCommand{Name: m.Name, ConnectionString: m.ConnectionString})
+	return err
+}
+
+func (e *Goraft) RemoveMember(name string) error {
+	_, err := e.do(&raft.DefaultLeaveCommand{Name: name})
+	return err
+}
+
+func (e *Goraft) Snapshot() error {
+	if e.server == nil {
+		return ErrStopped
+	}
+	return e.server.TakeSnapshot()
+}
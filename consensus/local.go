@@ -0,0 +1,154 @@
+package consensus
+
+import (
+	"errors"
+	"sync"
+)
+
+// Local is a single node engine for development and tests: commands are
+// applied in the order Propose is called, without any replication. It has
+// no log, so its commit index starts over with every process.
+//
+// Subscribers are called after the command was applied and without any
+// lock held, in the order of the commands, so they may call back into the
+// engine, propose included.
+type Local struct {
+	// apply orders the commands, mutex guards the fields below it.
+	apply            sync.Mutex
+	mutex            sync.Mutex
+	name             string
+	connectionString string
+	state            interface{}
+	index            uint64
+	applied          uint64
+	running          bool
+	subs             Subscribers
+	// Commands applied but not yet passed to the subscribers, and whether
+	// a Propose is passing them.
+	pending   []Committed
+	notifying bool
+}
+
+func NewLocal(name, connectionString string, state interface{}) *Local {
+	return &Local{
+		name:             name,
+		connectionString: connectionString,
+		state:            state,
+	}
+}
+
+func (e *Local) Start(join string) error {
+	if join != "" {
+		return errors.New("consensus: the local engine cannot join a cluster")
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.running = true
+	return nil
+}
+
+func (e *Local) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.running = false
+}
+
+func (e *Local) Propose(cmd Command) (interface{}, error) {
+	e.apply.Lock()
+	e.mutex.Lock()
+	if !e.running {
+		e.mutex.Unlock()
+		e.apply.Unlock()
+		return nil, ErrStopped
+	}
+	e.index++
+	index := e.index
+	e.mutex.Unlock()
+
+	res, err := cmd.Execute(e.state)
+	e.mutex.Lock()
+	e.applied = index
+	e.pending = append(e.pending, Committed{Index: index, Command: cmd, Result: res, Err: err})
+	e.mutex.Unlock()
+	e.apply.Unlock()
+	e.notify()
+	return res, err
+}
+
+// notify passes the pending commands to the subscribers. A Propose of a
+// subscriber finds the outer Propose notifying and leaves its command to
+// it, which keeps the order.
+func (e *Local) notify() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.notifying {
+		return
+	}
+	e.notifying = true
+	for len(e.pending) > 0 {
+		c := e.pending[0]
+		e.pending = e.pending[1:]
+		e.mutex.Unlock()
+		e.subs.Notify(c)
+		e.mutex.Lock()
+	}
+	e.notifying = false
+}
+
+func (e *Local) Subscribe(fn func(Committed)) {
+	e.subs.Add(fn)
+}
+
+// Every proposal is applied before Propose returns, so a read after any
+// write which returned already sees it.
+func (e *Local) Barrier() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.running {
+		return ErrStopped
+	}
+	return nil
+}
+
+func (e *Local) Name() string {
+	return e.name
+}
+
+func (e *Local) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.running
+}
+
+func (e *Local) Leader() Member {
+	if !e.IsLeader() {
+		return Member{}
+	}
+	return Member{Name: e.name, ConnectionString: e.connectionString}
+}
+
+func (e *Local) Members() []Member {
+	return []Member{{Name: e.name, ConnectionString: e.connectionString}}
+}
+
+func (e *Local) Status() Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.running {
+		return Status{Name: e.name, State: Stopped, CommitIndex: e.index, AppliedIndex: e.applied}
+	}
+	return Status{Name: e.name, State: Leader, Leader: e.name, Term: 1, CommitIndex: e.index, AppliedIndex: e.applied}
+}
+
+func (e *Local) AddMember(m Member) error {
+	return errors.New("consensus: the local engine has a single member")
+}
+
+func (e *Local) RemoveMember(name string) error {
+	return errors.New("consensus: the local engine has a single member")
+}
+
+// The state is applied directly, there is no log to compact.
+func (e *Local) Snapshot() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+)
+
+type values struct {
+	list []int
+}
+
+type appendCommand struct {
+	Value int `json:"value"`
+}
+
+func (c *appendCommand) CommandName() string {
+	return "test:append"
+}
+
+func (c *appendCommand) Execute(state interface{}) (interface{}, error) {
+	v := state.(*values)
+	v.list = append(v.list, c.Value)
+	return len(v.list), nil
+}
+
+func TestLocalPropose(t *testing.T) {
+	state := &values{}
+	e := NewLocal("n1", "http://n1", state)
+	if _, err := e.Propose(&appendCommand{1}); err != ErrStopped {
+		t.Fatalf("propose before start: %v", err)
+	}
+	if err := e.Start("http://leader"); err == nil {
+		t.Fatal("local engine joined a cluster")
+	}
+	if err := e.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		res, err := e.Propose(&appendCommand{i})
+		if err != nil || res != i {
+			t.Fatalf("propose %d: %v, %v", i, res, err)
+		}
+	}
+	status := e.Status()
+	if status.State != Leader || status.CommitIndex != 3 || status.AppliedIndex != 3 {
+		t.Fatalf("status %+v", status)
+	}
+	if !e.IsLeader() || e.Leader().ConnectionString != "http://n1" {
+		t.Fatalf("leader %+v", e.Leader())
+	}
+	e.Stop()
+	if _, err := e.Propose(&appendCommand{4}); err != ErrStopped {
+		t.Fatalf("propose after stop: %v", err)
+	}
+	if err := e.Barrier(); err != ErrStopped {
+		t.Fatalf("barrier after stop: %v", err)
+	}
+	if len(state.list) != 3 {
+		t.Fatalf("state %v", state.list)
+	}
+}
+
+// Subscribers may call back into the engine, and see the commands in the
+// order they were applied.
+func TestLocalReentrantSubscriber(t *testing.T) {
+	state := &values{}
+	e := NewLocal("n1", "http://n1", state)
+	if err := e.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	var seen []uint64
+	e.Subscribe(func(c Committed) {
+		seen = append(seen, c.Index)
+		if e.Status().AppliedIndex < c.Index {
+			t.Errorf("entry %d notified before it was applied", c.Index)
+		}
+		if cmd := c.Command.(*appendCommand); cmd.Value == 1 {
+			if _, err := e.Propose(&appendCommand{2}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		e.Propose(&appendCommand{1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("propose from a subscriber deadlocked")
+	}
+	if len(seen) != 2 || seen[0] != 1 || seen[1] != 2 {
+		t.Fatalf("notified %v", seen)
+	}
+	if len(state.list) != 2 {
+		t.Fatalf("state %v", state.list)
+	}
+}
@@ -0,0 +1,301 @@
+package pbft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Files in Config.Path.
+const (
+	progressFile   = "progress.json"
+	checkpointFile = "checkpoint.json"
+)
+
+// What a checkpoint covers: the state machine, if it can save itself, and
+// the requests which still count as executed.
+type checkpointState struct {
+	State    []byte            `json:"state,omitempty"`
+	Executed map[string]uint64 `json:"executed,omitempty"`
+}
+
+// Written after every executed sequence number. A crash between executing
+// and writing it executes that sequence number again after the restart.
+type progress struct {
+	View     uint64            `json:"view"`
+	LastExec uint64            `json:"last_exec"`
+	Executed map[string]uint64 `json:"executed,omitempty"`
+}
+
+// The last stable checkpoint, written when it changes.
+type stableCheckpoint struct {
+	Seq    uint64    `json:"seq"`
+	Digest []byte    `json:"digest"`
+	Proof  []Message `json:"proof"`
+	State  []byte    `json:"state,omitempty"`
+}
+
+// The log window: sequence numbers up to this far above the low watermark
+// are accepted.
+func (e *Engine) window() uint64 {
+	return 2 * e.config.CheckpointInterval
+}
+
+func (e *Engine) inWindow(seq uint64) bool {
+	return seq > e.low && seq <= e.low+e.window()
+}
+
+func digest(raw []byte) []byte {
+	sum := sha256.Sum256(raw)
+	return sum[:]
+}
+
+// checkpoint saves the state after seq was executed and broadcasts its
+// digest.
+func (e *Engine) checkpoint(seq uint64) {
+	cs := checkpointState{Executed: e.executed}
+	var err error
+	if sm, ok := e.state.(consensus.StateMachine); ok {
+		cs.State, err = sm.Save()
+	}
+	var raw []byte
+	if err == nil {
+		raw, err = json.Marshal(&cs)
+	}
+	if err != nil {
+		logging.Warn("pbft checkpoint failed", "seq", seq, "err", err)
+		return
+	}
+	e.states[seq] = raw
+	m := &Message{Type: CheckpointMsg, Seq: seq, Digest: digest(raw)}
+	m.sign(e.id)
+	e.broadcast(m)
+	e.onCheckpoint(m)
+}
+
+// onCheckpoint keeps the latest checkpoint of each validator, and makes a
+// checkpoint stable once 2f+1 validators agree on it.
+func (e *Engine) onCheckpoint(m *Message) {
+	if m.Seq <= e.low || m.Seq%e.config.CheckpointInterval != 0 {
+		return
+	}
+	if last := e.checkpoints[m.From]; last != nil && last.Seq >= m.Seq {
+		return
+	}
+	e.checkpoints[m.From] = m
+	proof := []Message{}
+	for _, c := range e.checkpoints {
+		if c.Seq == m.Seq && bytes.Equal(c.Digest, m.Digest) {
+			proof = append(proof, *c)
+		}
+	}
+	if len(proof) < 2*e.f+1 {
+		return
+	}
+	sort.Slice(proof, func(i, j int) bool { return proof[i].From < proof[j].From })
+	e.stabilize(m.Seq, m.Digest, proof)
+}
+
+// validCheckpoint checks that 2f+1 validators signed the checkpoint.
+func (e *Engine) validCheckpoint(seq uint64, dig []byte, proof []Message) bool {
+	seen := make(map[string]bool)
+	for i := range proof {
+		c := &proof[i]
+		if c.Type != CheckpointMsg || c.Seq != seq || !bytes.Equal(c.Digest, dig) || seen[c.From] || !e.verify(c) {
+			return false
+		}
+		seen[c.From] = true
+	}
+	return len(seen) >= 2*e.f+1
+}
+
+// stabilize moves the low watermark to seq and drops the log below it. A
+// validator which has not executed seq yet fetches the state.
+func (e *Engine) stabilize(seq uint64, dig []byte, proof []Message) {
+	e.low, e.lowDigest, e.lowProof, e.lowState = seq, dig, proof, nil
+	if raw, ok := e.states[seq]; ok {
+		if bytes.Equal(digest(raw), dig) {
+			e.lowState = raw
+		} else {
+			logging.Error("pbft state differs from the stable checkpoint", "seq", seq)
+		}
+	}
+	for s := range e.states {
+		if s <= seq {
+			delete(e.states, s)
+		}
+	}
+	for s := range e.log {
+		if s <= seq {
+			delete(e.log, s)
+		}
+	}
+	for name, c := range e.checkpoints {
+		if c.Seq <= seq {
+			delete(e.checkpoints, name)
+		}
+	}
+	if e.seq < seq {
+		e.seq = seq
+	}
+	e.persistCheckpoint()
+	logging.Info("pbft checkpoint stable", "seq", seq)
+	if e.lastExec < seq {
+		e.fetchState()
+		return
+	}
+	// The window moved, requests which waited for it can be assigned.
+	if !e.changing && e.primary(e.view) == e.id.Name {
+		ids := []string{}
+		for id := range e.pending {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			e.assign(e.pending[id].request)
+		}
+	}
+}
+
+// fetchState asks the validators which signed the stable checkpoint for
+// its state.
+func (e *Engine) fetchState() {
+	logging.Info("pbft fetching checkpoint state", "seq", e.low, "executed", e.lastExec)
+	m := &Message{Type: FetchStateMsg, Seq: e.low}
+	m.sign(e.id)
+	for i := range e.lowProof {
+		if from := e.lowProof[i].From; from != e.id.Name {
+			e.config.Transport.Send(from, m)
+		}
+	}
+}
+
+func (e *Engine) onFetchState(m *Message) {
+	if e.lowState == nil || e.low < m.Seq {
+		return
+	}
+	s := &Message{Type: StateMsg, Seq: e.low, Digest: e.lowDigest, Checkpoints: e.lowProof, State: e.lowState}
+	s.sign(e.id)
+	e.config.Transport.Send(m.From, s)
+}
+
+// onState installs a checkpoint state which matches a stable checkpoint.
+// The state machine restores it without the engine's lock held, it may
+// call back into the engine.
+func (e *Engine) onState(m *Message) {
+	if e.installing || m.Seq <= e.lastExec || !e.validCheckpoint(m.Seq, m.Digest, m.Checkpoints) {
+		return
+	}
+	if !bytes.Equal(digest(m.State), m.Digest) {
+		logging.Warn("pbft state does not match its checkpoint", "from", m.From, "seq", m.Seq)
+		return
+	}
+	cs := checkpointState{}
+	if err := json.Unmarshal(m.State, &cs); err != nil {
+		logging.Warn("pbft unreadable state", "from", m.From, "seq", m.Seq, "err", err)
+		return
+	}
+	e.installing = true
+	go e.install(m, &cs)
+}
+
+func (e *Engine) install(m *Message, cs *checkpointState) {
+	var err error
+	if sm, ok := e.state.(consensus.StateMachine); ok {
+		err = sm.Recovery(cs.State)
+	} else if cs.State != nil {
+		err = errors.New("pbft: the state machine cannot restore a checkpoint")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.installing = false
+	if err != nil {
+		logging.Warn("pbft state transfer failed", "from", m.From, "seq", m.Seq, "err", err)
+		return
+	}
+	if m.Seq <= e.lastExec {
+		return
+	}
+	e.lastExec = m.Seq
+	e.executed = cs.Executed
+	if e.executed == nil {
+		e.executed = make(map[string]uint64)
+	}
+	// Requests the state already covers finish without their result.
+	for id := range e.executed {
+		delete(e.pending, id)
+		if ch, ok := e.waiters[id]; ok {
+			ch <- result{}
+			delete(e.waiters, id)
+		}
+	}
+	if m.Seq > e.low {
+		e.stabilize(m.Seq, m.Digest, m.Checkpoints)
+	}
+	if m.Seq == e.low {
+		e.lowState = m.State
+		e.persistCheckpoint()
+	}
+	e.persist()
+	logging.Info("pbft state transferred", "from", m.From, "seq", m.Seq)
+	e.executeReady()
+}
+
+// load reads the progress and the stable checkpoint of a restarted
+// validator.
+func (e *Engine) load() error {
+	if e.config.Path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(e.config.Path, 0755); err != nil {
+		return err
+	}
+	p := progress{}
+	err := data.Load(&p, filepath.Join(e.config.Path, progressFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	e.view, e.target, e.lastExec = p.View, p.View, p.LastExec
+	if p.Executed != nil {
+		e.executed = p.Executed
+	}
+	c := stableCheckpoint{}
+	err = data.Load(&c, filepath.Join(e.config.Path, checkpointFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	e.low, e.lowDigest, e.lowProof, e.lowState = c.Seq, c.Digest, c.Proof, c.State
+	e.seq = e.lastExec
+	if e.low > e.seq {
+		e.seq = e.low
+	}
+	return nil
+}
+
+func (e *Engine) persist() {
+	if e.config.Path == "" {
+		return
+	}
+	p := &progress{View: e.view, LastExec: e.lastExec, Executed: e.executed}
+	if err := data.Write(p, filepath.Join(e.config.Path, progressFile)); err != nil {
+		logging.Warn("pbft progress not saved", "seq", e.lastExec, "err", err)
+	}
+}
+
+func (e *Engine) persistCheckpoint() {
+	if e.config.Path == "" {
+		return
+	}
+	c := &stableCheckpoint{Seq: e.low, Digest: e.lowDigest, Proof: e.lowProof, State: e.lowState}
+	if err := data.Write(c, filepath.Join(e.config.Path, checkpointFile)); err != nil {
+		logging.Warn("pbft checkpoint not saved", "seq", e.low, "err", err)
+	}
+}
@@ -0,0 +1,133 @@
+package pbft
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/identity"
+	"io/ioutil"
+)
+
+// Message types.
+const (
+	RequestMsg    = "request"
+	PrePrepareMsg = "pre-prepare"
+	PrepareMsg    = "prepare"
+	CommitMsg     = "commit"
+	ViewChangeMsg = "view-change"
+	NewViewMsg    = "new-view"
+	CheckpointMsg = "checkpoint"
+	FetchStateMsg = "fetch-state"
+	StateMsg      = "state"
+)
+
+// A command to order, signed by the validator which submitted it, so a
+// primary cannot make one up. Command "" is a no-op, used for read
+// barriers, and the request without ID fills sequence gaps after a view
+// change.
+type Request struct {
+	ID        string          `json:"id"`
+	Command   string          `json:"command"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	From      string          `json:"from,omitempty"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+func (r *Request) signedBytes() []byte {
+	c := *r
+	c.Signature = nil
+	raw, _ := json.Marshal(&c)
+	return raw
+}
+
+func (r *Request) sign(id *identity.Identity) {
+	r.From = id.Name
+	r.Signature = id.Sign(r.signedBytes())
+}
+
+func (r *Request) Digest() []byte {
+	raw, _ := json.Marshal(r)
+	sum := sha256.Sum256(raw)
+	return sum[:]
+}
+
+// Evidence that a request was prepared at Seq in some view: its pre-prepare
+// and 2f matching prepares.
+type Proof struct {
+	PrePrepare Message   `json:"pre_prepare"`
+	Prepares   []Message `json:"prepares"`
+}
+
+// Every message is signed by its sender over its JSON encoding without the
+// signature.
+type Message struct {
+	Type    string   `json:"type"`
+	View    uint64   `json:"view"`
+	Seq     uint64   `json:"seq"`
+	Digest  []byte   `json:"digest,omitempty"`
+	Request *Request `json:"request,omitempty"`
+	// view-change: every request the sender prepared
+	Prepared []Proof `json:"prepared,omitempty"`
+	// new-view: the 2f+1 view-changes it is based on and the pre-prepares
+	// of the new view which follow from them
+	ViewChanges []Message `json:"view_changes,omitempty"`
+	PrePrepares []Message `json:"pre_prepares,omitempty"`
+	// view-change and state: the 2f+1 checkpoints which made Seq stable
+	Checkpoints []Message `json:"checkpoints,omitempty"`
+	// state: the checkpoint state at Seq, whose hash is Digest
+	State []byte `json:"state,omitempty"`
+
+	From      string `json:"from"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+func (m *Message) signedBytes() []byte {
+	c := *m
+	c.Signature = nil
+	raw, _ := json.Marshal(&c)
+	return raw
+}
+
+func (m *Message) sign(id *identity.Identity) {
+	m.From = id.Name
+	m.Signature = id.Sign(m.signedBytes())
+}
+
+// A member of the fixed validator set.
+type Validator struct {
+	Name      string            `json:"name"`
+	Address   string            `json:"address"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+}
+
+// Reads a JSON list of validators.
+func LoadValidators(path string) ([]Validator, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	validators := []Validator{}
+	if err = json.Unmarshal(raw, &validators); err != nil {
+		return nil, err
+	}
+	return validators, checkValidators(validators)
+}
+
+func checkValidators(validators []Validator) error {
+	if len(validators) < 4 {
+		return errors.New("pbft: at least 4 validators are needed to tolerate a faulty one")
+	}
+	seen := make(map[string]bool)
+	for _, v := range validators {
+		if seen[v.Name] {
+			return fmt.Errorf("pbft: duplicate validator %s", v.Name)
+		}
+		if len(v.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("pbft: validator %s has an invalid public key", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,925 @@
+// Package pbft orders commands with Practical Byzantine Fault Tolerance
+// over a fixed set of n >= 3f+1 validators, f of which may be faulty.
+//
+// The primary of view v is validators[v % n]. It assigns a sequence number
+// to each request and broadcasts a pre-prepare; the other validators
+// broadcast a prepare for it. A request is prepared at a validator once it
+// holds the pre-prepare and 2f matching prepares, and then the validator
+// broadcasts a commit. It is committed once 2f+1 matching commits arrived,
+// and executed in sequence order. When requests stay pending for
+// ViewTimeout the validators move to the next view through view-change and
+// new-view messages, which carry every prepared request into the new view.
+// All messages are signed with the sender's identity.
+//
+// Every CheckpointInterval sequence numbers the validators broadcast a
+// checkpoint with the digest of their state. Once 2f+1 match it is stable:
+// it becomes the low watermark, the log below it is dropped, and only
+// sequence numbers up to two intervals above it are accepted. A validator
+// which finds a stable checkpoint ahead of its execution fetches the
+// checkpoint state from the validators which signed it. Requests are
+// recognised as executed for two intervals; a request replayed later is
+// executed again, and the commands of the chain reject it then.
+package pbft
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/identity"
+	"github.com/RedactableBlockChain/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultViewTimeout        = 5 * time.Second
+	DefaultProposeTimeout     = 30 * time.Second
+	DefaultCheckpointInterval = 100
+	// Messages of views not entered yet which are kept until the new-view
+	// arrives.
+	maxFuture = 10000
+)
+
+var ErrFixedValidators = errors.New("pbft: the validator set is fixed")
+
+type Config struct {
+	Identity   *identity.Identity
+	Validators []Validator
+	Transport  Transport
+	// How long a request may stay pending before the primary is suspected.
+	ViewTimeout time.Duration
+	// How long Propose waits for the request to execute.
+	ProposeTimeout time.Duration
+	// How many sequence numbers lie between checkpoints.
+	CheckpointInterval uint64
+	// Dir which keeps the progress of the validator across restarts, ""
+	// keeps it in memory only.
+	Path string
+}
+
+// The state of one sequence number in the view it was last pre-prepared.
+type entry struct {
+	view       uint64
+	digest     []byte
+	request    *Request
+	prePrepare *Message
+	prepares   map[string]*Message
+	commits    map[string]*Message
+	prepared   bool
+	committed  bool
+}
+
+type pending struct {
+	request *Request
+	since   time.Time
+}
+
+type result struct {
+	res interface{}
+	err error
+}
+
+type Engine struct {
+	mutex      sync.Mutex
+	config     Config
+	id         *identity.Identity
+	validators []Validator
+	keys       map[string]ed25519.PublicKey
+	f          int
+	state      interface{}
+	subs       consensus.Subscribers
+
+	running bool
+	stop    chan struct{}
+	counter uint64
+
+	view     uint64
+	changing bool
+	target   uint64
+	changed  time.Time
+	// A view entered through adoptView, whose new-view is still welcome.
+	adopted  uint64
+	seq      uint64
+	lastExec uint64
+	log      map[uint64]*entry
+	assigned map[string]bool
+	future   []*Message
+
+	// The last stable checkpoint, the low watermark, with its proof and
+	// the checkpoint state if this validator holds it.
+	low       uint64
+	lowDigest []byte
+	lowProof  []Message
+	lowState  []byte
+	// The latest checkpoint of each validator, and the own checkpoint
+	// states which are not stable yet.
+	checkpoints map[string]*Message
+	states      map[uint64][]byte
+	installing  bool
+
+	pending map[string]*pending
+	// Requests executed in the last two intervals, by sequence number.
+	executed map[string]uint64
+	waiters  map[string]chan result
+
+	viewChanges map[uint64]map[string]*Message
+	newViewSent map[uint64]bool
+}
+
+func New(config Config, state interface{}) (*Engine, error) {
+	if err := checkValidators(config.Validators); err != nil {
+		return nil, err
+	}
+	if config.Identity == nil || config.Transport == nil {
+		return nil, errors.New("pbft: an identity and a transport are needed")
+	}
+	if config.ViewTimeout <= 0 {
+		config.ViewTimeout = DefaultViewTimeout
+	}
+	if config.ProposeTimeout <= 0 {
+		config.ProposeTimeout = DefaultProposeTimeout
+	}
+	if config.CheckpointInterval == 0 {
+		config.CheckpointInterval = DefaultCheckpointInterval
+	}
+	e := &Engine{
+		config:      config,
+		id:          config.Identity,
+		validators:  config.Validators,
+		keys:        make(map[string]ed25519.PublicKey),
+		f:           (len(config.Validators) - 1) / 3,
+		state:       state,
+		log:         make(map[uint64]*entry),
+		assigned:    make(map[string]bool),
+		checkpoints: make(map[string]*Message),
+		states:      make(map[uint64][]byte),
+		pending:     make(map[string]*pending),
+		executed:    make(map[string]uint64),
+		waiters:     make(map[string]chan result),
+		viewChanges: make(map[uint64]map[string]*Message),
+		newViewSent: make(map[uint64]bool),
+	}
+	for _, v := range config.Validators {
+		e.keys[v.Name] = v.PublicKey
+	}
+	if key, ok := e.keys[e.id.Name]; !ok || !bytes.Equal(key, e.id.PublicKey) {
+		return nil, fmt.Errorf("pbft: %s is not a validator with this identity", e.id.Name)
+	}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) primary(view uint64) string {
+	return e.validators[view%uint64(len(e.validators))].Name
+}
+
+func (e *Engine) broadcast(m *Message) {
+	for _, v := range e.validators {
+		if v.Name != e.id.Name {
+			e.config.Transport.Send(v.Name, m)
+		}
+	}
+}
+
+func (e *Engine) Start(join string) error {
+	if join != "" {
+		return ErrFixedValidators
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.running {
+		return nil
+	}
+	e.running = true
+	e.stop = make(chan struct{})
+	go e.timerLoop(e.stop)
+	logging.Info("pbft started", "name", e.id.Name, "validators", len(e.validators), "faulty", e.f, "executed", e.lastExec)
+	if e.lastExec < e.low {
+		e.fetchState()
+	}
+	return nil
+}
+
+func (e *Engine) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.running {
+		return
+	}
+	e.running = false
+	close(e.stop)
+	for id, ch := range e.waiters {
+		ch <- result{err: consensus.ErrStopped}
+		delete(e.waiters, id)
+	}
+}
+
+func (e *Engine) Propose(cmd consensus.Command) (interface{}, error) {
+	name, data, err := consensus.EncodeCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return e.submit(name, data)
+}
+
+func (e *Engine) Subscribe(fn func(consensus.Committed)) {
+	e.subs.Add(fn)
+}
+
+// A no-op ordered through 2f+1 validators, executed locally before it
+// returns.
+func (e *Engine) Barrier() error {
+	_, err := e.submit("", nil)
+	return err
+}
+
+// submit broadcasts a request to every validator, so all of them time the
+// primary, and waits for its local execution.
+func (e *Engine) submit(command string, data []byte) (interface{}, error) {
+	e.mutex.Lock()
+	if !e.running {
+		e.mutex.Unlock()
+		return nil, consensus.ErrStopped
+	}
+	e.counter++
+	req := &Request{
+		ID:      fmt.Sprintf("%s-%d-%d", e.id.Name, time.Now().UnixNano(), e.counter),
+		Command: command,
+		Data:    data,
+	}
+	req.sign(e.id)
+	ch := make(chan result, 1)
+	e.waiters[req.ID] = ch
+	m := &Message{Type: RequestMsg, View: e.view, Request: req}
+	m.sign(e.id)
+	e.broadcast(m)
+	e.onRequest(req)
+	e.mutex.Unlock()
+
+	select {
+	case r := <-ch:
+		return r.res, r.err
+	case <-time.After(e.config.ProposeTimeout):
+		e.mutex.Lock()
+		delete(e.waiters, req.ID)
+		e.mutex.Unlock()
+		return nil, errors.New("pbft: request timed out")
+	}
+}
+
+func (e *Engine) Name() string {
+	return e.id.Name
+}
+
+func (e *Engine) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.running && !e.changing && e.primary(e.view) == e.id.Name
+}
+
+func (e *Engine) Leader() consensus.Member {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.changing {
+		return consensus.Member{}
+	}
+	v := e.validators[e.view%uint64(len(e.validators))]
+	return consensus.Member{Name: v.Name, ConnectionString: v.Address}
+}
+
+func (e *Engine) Members() []consensus.Member {
+	members := make([]consensus.Member, 0, len(e.validators))
+	for _, v := range e.validators {
+		members = append(members, consensus.Member{Name: v.Name, ConnectionString: v.Address})
+	}
+	return members
+}
+
+// Quorum is a byzantine quorum, 2f+1 of 3f+1 members: any two quorums
+// share a member which is not faulty.
+func (e *Engine) Quorum(members int) int {
+	f := (members - 1) / 3
+	return (members+f)/2 + 1
+}
+
+// The view is reported as term and the last executed sequence number as
+// commit and applied index.
+func (e *Engine) Status() consensus.Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	status := consensus.Status{Name: e.id.Name, Term: e.view, CommitIndex: e.lastExec, AppliedIndex: e.lastExec}
+	switch {
+	case !e.running:
+		status.State = consensus.Stopped
+	case e.primary(e.view) == e.id.Name && !e.changing:
+		status.State = consensus.Leader
+	default:
+		status.State = consensus.Follower
+	}
+	if !e.changing {
+		status.Leader = e.primary(e.view)
+	}
+	return status
+}
+
+func (e *Engine) AddMember(m consensus.Member) error {
+	return ErrFixedValidators
+}
+
+func (e *Engine) RemoveMember(name string) error {
+	return ErrFixedValidators
+}
+
+// The log is compacted at every stable checkpoint, the chain keeps its own
+// snapshots.
+func (e *Engine) Snapshot() error {
+	return nil
+}
+
+// Deliver handles a message from another validator. Messages which are not
+// signed by their sender are dropped.
+func (e *Engine) Deliver(m *Message) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.running {
+		return
+	}
+	if !e.verify(m) {
+		logging.Warn("pbft dropped message with a bad signature", "type", m.Type, "from", m.From)
+		return
+	}
+	switch m.Type {
+	case RequestMsg:
+		if m.Request != nil {
+			e.onRequest(m.Request)
+		}
+	case PrePrepareMsg:
+		e.onPrePrepare(m)
+	case PrepareMsg:
+		e.onPrepare(m)
+	case CommitMsg:
+		e.onCommit(m)
+	case ViewChangeMsg:
+		e.onViewChange(m)
+	case NewViewMsg:
+		e.onNewView(m)
+	case CheckpointMsg:
+		e.onCheckpoint(m)
+	case FetchStateMsg:
+		e.onFetchState(m)
+	case StateMsg:
+		e.onState(m)
+	}
+}
+
+func (e *Engine) verify(m *Message) bool {
+	key, ok := e.keys[m.From]
+	return ok && identity.Verify(key, m.signedBytes(), m.Signature)
+}
+
+// validRequest checks that a validator submitted req, or that it is the
+// gap filler of a new view.
+func (e *Engine) validRequest(req *Request) bool {
+	if req.ID == "" {
+		return req.Command == "" && len(req.Data) == 0
+	}
+	key, ok := e.keys[req.From]
+	return ok && identity.Verify(key, req.signedBytes(), req.Signature)
+}
+
+func (e *Engine) onRequest(req *Request) {
+	if !e.validRequest(req) {
+		logging.Warn("pbft dropped request with a bad signature", "id", req.ID, "from", req.From)
+		return
+	}
+	if _, ok := e.executed[req.ID]; ok {
+		return
+	}
+	if _, ok := e.pending[req.ID]; !ok {
+		e.pending[req.ID] = &pending{request: req, since: time.Now()}
+	}
+	if !e.changing && e.primary(e.view) == e.id.Name {
+		e.assign(req)
+	}
+}
+
+// assign pre-prepares a request at the next sequence number. Primary only.
+// Requests beyond the high watermark wait for the next stable checkpoint.
+func (e *Engine) assign(req *Request) {
+	if e.assigned[req.ID] || e.seq >= e.low+e.window() {
+		return
+	}
+	e.assigned[req.ID] = true
+	e.seq++
+	m := &Message{Type: PrePrepareMsg, View: e.view, Seq: e.seq, Digest: req.Digest(), Request: req}
+	m.sign(e.id)
+	e.broadcast(m)
+	e.acceptPrePrepare(m)
+}
+
+// later reports whether a message cannot be handled now. Messages of a
+// view which is not entered yet are buffered, they may arrive before the
+// new-view; those of the current view are dropped while leaving it. Once
+// f+1 validators sent messages of a later view, e.g. while this one was
+// down, it follows them there.
+func (e *Engine) later(m *Message) bool {
+	if m.View > e.view {
+		if len(e.future) < maxFuture {
+			e.future = append(e.future, m)
+		}
+		senders := make(map[string]bool)
+		for _, f := range e.future {
+			if f.View == m.View {
+				senders[f.From] = true
+			}
+		}
+		if len(senders) > e.f {
+			logging.Warn("pbft following validators to a later view", "view", m.View)
+			e.adoptView(m.View)
+		}
+		return true
+	}
+	return e.changing
+}
+
+func (e *Engine) onPrePrepare(m *Message) {
+	if e.later(m) || m.View != e.view || m.From != e.primary(m.View) {
+		return
+	}
+	if m.Request == nil || !bytes.Equal(m.Digest, m.Request.Digest()) || !e.validRequest(m.Request) {
+		logging.Warn("pbft pre-prepare does not match its request", "from", m.From, "seq", m.Seq)
+		e.startViewChange(e.view + 1)
+		return
+	}
+	e.acceptPrePrepare(m)
+}
+
+// entryFor returns the entry of seq for view, replacing one of an older
+// view. nil means the message is for a view already left behind at seq.
+func (e *Engine) entryFor(seq, view uint64) *entry {
+	ent := e.log[seq]
+	if ent != nil && ent.view == view {
+		return ent
+	}
+	if ent != nil && ent.view > view {
+		return nil
+	}
+	ent = &entry{
+		view:     view,
+		prepares: make(map[string]*Message),
+		commits:  make(map[string]*Message),
+	}
+	e.log[seq] = ent
+	return ent
+}
+
+func (e *Engine) acceptPrePrepare(m *Message) {
+	if !e.inWindow(m.Seq) {
+		return
+	}
+	ent := e.entryFor(m.Seq, m.View)
+	if ent == nil {
+		return
+	}
+	if ent.prePrepare != nil {
+		if !bytes.Equal(ent.digest, m.Digest) {
+			logging.Warn("pbft primary equivocated", "primary", m.From, "view", m.View, "seq", m.Seq)
+			e.startViewChange(e.view + 1)
+		}
+		return
+	}
+	ent.prePrepare = m
+	ent.digest = m.Digest
+	ent.request = m.Request
+	if _, ok := e.executed[m.Request.ID]; m.Request.ID != "" && !ok {
+		if _, ok := e.pending[m.Request.ID]; !ok {
+			e.pending[m.Request.ID] = &pending{request: m.Request, since: time.Now()}
+		}
+	}
+	if e.primary(m.View) != e.id.Name {
+		p := &Message{Type: PrepareMsg, View: m.View, Seq: m.Seq, Digest: m.Digest}
+		p.sign(e.id)
+		e.broadcast(p)
+		ent.prepares[e.id.Name] = p
+	}
+	e.check(m.Seq, ent)
+}
+
+func (e *Engine) onPrepare(m *Message) {
+	if e.later(m) || m.View != e.view || m.From == e.primary(m.View) || !e.inWindow(m.Seq) {
+		return
+	}
+	if ent := e.entryFor(m.Seq, m.View); ent != nil {
+		ent.prepares[m.From] = m
+		e.check(m.Seq, ent)
+	}
+}
+
+func (e *Engine) onCommit(m *Message) {
+	if e.later(m) || m.View != e.view || !e.inWindow(m.Seq) {
+		return
+	}
+	if ent := e.entryFor(m.Seq, m.View); ent != nil {
+		ent.commits[m.From] = m
+		e.check(m.Seq, ent)
+	}
+}
+
+func matching(msgs map[string]*Message, digest []byte) int {
+	n := 0
+	for _, m := range msgs {
+		if bytes.Equal(m.Digest, digest) {
+			n++
+		}
+	}
+	return n
+}
+
+func (e *Engine) check(seq uint64, ent *entry) {
+	if ent.prePrepare == nil {
+		return
+	}
+	if !ent.prepared && matching(ent.prepares, ent.digest) >= 2*e.f {
+		ent.prepared = true
+		c := &Message{Type: CommitMsg, View: ent.view, Seq: seq, Digest: ent.digest}
+		c.sign(e.id)
+		e.broadcast(c)
+		ent.commits[e.id.Name] = c
+	}
+	if ent.prepared && !ent.committed && matching(ent.commits, ent.digest) >= 2*e.f+1 {
+		ent.committed = true
+		e.executeReady()
+	}
+}
+
+// executeReady executes committed entries in sequence order.
+func (e *Engine) executeReady() {
+	for {
+		ent := e.log[e.lastExec+1]
+		if ent == nil || !ent.committed {
+			return
+		}
+		e.lastExec++
+		e.execute(ent.request)
+		if e.lastExec%e.config.CheckpointInterval == 0 {
+			e.checkpoint(e.lastExec)
+		}
+		e.persist()
+	}
+}
+
+// execute applies a request at lastExec. Which requests count as executed
+// only depends on the sequence, so every validator skips the same ones.
+func (e *Engine) execute(req *Request) {
+	for id, seq := range e.executed {
+		if seq+e.window() <= e.lastExec {
+			delete(e.executed, id)
+		}
+	}
+	if _, ok := e.executed[req.ID]; req.ID == "" || ok {
+		return
+	}
+	e.executed[req.ID] = e.lastExec
+	delete(e.pending, req.ID)
+	delete(e.assigned, req.ID)
+	var r result
+	if req.Command != "" {
+		cmd, err := consensus.DecodeCommand(req.Command, req.Data)
+		if err != nil {
+			r.err = err
+		} else {
+			r.res, r.err = cmd.Execute(e.state)
+			e.subs.Notify(consensus.Committed{Index: e.lastExec, Command: cmd, Result: r.res, Err: r.err})
+		}
+	}
+	if ch, ok := e.waiters[req.ID]; ok {
+		ch <- r
+		delete(e.waiters, req.ID)
+	}
+}
+
+// timerLoop suspects the primary when a request stays pending too long, and
+// moves on to the next view when a view change does not complete.
+func (e *Engine) timerLoop(stop chan struct{}) {
+	ticker := time.NewTicker(e.config.ViewTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			e.mutex.Lock()
+			if e.lastExec < e.low && !e.installing {
+				e.fetchState()
+			}
+			if e.changing {
+				if now.Sub(e.changed) > 2*e.config.ViewTimeout {
+					e.startViewChange(e.target + 1)
+				}
+			} else {
+				for _, p := range e.pending {
+					if now.Sub(p.since) > e.config.ViewTimeout {
+						logging.Warn("pbft primary suspected", "primary", e.primary(e.view), "view", e.view)
+						e.startViewChange(e.view + 1)
+						break
+					}
+				}
+			}
+			e.mutex.Unlock()
+		}
+	}
+}
+
+func (e *Engine) startViewChange(view uint64) {
+	if view <= e.view || (e.changing && view <= e.target) {
+		return
+	}
+	e.changing = true
+	e.target = view
+	e.changed = time.Now()
+	m := &Message{Type: ViewChangeMsg, View: view, Seq: e.low, Digest: e.lowDigest, Checkpoints: e.lowProof}
+	seqs := make([]uint64, 0, len(e.log))
+	for seq := range e.log {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		ent := e.log[seq]
+		if !ent.prepared {
+			continue
+		}
+		proof := Proof{PrePrepare: *ent.prePrepare}
+		for _, p := range ent.prepares {
+			if bytes.Equal(p.Digest, ent.digest) {
+				proof.Prepares = append(proof.Prepares, *p)
+			}
+		}
+		m.Prepared = append(m.Prepared, proof)
+	}
+	m.sign(e.id)
+	logging.Warn("pbft view change", "view", view)
+	e.broadcast(m)
+	e.onViewChange(m)
+}
+
+// validProof checks a pre-prepare by the primary of its view and 2f
+// matching prepares by distinct other validators.
+func (e *Engine) validProof(p *Proof) bool {
+	pp := &p.PrePrepare
+	if pp.Type != PrePrepareMsg || pp.From != e.primary(pp.View) || !e.verify(pp) {
+		return false
+	}
+	if pp.Request == nil || !bytes.Equal(pp.Digest, pp.Request.Digest()) || !e.validRequest(pp.Request) {
+		return false
+	}
+	seen := make(map[string]bool)
+	for i := range p.Prepares {
+		m := &p.Prepares[i]
+		if m.Type != PrepareMsg || m.View != pp.View || m.Seq != pp.Seq || !bytes.Equal(m.Digest, pp.Digest) {
+			return false
+		}
+		if m.From == pp.From || seen[m.From] || !e.verify(m) {
+			return false
+		}
+		seen[m.From] = true
+	}
+	return len(seen) >= 2*e.f
+}
+
+// validViewChange checks a view-change's stable checkpoint and that it
+// only carries requests prepared between the watermarks of it.
+func (e *Engine) validViewChange(m *Message, view uint64) bool {
+	if m.Type != ViewChangeMsg || m.View != view || !e.verify(m) {
+		return false
+	}
+	if m.Seq > 0 && !e.validCheckpoint(m.Seq, m.Digest, m.Checkpoints) {
+		return false
+	}
+	for i := range m.Prepared {
+		seq := m.Prepared[i].PrePrepare.Seq
+		if seq <= m.Seq || seq > m.Seq+e.window() || !e.validProof(&m.Prepared[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) onViewChange(m *Message) {
+	if m.View <= e.view || !e.validViewChange(m, m.View) {
+		return
+	}
+	vcs := e.viewChanges[m.View]
+	if vcs == nil {
+		vcs = make(map[string]*Message)
+		e.viewChanges[m.View] = vcs
+	}
+	vcs[m.From] = m
+	// f+1 validators include an honest one, so the view change is real.
+	if len(vcs) > e.f {
+		e.startViewChange(m.View)
+	}
+	if e.primary(m.View) == e.id.Name && len(vcs) >= 2*e.f+1 && !e.newViewSent[m.View] {
+		e.sendNewView(m.View)
+	}
+}
+
+// newViewPrePrepares derives the pre-prepares of a new view from its
+// view-changes: every sequence number above the latest stable checkpoint
+// up to the highest prepared one is re-issued with the request prepared in
+// the highest view, or a no-op. Valid view-changes keep this within the
+// watermarks.
+func newViewPrePrepares(view uint64, vcs []Message) []Message {
+	if len(vcs) == 0 {
+		return nil
+	}
+	low := latestCheckpoint(vcs).Seq
+	high := low
+	best := make(map[uint64]*Message)
+	for i := range vcs {
+		for j := range vcs[i].Prepared {
+			pp := &vcs[i].Prepared[j].PrePrepare
+			if pp.Seq > high {
+				high = pp.Seq
+			}
+			if b, ok := best[pp.Seq]; !ok || pp.View > b.View {
+				best[pp.Seq] = pp
+			}
+		}
+	}
+	pps := []Message{}
+	for seq := low + 1; seq <= high; seq++ {
+		req := &Request{}
+		if pp, ok := best[seq]; ok {
+			req = pp.Request
+		}
+		pps = append(pps, Message{Type: PrePrepareMsg, View: view, Seq: seq, Digest: req.Digest(), Request: req})
+	}
+	return pps
+}
+
+func (e *Engine) sendNewView(view uint64) {
+	e.newViewSent[view] = true
+	names := []string{}
+	for name := range e.viewChanges[view] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vcs := []Message{}
+	for _, name := range names[:2*e.f+1] {
+		vcs = append(vcs, *e.viewChanges[view][name])
+	}
+	pps := newViewPrePrepares(view, vcs)
+	for i := range pps {
+		pps[i].sign(e.id)
+	}
+	m := &Message{Type: NewViewMsg, View: view, ViewChanges: vcs, PrePrepares: pps}
+	m.sign(e.id)
+	e.broadcast(m)
+	e.enterView(m)
+}
+
+// onNewView checks a new-view against the view-changes it carries before
+// entering the view; a primary which made up its pre-prepares is ignored
+// and the view change timer moves past it.
+func (e *Engine) onNewView(m *Message) {
+	if (m.View <= e.view && (e.adopted == 0 || m.View != e.adopted)) || m.From != e.primary(m.View) {
+		return
+	}
+	seen := make(map[string]bool)
+	for i := range m.ViewChanges {
+		vc := &m.ViewChanges[i]
+		if seen[vc.From] || !e.validViewChange(vc, m.View) {
+			logging.Warn("pbft new-view has an invalid view-change", "from", m.From, "view", m.View)
+			return
+		}
+		seen[vc.From] = true
+	}
+	if len(seen) < 2*e.f+1 {
+		return
+	}
+	expected := newViewPrePrepares(m.View, m.ViewChanges)
+	if len(expected) != len(m.PrePrepares) {
+		logging.Warn("pbft new-view does not follow from its view-changes", "from", m.From, "view", m.View)
+		return
+	}
+	for i := range expected {
+		pp := &m.PrePrepares[i]
+		if pp.Type != PrePrepareMsg || pp.View != m.View || pp.Seq != expected[i].Seq ||
+			!bytes.Equal(pp.Digest, expected[i].Digest) || pp.From != m.From || !e.verify(pp) {
+			logging.Warn("pbft new-view does not follow from its view-changes", "from", m.From, "view", m.View)
+			return
+		}
+	}
+	e.enterView(m)
+}
+
+// latestCheckpoint returns the view-change with the highest stable
+// checkpoint.
+func latestCheckpoint(vcs []Message) *Message {
+	latest := &vcs[0]
+	for i := range vcs {
+		if vcs[i].Seq > latest.Seq {
+			latest = &vcs[i]
+		}
+	}
+	return latest
+}
+
+func (e *Engine) enterView(m *Message) {
+	if vc := latestCheckpoint(m.ViewChanges); vc.Seq > e.low {
+		e.stabilize(vc.Seq, vc.Digest, vc.Checkpoints)
+	}
+	e.adopted = 0
+	e.view = m.View
+	e.changing = false
+	e.target = m.View
+	e.assigned = make(map[string]bool)
+	e.seq = e.lastExec
+	if e.low > e.seq {
+		e.seq = e.low
+	}
+	for view := range e.viewChanges {
+		if view <= m.View {
+			delete(e.viewChanges, view)
+		}
+	}
+	logging.Info("pbft entered view", "view", e.view, "primary", e.primary(e.view))
+	for i := range m.PrePrepares {
+		pp := &m.PrePrepares[i]
+		if pp.Seq > e.seq {
+			e.seq = pp.Seq
+		}
+		e.assigned[pp.Request.ID] = true
+		e.acceptPrePrepare(pp)
+	}
+	e.persist()
+	e.resume()
+}
+
+// adoptView moves to a view whose new-view this validator missed. The
+// sequence numbers that new-view re-issued are caught up through state
+// transfer at the next stable checkpoint.
+func (e *Engine) adoptView(view uint64) {
+	e.adopted = view
+	e.view = view
+	e.changing = false
+	e.target = view
+	e.assigned = make(map[string]bool)
+	if e.lastExec > e.seq {
+		e.seq = e.lastExec
+	}
+	if e.low > e.seq {
+		e.seq = e.low
+	}
+	for v := range e.viewChanges {
+		if v <= view {
+			delete(e.viewChanges, v)
+		}
+	}
+	e.persist()
+	e.resume()
+}
+
+// resume restarts the timers of the pending requests in a new view, hands
+// them to its primary, and handles the messages buffered for the view.
+func (e *Engine) resume() {
+	// Give the new primary a full timeout for everything still pending.
+	now := time.Now()
+	ids := []string{}
+	for id, p := range e.pending {
+		p.since = now
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	// The new primary may not know every pending request, e.g. those a
+	// faulty primary pre-prepared to a single validator.
+	primary := e.primary(e.view)
+	for _, id := range ids {
+		if primary == e.id.Name {
+			e.assign(e.pending[id].request)
+			continue
+		}
+		r := &Message{Type: RequestMsg, View: e.view, Request: e.pending[id].request}
+		r.sign(e.id)
+		e.config.Transport.Send(primary, r)
+	}
+	future := e.future
+	e.future = nil
+	for _, m := range future {
+		switch {
+		case m.View > e.view:
+			e.future = append(e.future, m)
+		case m.View == e.view && m.Type == PrePrepareMsg:
+			e.onPrePrepare(m)
+		case m.View == e.view && m.Type == PrepareMsg:
+			e.onPrepare(m)
+		case m.View == e.view && m.Type == CommitMsg:
+			e.onCommit(m)
+		}
+	}
+}
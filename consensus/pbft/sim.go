@@ -0,0 +1,137 @@
+package pbft
+
+import (
+	"fmt"
+	"github.com/RedactableBlockChain/identity"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Behaviours of a simulated validator.
+const (
+	Honest = iota
+	// Sends nothing.
+	Crashed
+	// As primary, pre-prepares a different request, submitted by itself,
+	// for every other validator.
+	Equivocating
+	// Signs its messages with a key other than its own.
+	Forging
+)
+
+// Network connects engines in one process, for testing the protocol
+// against faulty validators. Messages are delivered asynchronously after
+// a random delay of up to Delay.
+type Network struct {
+	mutex      sync.Mutex
+	engines    map[string]*Engine
+	identities map[string]*identity.Identity
+	faults     map[string]int
+	Delay      time.Duration
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		engines:    make(map[string]*Engine),
+		identities: make(map[string]*identity.Identity),
+		faults:     make(map[string]int),
+	}
+}
+
+// SetFault changes the behaviour of a validator.
+func (n *Network) SetFault(name string, fault int) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.faults[name] = fault
+}
+
+func (n *Network) add(e *Engine, id *identity.Identity) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.engines[id.Name] = e
+	n.identities[id.Name] = id
+}
+
+// Transport returns the transport for the named validator.
+func (n *Network) Transport(from string) Transport {
+	return &simTransport{network: n, from: from}
+}
+
+type simTransport struct {
+	network *Network
+	from    string
+}
+
+func (t *simTransport) Send(to string, m *Message) {
+	n := t.network
+	n.mutex.Lock()
+	fault, target, id := n.faults[t.from], n.engines[to], n.identities[t.from]
+	delay := time.Duration(0)
+	if n.Delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(n.Delay)))
+	}
+	n.mutex.Unlock()
+	if target == nil {
+		return
+	}
+	c := *m
+	switch fault {
+	case Crashed:
+		return
+	case Equivocating:
+		if c.Type == PrePrepareMsg && c.Request != nil {
+			req := *c.Request
+			req.ID = fmt.Sprintf("%s-for-%s", req.ID, to)
+			req.sign(id)
+			c.Request = &req
+			c.Digest = req.Digest()
+			c.sign(id)
+		}
+	case Forging:
+		forged, _ := identity.Generate(t.from)
+		c.sign(forged)
+	}
+	go func() {
+		time.Sleep(delay)
+		target.Deliver(&c)
+	}()
+}
+
+// Cluster starts n engines on a new network with the timeouts and
+// checkpoint interval of config. A config Path is the parent of the
+// validators' dirs. state returns the state machine of the i-th validator.
+func Cluster(size int, config Config, state func(i int) interface{}) (*Network, []*Engine, error) {
+	network := NewNetwork()
+	ids := make([]*identity.Identity, size)
+	validators := make([]Validator, size)
+	for i := range ids {
+		id, err := identity.Generate(fmt.Sprintf("node%d", i))
+		if err != nil {
+			return nil, nil, err
+		}
+		ids[i] = id
+		validators[i] = Validator{Name: id.Name, Address: "sim://" + id.Name, PublicKey: id.PublicKey}
+	}
+	engines := make([]*Engine, size)
+	for i, id := range ids {
+		c := config
+		c.Identity = id
+		c.Validators = validators
+		c.Transport = network.Transport(id.Name)
+		if config.Path != "" {
+			c.Path = filepath.Join(config.Path, id.Name)
+		}
+		e, err := New(c, state(i))
+		if err != nil {
+			return nil, nil, err
+		}
+		network.add(e, id)
+		engines[i] = e
+		if err = e.Start(""); err != nil {
+			return nil, nil, err
+		}
+	}
+	return network, engines, nil
+}
@@ -0,0 +1,332 @@
+package pbft
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/raft"
+	"github.com/RedactableBlockChain/store"
+)
+
+func init() {
+	consensus.RegisterCommand(&appendCommand{})
+	consensus.RegisterCommand(&raft.PackCommand{})
+	consensus.RegisterCommand(&raft.ModifyCommand{})
+}
+
+// A state machine which records the values of the commands it executed.
+type values struct {
+	mutex sync.Mutex
+	list  []int
+}
+
+func (v *values) get() []int {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return append([]int(nil), v.list...)
+}
+
+func (v *values) Save() ([]byte, error) {
+	return json.Marshal(v.get())
+}
+
+func (v *values) Recovery(b []byte) error {
+	list := []int{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.list = list
+	return nil
+}
+
+type appendCommand struct {
+	Value int `json:"value"`
+}
+
+func (c *appendCommand) CommandName() string {
+	return "pbft-test:append"
+}
+
+func (c *appendCommand) Execute(state interface{}) (interface{}, error) {
+	v := state.(*values)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.list = append(v.list, c.Value)
+	return nil, nil
+}
+
+var testConfig = Config{
+	ViewTimeout:        200 * time.Millisecond,
+	ProposeTimeout:     10 * time.Second,
+	CheckpointInterval: 4,
+}
+
+func cluster(t *testing.T, config Config) (*Network, []*Engine, []*values) {
+	t.Helper()
+	states := make([]*values, 4)
+	network, engines, err := Cluster(4, config, func(i int) interface{} {
+		states[i] = &values{}
+		return states[i]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, e := range engines {
+			e.Stop()
+		}
+	})
+	return network, engines, states
+}
+
+func propose(t *testing.T, e *Engine, from, to int) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		if _, err := e.Propose(&appendCommand{i}); err != nil {
+			t.Fatalf("propose %d: %v", i, err)
+		}
+	}
+}
+
+// waitFor waits until every state in states executed want.
+func waitFor(t *testing.T, want []int, states ...*values) {
+	t.Helper()
+	waitUntil(t, func(list []int) bool { return reflect.DeepEqual(list, want) }, states...)
+}
+
+func waitUntil(t *testing.T, done func([]int) bool, states ...*values) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for _, s := range states {
+		for !done(s.get()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("state %v", s.get())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// Drops repeated values, which an equivocating primary may add by
+// submitting copies of requests itself.
+func distinct(list []int) []int {
+	seen := make(map[int]bool)
+	out := []int{}
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func sequence(n int) []int {
+	list := make([]int, n)
+	for i := range list {
+		list[i] = i + 1
+	}
+	return list
+}
+
+// The honest validators execute the same commands in the same order with
+// a faulty primary, and drop the log below their stable checkpoints.
+func TestFaultyPrimary(t *testing.T) {
+	for _, fault := range []int{Crashed, Equivocating, Forging} {
+		t.Run(fmt.Sprint(fault), func(t *testing.T) {
+			network, engines, states := cluster(t, testConfig)
+			network.SetFault("node0", fault)
+			propose(t, engines[1], 1, 10)
+			waitUntil(t, func(list []int) bool { return reflect.DeepEqual(distinct(list), sequence(10)) }, states[1:]...)
+			for _, s := range states[2:] {
+				waitUntil(t, func(list []int) bool { return reflect.DeepEqual(list, states[1].get()) }, s)
+			}
+			if fault != Equivocating && !reflect.DeepEqual(states[1].get(), sequence(10)) {
+				t.Fatalf("state %v", states[1].get())
+			}
+			for _, e := range engines[1:] {
+				e.mutex.Lock()
+				low, entries, executed, view := e.low, len(e.log), len(e.executed), e.view
+				e.mutex.Unlock()
+				if view == 0 {
+					t.Fatalf("%s still in view 0", e.Name())
+				}
+				if low < 8 || uint64(entries) > e.window() || uint64(executed) > e.window() {
+					t.Fatalf("%s: low %d, %d log entries, %d executed", e.Name(), low, entries, executed)
+				}
+			}
+		})
+	}
+}
+
+// A primary cannot make validators allocate sequence numbers beyond the
+// high watermark, neither directly nor through a view change.
+func TestWatermarks(t *testing.T) {
+	network, engines, _ := cluster(t, testConfig)
+	primary := network.identities["node0"]
+	req := &Request{ID: "far"}
+	m := &Message{Type: PrePrepareMsg, Seq: 1 << 60, Digest: req.Digest(), Request: req}
+	m.sign(primary)
+	engines[1].Deliver(m)
+	engines[1].mutex.Lock()
+	entries := len(engines[1].log)
+	engines[1].mutex.Unlock()
+	if entries != 0 {
+		t.Fatalf("pre-prepare beyond the window accepted: %d entries", entries)
+	}
+
+	proof := Proof{PrePrepare: *m}
+	for _, name := range []string{"node1", "node2"} {
+		p := &Message{Type: PrepareMsg, Seq: m.Seq, Digest: m.Digest}
+		p.sign(network.identities[name])
+		proof.Prepares = append(proof.Prepares, *p)
+	}
+	vc := &Message{Type: ViewChangeMsg, View: 1, Prepared: []Proof{proof}}
+	vc.sign(primary)
+	if engines[1].validViewChange(vc, 1) {
+		t.Fatal("view-change beyond the window accepted")
+	}
+	vc = &Message{Type: ViewChangeMsg, View: 1, Seq: 1 << 60}
+	vc.sign(primary)
+	if engines[1].validViewChange(vc, 1) {
+		t.Fatal("view-change with an unproven checkpoint accepted")
+	}
+}
+
+// A restarted validator continues after the last sequence number it
+// executed.
+func TestRestart(t *testing.T) {
+	config := testConfig
+	config.Path = t.TempDir()
+	network, engines, states := cluster(t, config)
+	propose(t, engines[0], 1, 6)
+	waitFor(t, sequence(6), states...)
+
+	old := engines[3]
+	old.Stop()
+	c := old.config
+	c.Transport = network.Transport(old.Name())
+	restarted, err := New(c, states[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.lastExec != 6 || restarted.low != 4 || restarted.lowState == nil {
+		t.Fatalf("restarted at %d, low %d", restarted.lastExec, restarted.low)
+	}
+	network.add(restarted, old.id)
+	engines[3] = restarted
+	if err = restarted.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	propose(t, engines[0], 7, 8)
+	waitFor(t, sequence(8), states...)
+}
+
+// A validator which missed more than the log window catches up through
+// state transfer.
+func TestStateTransfer(t *testing.T) {
+	_, engines, states := cluster(t, testConfig)
+	engines[3].Stop()
+	propose(t, engines[0], 1, 12)
+	if got := states[3].get(); len(got) != 0 {
+		t.Fatalf("stopped validator executed %v", got)
+	}
+	if err := engines[3].Start(""); err != nil {
+		t.Fatal(err)
+	}
+	propose(t, engines[0], 13, 20)
+	waitFor(t, sequence(20), states...)
+}
+
+// chain returns a node on the genesis of test/node1 with an in-memory
+// store, whose commands the validators execute.
+func chain(t *testing.T) (*raft.Server, store.Store) {
+	t.Helper()
+	para, err := store.LoadParameter("../../test/node1/storage/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	para.CurHeight = 0
+	st := store.NewMemStore()
+	if err = st.PutParameter(para); err != nil {
+		t.Fatal(err)
+	}
+	genesis := data.NewBasicBlock([][]byte{para.P, para.Q, para.G})
+	if err = genesis.Finalize(0, 0, []byte("")); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutBlock(genesis); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := mempool.New(st, mempool.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raft.New(t.TempDir(), "localhost", 0, raft.BlockPolicy{MaxTxs: 10, Interval: 1000}, st, pool), st
+}
+
+// A faulty validator which submits a malformed block and redactions of
+// missing txs gets errors, the honest validators keep ordering commands.
+func TestMalformedBlock(t *testing.T) {
+	stores := make([]store.Store, 4)
+	network, engines, err := Cluster(4, testConfig, func(i int) interface{} {
+		s, st := chain(t)
+		stores[i] = st
+		return s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, e := range engines {
+			e.Stop()
+		}
+	})
+	network.Delay = 5 * time.Millisecond
+
+	genesis, err := stores[0].GetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := data.BasicBlock{HeadB: data.BasicHead{
+		Height:             1,
+		TxCount:            3,
+		PreviousRoot:       genesis.HeadB.HashRoot,
+		ChameleonParameter: genesis.HeadB.ChameleonParameter,
+	}}
+	faulty := engines[3]
+	if _, err = faulty.Propose(raft.NewPackCommand(block)); err == nil {
+		t.Fatal("block counting transactions it lacks committed")
+	}
+	for _, txId := range []int{-1, 1} {
+		if _, err = faulty.Propose(raft.NewModifyCommand(0, txId, data.BasicTx{}, genesis.HeadB.ChameleonParameter, 0)); err == nil {
+			t.Fatalf("redaction of tx %d committed", txId)
+		}
+	}
+	if err = engines[1].Barrier(); err != nil {
+		t.Fatal(err)
+	}
+	for i, st := range stores {
+		if top, err := st.Height(); err != nil || top != 0 {
+			t.Fatalf("validator %d at height %d: %v", i, top, err)
+		}
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	e := &Engine{}
+	for members, want := range map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 4, 6: 4, 7: 5, 10: 7} {
+		if got := e.Quorum(members); got != want {
+			t.Errorf("quorum of %d members %d, want %d", members, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package pbft
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/RedactableBlockChain/logging"
+	"net/http"
+	"time"
+)
+
+// Transport sends a message to the named validator. Send must not block on
+// the network; delivery is best effort, the protocol tolerates lost
+// messages through view changes.
+type Transport interface {
+	Send(to string, m *Message)
+}
+
+// HTTPTransport posts messages as JSON to /pbft of each validator's
+// address.
+type HTTPTransport struct {
+	addresses map[string]string
+	client    *http.Client
+}
+
+func NewHTTPTransport(validators []Validator) *HTTPTransport {
+	t := &HTTPTransport{
+		addresses: make(map[string]string),
+		client:    &http.Client{Timeout: 2 * time.Second},
+	}
+	for _, v := range validators {
+		t.addresses[v.Name] = v.Address
+	}
+	return t
+}
+
+func (t *HTTPTransport) Send(to string, m *Message) {
+	address, ok := t.addresses[to]
+	if !ok {
+		return
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	go func() {
+		resp, err := t.client.Post(address+"/pbft", "application/json", bytes.NewReader(raw))
+		if err != nil {
+			logging.Debug("pbft send failed", "to", to, "type", m.Type, "err", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// Handler receives the messages of other validators for e.
+func Handler(e *Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		m := &Message{}
+		if err := json.NewDecoder(req.Body).Decode(m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.Deliver(m)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
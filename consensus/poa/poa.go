@@ -0,0 +1,638 @@
+// Package poa is a proof-of-authority engine for small deployments: a fixed
+// set of signers takes turns sealing blocks by height modulo the set.
+//
+// The signer in turn to seal the next height orders every write: it is the
+// leader the other signers forward to, executes each command and numbers
+// it. Every signer keeps the commands it applied and sends them, signed by
+// the signer which ordered them, to the other signers until they confirm
+// them, retrying forever; they apply them strictly by number and only from
+// the signer in turn at that point, so all signers apply the same commands
+// in the same order. Sealing a block passes the turn on. A signer which is
+// too far behind for the commands kept gets the state of a peer instead,
+// and syncs the blocks it lacks by height, see StateMachine.
+//
+// There is no agreement protocol beyond the turn: a signer which is down
+// stalls the chain while it is in turn.
+package poa
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/identity"
+	"github.com/RedactableBlockChain/logging"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// Sending to an unreachable signer is retried after backoff, doubling
+	// up to maxBackoff.
+	backoff    = 200 * time.Millisecond
+	maxBackoff = 5 * time.Second
+	// An idle sender asks its peer where it is this often, which finds
+	// peers that restarted behind.
+	heartbeat = time.Second
+	// Commands kept for signers which did not confirm them yet; a signer
+	// further behind gets the state instead.
+	maxLog = 4096
+	// Commands sent in one request, and received ahead of the next one
+	// to apply.
+	maxBatch = 64
+	maxAhead = 4096
+)
+
+var ErrFixedSigners = errors.New("poa: the signer set is fixed")
+
+// A member of the fixed signer set.
+type Signer struct {
+	Name      string            `json:"name"`
+	Address   string            `json:"address"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+}
+
+// Reads a JSON list of signers.
+func LoadSigners(path string) ([]Signer, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signers := []Signer{}
+	if err = json.Unmarshal(raw, &signers); err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("poa: empty signer set")
+	}
+	seen := make(map[string]bool)
+	for _, s := range signers {
+		if seen[s.Name] {
+			return nil, fmt.Errorf("poa: duplicate signer %s", s.Name)
+		}
+		if len(s.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("poa: signer %s has an invalid public key", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return signers, nil
+}
+
+// Chain is the state a poa engine orders commands for; the height tells
+// which signer is in turn. The state must also be a
+// consensus.StateMachine.
+type Chain interface {
+	Height() (int, error)
+}
+
+// A command as sent between signers, or the state of the sender.
+type Envelope struct {
+	// Number of the command in the order of the signer set, or the last
+	// command the state includes.
+	Index   uint64          `json:"index"`
+	Command string          `json:"command,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	// The state of the sender, sent for commands it no longer keeps.
+	State []byte `json:"state,omitempty"`
+	// The signer which ordered the command, or which sent the state.
+	From      string `json:"from"`
+	Signature []byte `json:"signature"`
+}
+
+func (m *Envelope) signedBytes() []byte {
+	c := *m
+	c.Signature = nil
+	raw, _ := json.Marshal(&c)
+	return raw
+}
+
+// The reply to a batch of envelopes: the last command the receiver applied.
+type Ack struct {
+	Index uint64 `json:"index"`
+}
+
+type Engine struct {
+	mutex   sync.Mutex
+	id      *identity.Identity
+	signers []Signer
+	keys    map[string]ed25519.PublicKey
+	state   interface{}
+	chain   Chain
+	path    string
+	subs    consensus.Subscribers
+	// The last command applied, the commands applied up to it which are
+	// kept for the peers, and the commands received ahead of it.
+	index uint64
+	log   []*Envelope
+	ahead map[uint64]*Envelope
+	// The last command each peer reported since Start.
+	acked      map[string]uint64
+	running    bool
+	installing bool
+	stop       chan struct{}
+	// wakes the sender of each peer on new commands
+	wake   map[string]chan struct{}
+	client *http.Client
+	// Commands applied but not yet passed to the subscribers, see
+	// consensus.Local.
+	committed []consensus.Committed
+	notifying bool
+}
+
+// New creates the engine of signer id. It keeps its progress under path,
+// nowhere if path is empty.
+func New(id *identity.Identity, signers []Signer, path string, state interface{}) (*Engine, error) {
+	chain, ok := state.(Chain)
+	if _, saves := state.(consensus.StateMachine); !ok || !saves {
+		return nil, errors.New("poa: the state must report its height and save itself")
+	}
+	e := &Engine{
+		id:      id,
+		signers: signers,
+		keys:    make(map[string]ed25519.PublicKey),
+		state:   state,
+		chain:   chain,
+		path:    path,
+		ahead:   make(map[uint64]*Envelope),
+		acked:   make(map[string]uint64),
+		wake:    make(map[string]chan struct{}),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+	for _, s := range signers {
+		e.keys[s.Name] = s.PublicKey
+	}
+	if key, ok := e.keys[id.Name]; !ok || !bytes.Equal(key, id.PublicKey) {
+		return nil, fmt.Errorf("poa: %s is not a signer with this identity", id.Name)
+	}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Sealer returns the signer in turn to seal height.
+func (e *Engine) Sealer(height int) (string, ed25519.PublicKey) {
+	s := e.signers[height%len(e.signers)]
+	return s.Name, s.PublicKey
+}
+
+// turn returns the signer in turn to seal the next block, which orders the
+// commands until it did.
+func (e *Engine) turn() (Signer, error) {
+	top, err := e.chain.Height()
+	if err != nil {
+		return Signer{}, err
+	}
+	return e.signers[(top+1)%len(e.signers)], nil
+}
+
+func (e *Engine) Start(join string) error {
+	if join != "" {
+		return ErrFixedSigners
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.running {
+		return nil
+	}
+	e.running = true
+	e.stop = make(chan struct{})
+	e.acked = make(map[string]uint64)
+	for _, s := range e.signers {
+		if s.Name == e.id.Name {
+			continue
+		}
+		e.wake[s.Name] = make(chan struct{}, 1)
+		go e.send(s, e.wake[s.Name], e.stop)
+	}
+	logging.Info("poa started", "name", e.id.Name, "signers", len(e.signers), "index", e.index)
+	return nil
+}
+
+func (e *Engine) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.running {
+		return
+	}
+	e.running = false
+	close(e.stop)
+}
+
+// ordering reports whether e may order commands: it is in turn, and no
+// peer it heard from since Start applied more, so it does not reuse their
+// numbers after a restart. It needs to hear from a peer first unless it
+// is the only signer.
+func (e *Engine) ordering() bool {
+	if !e.running || e.installing {
+		return false
+	}
+	if s, err := e.turn(); err != nil || s.Name != e.id.Name {
+		return false
+	}
+	if len(e.signers) > 1 && len(e.acked) == 0 {
+		return false
+	}
+	for _, index := range e.acked {
+		if index > e.index {
+			return false
+		}
+	}
+	return true
+}
+
+// send delivers the commands to one peer in order, resuming from where the
+// peer reports to be, until Stop. Failed requests are retried forever.
+func (e *Engine) send(to Signer, wake chan struct{}, stop chan struct{}) {
+	// 0 asks the peer where it is
+	next := uint64(0)
+	delay := backoff
+	for {
+		e.mutex.Lock()
+		if next > e.index {
+			e.mutex.Unlock()
+			select {
+			case <-stop:
+				return
+			case <-wake:
+			case <-time.After(heartbeat):
+				next = 0
+			}
+			continue
+		}
+		batch, err := e.batch(next)
+		e.mutex.Unlock()
+		var ack *Ack
+		if err == nil {
+			ack, err = e.post(to.Address, batch)
+		}
+		if err != nil {
+			logging.Debug("poa send failed", "to", to.Name, "index", next, "err", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxBackoff {
+				delay = maxBackoff
+			}
+			next = 0
+			continue
+		}
+		delay = backoff
+		e.mutex.Lock()
+		e.acked[to.Name] = ack.Index
+		e.trim()
+		e.mutex.Unlock()
+		next = ack.Index + 1
+	}
+}
+
+// batch returns the commands from next on, or the state if they are no
+// longer kept. Called with the mutex held.
+func (e *Engine) batch(next uint64) ([]*Envelope, error) {
+	if next == 0 {
+		return []*Envelope{}, nil
+	}
+	first := e.index - uint64(len(e.log)) + 1
+	if next >= first {
+		end := len(e.log)
+		if end-int(next-first) > maxBatch {
+			end = int(next-first) + maxBatch
+		}
+		return e.log[next-first : end], nil
+	}
+	state, err := e.state.(consensus.StateMachine).Save()
+	if err != nil {
+		return nil, err
+	}
+	m := &Envelope{Index: e.index, State: state, From: e.id.Name}
+	m.Signature = e.id.Sign(m.signedBytes())
+	return []*Envelope{m}, nil
+}
+
+// trim drops the commands every peer applied, and the oldest beyond
+// maxLog. Called with the mutex held.
+func (e *Engine) trim() {
+	keep := uint64(0)
+	for _, s := range e.signers {
+		index := e.acked[s.Name]
+		if s.Name != e.id.Name && index < e.index && e.index-index > keep {
+			keep = e.index - index
+		}
+	}
+	if keep > maxLog {
+		keep = maxLog
+	}
+	if keep < uint64(len(e.log)) {
+		e.log = append([]*Envelope(nil), e.log[uint64(len(e.log))-keep:]...)
+	}
+}
+
+func (e *Engine) post(address string, batch []*Envelope) (*Ack, error) {
+	raw, _ := json.Marshal(batch)
+	resp, err := e.client.Post(address+"/poa", "application/json", bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New(string(res))
+	}
+	ack := &Ack{}
+	if err = json.NewDecoder(resp.Body).Decode(ack); err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+// Propose executes cmd if e is in turn and sends it to the other signers
+// once it succeeded. Other signers return consensus.ErrNotLeader.
+func (e *Engine) Propose(cmd consensus.Command) (interface{}, error) {
+	name, data, err := consensus.EncodeCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	e.mutex.Lock()
+	if !e.running {
+		e.mutex.Unlock()
+		return nil, consensus.ErrStopped
+	}
+	if !e.ordering() {
+		e.mutex.Unlock()
+		return nil, consensus.ErrNotLeader
+	}
+	res, err := cmd.Execute(e.state)
+	if err == nil {
+		m := &Envelope{Index: e.index + 1, Command: name, Data: data, From: e.id.Name}
+		m.Signature = e.id.Sign(m.signedBytes())
+		e.append(m)
+		if perr := e.persist(); perr != nil {
+			logging.Warn("poa progress not saved", "index", e.index, "err", perr)
+		}
+	}
+	e.committed = append(e.committed, consensus.Committed{Index: e.index, Command: cmd, Result: res, Err: err})
+	e.mutex.Unlock()
+	e.notify()
+	return res, err
+}
+
+// append records m as applied and wakes the senders. Called with the mutex
+// held.
+func (e *Engine) append(m *Envelope) {
+	e.index = m.Index
+	e.log = append(e.log, m)
+	e.trim()
+	for _, wake := range e.wake {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Deliver applies a batch of commands from another signer and returns the
+// last command applied.
+func (e *Engine) Deliver(batch []*Envelope) (uint64, error) {
+	for _, m := range batch {
+		key, ok := e.keys[m.From]
+		if !ok || !identity.Verify(key, m.signedBytes(), m.Signature) {
+			return 0, errors.New("poa: command not signed by a signer")
+		}
+	}
+	e.mutex.Lock()
+	if !e.running {
+		e.mutex.Unlock()
+		return 0, consensus.ErrStopped
+	}
+	var err error
+	for _, m := range batch {
+		if m.State != nil {
+			err = e.install(m)
+		} else if m.Index > e.index && len(e.ahead) < maxAhead {
+			e.ahead[m.Index] = m
+		}
+	}
+	e.apply()
+	if perr := e.persist(); err == nil {
+		err = perr
+	}
+	index := e.index
+	e.mutex.Unlock()
+	e.notify()
+	return index, err
+}
+
+// apply executes the commands received in order. A command not ordered by
+// the signer in turn is dropped; one which fails still takes its number,
+// as it did on the signer which ordered it. Nothing is applied while a
+// state is installed. Called with the mutex held.
+func (e *Engine) apply() {
+	for !e.installing {
+		m, ok := e.ahead[e.index+1]
+		if !ok {
+			break
+		}
+		delete(e.ahead, m.Index)
+		if s, err := e.turn(); err != nil || s.Name != m.From {
+			logging.Warn("poa command out of turn", "from", m.From, "index", m.Index, "turn", s.Name, "err", err)
+			continue
+		}
+		cmd, err := consensus.DecodeCommand(m.Command, m.Data)
+		if err != nil {
+			logging.Warn("poa command undecodable", "from", m.From, "index", m.Index, "err", err)
+			continue
+		}
+		res, err := cmd.Execute(e.state)
+		if err != nil {
+			logging.Warn("poa command failed", "from", m.From, "index", m.Index, "command", m.Command, "err", err)
+		}
+		e.append(m)
+		e.committed = append(e.committed, consensus.Committed{Index: m.Index, Command: cmd, Result: res, Err: err})
+	}
+	for index := range e.ahead {
+		if index <= e.index {
+			delete(e.ahead, index)
+		}
+	}
+}
+
+// install recovers the state of a peer which is ahead of e. The state
+// machine may call back into the engine, so it runs without the mutex.
+// Called with the mutex held.
+func (e *Engine) install(m *Envelope) error {
+	if m.Index <= e.index || e.installing {
+		return nil
+	}
+	e.installing = true
+	e.mutex.Unlock()
+	err := e.state.(consensus.StateMachine).Recovery(m.State)
+	e.mutex.Lock()
+	e.installing = false
+	if err != nil {
+		return fmt.Errorf("poa: install state of %s: %v", m.From, err)
+	}
+	logging.Info("poa installed state", "from", m.From, "index", m.Index)
+	e.index = m.Index
+	e.log = nil
+	return nil
+}
+
+// notify passes the committed commands to the subscribers, see
+// consensus.Local.
+func (e *Engine) notify() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.notifying {
+		return
+	}
+	e.notifying = true
+	for len(e.committed) > 0 {
+		c := e.committed[0]
+		e.committed = e.committed[1:]
+		e.mutex.Unlock()
+		e.subs.Notify(c)
+		e.mutex.Lock()
+	}
+	e.notifying = false
+}
+
+// The progress of a signer, kept so that it resumes at the right number
+// with its persistent state.
+type progress struct {
+	Index uint64 `json:"index"`
+}
+
+func (e *Engine) load() error {
+	if e.path == "" {
+		return nil
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(e.path, "progress.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p := &progress{}
+	if err = json.Unmarshal(raw, p); err != nil {
+		return err
+	}
+	e.index = p.Index
+	return nil
+}
+
+// persist saves the progress. Called with the mutex held.
+func (e *Engine) persist() error {
+	if e.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(e.path, 0744); err != nil {
+		return err
+	}
+	raw, _ := json.Marshal(&progress{Index: e.index})
+	tmp := filepath.Join(e.path, "progress.json.tmp")
+	if err := ioutil.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(e.path, "progress.json"))
+}
+
+func (e *Engine) Subscribe(fn func(consensus.Committed)) {
+	e.subs.Add(fn)
+}
+
+// The signer in turn changes with every block, so there is no leader a
+// read could confirm it still leads with.
+func (e *Engine) Barrier() error {
+	return consensus.ErrUnsupported
+}
+
+func (e *Engine) Name() string {
+	return e.id.Name
+}
+
+// The signer which orders commands, see ordering.
+func (e *Engine) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.ordering()
+}
+
+// The signer in turn.
+func (e *Engine) Leader() consensus.Member {
+	e.mutex.Lock()
+	running := e.running
+	e.mutex.Unlock()
+	s, err := e.turn()
+	if !running || err != nil {
+		return consensus.Member{}
+	}
+	return consensus.Member{Name: s.Name, ConnectionString: s.Address}
+}
+
+func (e *Engine) Members() []consensus.Member {
+	members := make([]consensus.Member, 0, len(e.signers))
+	for _, s := range e.signers {
+		members = append(members, consensus.Member{Name: s.Name, ConnectionString: s.Address})
+	}
+	return members
+}
+
+func (e *Engine) Status() consensus.Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	status := consensus.Status{Name: e.id.Name, State: consensus.Stopped, CommitIndex: e.index, AppliedIndex: e.index}
+	if !e.running {
+		return status
+	}
+	status.State = consensus.Follower
+	if e.ordering() {
+		status.State = consensus.Leader
+	}
+	if s, err := e.turn(); err == nil {
+		status.Leader = s.Name
+	}
+	return status
+}
+
+func (e *Engine) AddMember(m consensus.Member) error {
+	return ErrFixedSigners
+}
+
+func (e *Engine) RemoveMember(name string) error {
+	return ErrFixedSigners
+}
+
+// The commands are kept until the peers applied them, there is no log to
+// compact.
+func (e *Engine) Snapshot() error {
+	return nil
+}
+
+// Handler receives the commands of other signers for e and replies with an
+// Ack.
+func Handler(e *Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		batch := []*Envelope{}
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		index, err := e.Deliver(batch)
+		if err != nil {
+			logging.Debug("poa commands rejected", "commands", len(batch), "err", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&Ack{Index: index})
+	}
+}
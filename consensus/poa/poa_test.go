@@ -0,0 +1,242 @@
+package poa
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/identity"
+)
+
+func init() {
+	consensus.RegisterCommand(&appendCommand{})
+	consensus.RegisterCommand(&sealCommand{})
+}
+
+// A chain which records the values of the commands it executed.
+type chain struct {
+	mutex  sync.Mutex
+	height int
+	list   []int
+}
+
+type chainState struct {
+	Height int   `json:"height"`
+	List   []int `json:"list"`
+}
+
+func (c *chain) get() chainState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return chainState{c.height, append([]int{}, c.list...)}
+}
+
+func (c *chain) Height() (int, error) {
+	return c.get().Height, nil
+}
+
+func (c *chain) Save() ([]byte, error) {
+	return json.Marshal(c.get())
+}
+
+func (c *chain) Recovery(b []byte) error {
+	s := chainState{}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.height, c.list = s.Height, s.List
+	return nil
+}
+
+type appendCommand struct {
+	Value int `json:"value"`
+}
+
+func (c *appendCommand) CommandName() string {
+	return "poa-test:append"
+}
+
+func (c *appendCommand) Execute(state interface{}) (interface{}, error) {
+	s := state.(*chain)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.list = append(s.list, c.Value)
+	return nil, nil
+}
+
+// Stands for a block, which passes the turn on.
+type sealCommand struct{}
+
+func (c *sealCommand) CommandName() string {
+	return "poa-test:seal"
+}
+
+func (c *sealCommand) Execute(state interface{}) (interface{}, error) {
+	s := state.(*chain)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.height++
+	return nil, nil
+}
+
+// A signer set served over HTTP, whose engines may be replaced.
+type testCluster struct {
+	mutex   sync.Mutex
+	ids     []*identity.Identity
+	signers []Signer
+	engines []*Engine
+	states  []*chain
+}
+
+func newCluster(t *testing.T, size int) *testCluster {
+	t.Helper()
+	c := &testCluster{engines: make([]*Engine, size), states: make([]*chain, size)}
+	for i := 0; i < size; i++ {
+		id, err := identity.Generate(fmt.Sprintf("s%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			Handler(c.engine(i))(w, req)
+		}))
+		t.Cleanup(server.Close)
+		c.ids = append(c.ids, id)
+		c.signers = append(c.signers, Signer{Name: id.Name, Address: server.URL, PublicKey: id.PublicKey})
+	}
+	for i := 0; i < size; i++ {
+		c.replace(t, i, &chain{})
+	}
+	t.Cleanup(func() {
+		for i := range c.engines {
+			c.engine(i).Stop()
+		}
+	})
+	return c
+}
+
+func (c *testCluster) engine(i int) *Engine {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.engines[i]
+}
+
+// replace starts a new engine for signer i on state.
+func (c *testCluster) replace(t *testing.T, i int, state *chain) *Engine {
+	t.Helper()
+	e, err := New(c.ids[i], c.signers, "", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mutex.Lock()
+	if old := c.engines[i]; old != nil {
+		old.Stop()
+	}
+	c.engines[i], c.states[i] = e, state
+	c.mutex.Unlock()
+	if err = e.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// propose proposes cmds on signer i once it orders commands.
+func (c *testCluster) propose(t *testing.T, i int, cmds ...consensus.Command) {
+	t.Helper()
+	e := c.engine(i)
+	waitUntil(t, e.IsLeader)
+	for _, cmd := range cmds {
+		if _, err := e.Propose(cmd); err != nil {
+			t.Fatalf("propose on %s: %v", e.Name(), err)
+		}
+	}
+}
+
+func (c *testCluster) waitFor(t *testing.T, want chainState, signers ...int) {
+	t.Helper()
+	for _, i := range signers {
+		state := c.states[i]
+		waitUntil(t, func() bool { return reflect.DeepEqual(state.get(), want) })
+	}
+}
+
+func waitUntil(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Only the signer in turn orders commands, and every signer applies them
+// in its order.
+func TestOrder(t *testing.T) {
+	c := newCluster(t, 3)
+	// height 0: s1 seals the next block
+	waitUntil(t, c.engine(1).IsLeader)
+	if _, err := c.engine(0).Propose(&appendCommand{1}); err != consensus.ErrNotLeader {
+		t.Fatalf("propose out of turn: %v", err)
+	}
+	if leader := c.engine(0).Leader(); leader.Name != "s1" || leader.ConnectionString != c.signers[1].Address {
+		t.Fatalf("leader %+v", leader)
+	}
+	c.propose(t, 1, &appendCommand{1}, &appendCommand{2}, &sealCommand{})
+	if _, err := c.engine(1).Propose(&appendCommand{3}); err != consensus.ErrNotLeader {
+		t.Fatalf("propose after the turn passed: %v", err)
+	}
+	c.propose(t, 2, &appendCommand{3}, &sealCommand{})
+	c.propose(t, 0, &appendCommand{4})
+	c.waitFor(t, chainState{2, []int{1, 2, 3, 4}}, 0, 1, 2)
+	if status := c.engine(2).Status(); status.AppliedIndex != 6 || status.Leader != "s0" {
+		t.Fatalf("status %+v", status)
+	}
+}
+
+// Commands ordered while a signer is down reach it once it is back.
+func TestCatchUp(t *testing.T) {
+	c := newCluster(t, 3)
+	c.engine(0).Stop()
+	c.propose(t, 1, &appendCommand{1}, &sealCommand{})
+	c.propose(t, 2, &appendCommand{2})
+	c.waitFor(t, chainState{1, []int{1, 2}}, 1, 2)
+	if got := c.states[0].get(); got.Height != 0 || len(got.List) != 0 {
+		t.Fatalf("stopped signer applied %+v", got)
+	}
+	if err := c.engine(0).Start(""); err != nil {
+		t.Fatal(err)
+	}
+	c.waitFor(t, chainState{1, []int{1, 2}}, 0)
+}
+
+// A signer which lost its state gets the state of a peer once the others
+// dropped the commands it lacks, and then takes its turn.
+func TestStateTransfer(t *testing.T) {
+	c := newCluster(t, 3)
+	c.propose(t, 1, &appendCommand{1}, &sealCommand{})
+	c.propose(t, 2, &appendCommand{2}, &sealCommand{})
+	c.waitFor(t, chainState{2, []int{1, 2}}, 0, 1, 2)
+	for _, i := range []int{1, 2} {
+		e := c.engine(i)
+		waitUntil(t, func() bool {
+			e.mutex.Lock()
+			defer e.mutex.Unlock()
+			return len(e.log) == 0
+		})
+	}
+
+	c.replace(t, 0, &chain{})
+	c.waitFor(t, chainState{2, []int{1, 2}}, 0)
+	c.propose(t, 0, &appendCommand{3})
+	c.waitFor(t, chainState{2, []int{1, 2, 3}}, 0, 1, 2)
+}
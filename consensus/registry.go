@@ -0,0 +1,45 @@
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/goraft/raft"
+	"reflect"
+	"sync"
+)
+
+// Engines which ship commands between nodes themselves encode them by name
+// through this registry. goraft keeps a registry of its own, which
+// RegisterCommand fills as well.
+var registry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}{types: make(map[string]reflect.Type)}
+
+// RegisterCommand makes a command type known by its name to every engine.
+// cmd must be a pointer to a struct, and is registered once.
+func RegisterCommand(cmd Command) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.types[cmd.CommandName()] = reflect.TypeOf(cmd).Elem()
+	raft.RegisterCommand(cmd)
+}
+
+func EncodeCommand(cmd Command) (string, []byte, error) {
+	raw, err := json.Marshal(cmd)
+	return cmd.CommandName(), raw, err
+}
+
+func DecodeCommand(name string, raw []byte) (Command, error) {
+	registry.RLock()
+	t, ok := registry.types[name]
+	registry.RUnlock()
+	if !ok {
+		return nil, errors.New("consensus: unknown command " + name)
+	}
+	cmd := reflect.New(t).Interface().(Command)
+	if err := json.Unmarshal(raw, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
@@ -2,13 +2,15 @@ package data
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	ch "github.com/RedactableBlockChain/chameleon"
-	"github.com/RedactableBlockChain/path"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -49,21 +51,51 @@ type Tx interface {
 	Modify(Payload interface{}, Proof interface{}, PrivateKey interface{}, ChameleonPara interface{}) error
 }
 
-// Write to file system
+// Write to file system atomically.
+// The content goes to a hidden temp file in the same dir, which is fsynced
+// and then renamed over path, so readers see either the old or the new file.
 func Write(t interface{}, path string) error {
-	fw, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	fw, err := ioutil.TempFile(dir, "."+name+".tmp")
 	if err != nil {
 		return err
 	}
-	defer fw.Close()
+	tmp := fw.Name()
+	defer os.Remove(tmp)
 
 	encoder := json.NewEncoder(fw)
 	err = encoder.Encode(t)
+	if err == nil {
+		err = fw.Chmod(0644)
+	}
+	if err == nil {
+		err = fw.Sync()
+	}
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return err
+	}
+	return SyncDir(dir)
+}
+
+// Flushes the entries of a dir, needed after rename, create or remove.
+func SyncDir(dir string) error {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return fd.Sync()
 }
 
 // Load from file system
@@ -93,47 +125,6 @@ type GolbalParameter struct {
 	Tk        []byte `json:"tk"`
 }
 
-func GetGolbalChameleonParameter() ([][]byte, []byte, []byte, error) {
-	local := &GolbalParameter{}
-	err := Load(local, path.GetConfigPath())
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	return [][]byte{local.P, local.Q, local.G}, local.Hk, local.Tk, nil
-}
-
-func CompareGolbalChameleonParameterWithLocal(para [][]byte) (bool, error) {
-	local := &GolbalParameter{}
-	err := Load(local, path.GetConfigPath())
-	if err != nil {
-		return false, err
-	}
-	return (bytes.Equal(local.P, para[0]) && bytes.Equal(local.Q, para[1]) && bytes.Equal(local.G, para[2])), nil
-}
-
-func GetCurrentBlockHeight() (int, error) {
-	local := &GolbalParameter{}
-	err := Load(local, path.GetConfigPath())
-	if err != nil {
-		return 0, err
-	}
-	return local.CurHeight, nil
-}
-
-func AddCurrentBlockHeight() error {
-	local := &GolbalParameter{}
-	err := Load(local, path.GetConfigPath())
-	if err != nil {
-		return err
-	}
-	local.CurHeight += 1
-	err = Write(local, path.GetConfigPath())
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 // Example Tx Implementation
 type BasicTx struct {
 	PayloadB     []byte   `json:"payload"`
@@ -259,6 +250,12 @@ type BasicHead struct {
 	HashRoot           []byte   `json:"hashRoot"`
 	PreviousRoot       []byte   `json:"previous_root"`
 	ChameleonParameter [][]byte `json:"chameleonParameter"`
+	// The producing node and its signature over the head, see Seal. The
+	// key makes a block file verifiable on its own, which node it belongs
+	// to is up to the cluster's key map.
+	Sealer    string `json:"sealer,omitempty"`
+	SealerKey []byte `json:"sealerKey,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
 }
 
 type BasicBlock struct {
@@ -278,7 +275,7 @@ func (b *BasicBlock) Head() interface{} {
 }
 
 func (b *BasicBlock) Transactions(index int) BasicTx {
-	if index >= b.HeadB.TxCount {
+	if index < 0 || index >= b.HeadB.TxCount || index >= len(b.TransactionsB) {
 		return BasicTx{}
 	}
 	return b.TransactionsB[index]
@@ -316,7 +313,12 @@ func (b *BasicBlock) Verify() bool {
 		}
 		tree = tmp
 	}
-	root := sha256.Sum256(bytes.Join([][]byte{tree[0], b.HeadB.PreviousRoot}, []byte("")))
+	var root [32]byte
+	if len(tree) != 0 {
+		root = sha256.Sum256(bytes.Join([][]byte{tree[0], b.HeadB.PreviousRoot}, []byte("")))
+	} else {
+		root = sha256.Sum256(bytes.Join([][]byte{[]byte("default"), b.HeadB.PreviousRoot}, []byte("")))
+	}
 	return bytes.Equal(b.HeadB.HashRoot, root[:])
 }
 
@@ -361,6 +363,32 @@ func (b *BasicBlock) Finalize(timestamp, height int, prvRoot []byte) error {
 	return nil
 }
 
+// SealBytes returns what the sealer signs: the head without its signature.
+// The hash root covers the transactions.
+func (b *BasicBlock) SealBytes() []byte {
+	h := b.HeadB
+	h.Signature = nil
+	raw, _ := json.Marshal(&h)
+	return raw
+}
+
+// Seal signs a finalized block as sealer, whose public key is key.
+func (b *BasicBlock) Seal(sealer string, key ed25519.PublicKey, sign func(msg []byte) []byte) {
+	b.HeadB.Sealer = sealer
+	b.HeadB.SealerKey = key
+	b.HeadB.Signature = sign(b.SealBytes())
+}
+
+// VerifySeal checks the signature against the key in the head. Redacting a
+// transaction keeps its hash, so the seal stays valid.
+func (b *BasicBlock) VerifySeal() bool {
+	key := b.HeadB.SealerKey
+	if len(key) != ed25519.PublicKeySize || len(b.HeadB.Signature) == 0 {
+		return false
+	}
+	return ed25519.Verify(key, b.SealBytes(), b.HeadB.Signature)
+}
+
 func (b *BasicBlock) ReplaceTx(t BasicTx, index int) error {
 	old := b.Transactions(index)
 	if len(old.HashVal()) == 0 {
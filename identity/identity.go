@@ -0,0 +1,101 @@
+// Package identity holds the ed25519 key pair which identifies a node.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/RedactableBlockChain/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type Identity struct {
+	Name       string
+	PublicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// The key file holds the private key seed, readable by the owner only.
+type keyFile struct {
+	Name string `json:"name"`
+	Seed []byte `json:"seed"`
+}
+
+func Generate(name string) (*Identity, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Name: name, PublicKey: pub, privateKey: priv}, nil
+}
+
+func Load(path string) (*Identity, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := keyFile{}
+	if err = json.Unmarshal(raw, &f); err != nil {
+		return nil, err
+	}
+	if len(f.Seed) != ed25519.SeedSize {
+		return nil, errors.New("identity: invalid key file " + path)
+	}
+	priv := ed25519.NewKeyFromSeed(f.Seed)
+	return &Identity{Name: f.Name, PublicKey: priv.Public().(ed25519.PublicKey), privateKey: priv}, nil
+}
+
+// Loads the identity at path, or creates one named name if there is none.
+func LoadOrCreate(path, name string) (*Identity, error) {
+	id, err := Load(path)
+	if !os.IsNotExist(err) {
+		return id, err
+	}
+	if id, err = Generate(name); err != nil {
+		return nil, err
+	}
+	return id, id.Save(path)
+}
+
+// Save writes the key file atomically, see data.Write.
+func (id *Identity) Save(path string) error {
+	raw, err := json.Marshal(keyFile{Name: id.Name, Seed: id.privateKey.Seed()})
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	fw, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := fw.Name()
+	defer os.Remove(tmp)
+	_, err = fw.Write(raw)
+	if err == nil {
+		err = fw.Sync()
+	}
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		return err
+	}
+	return data.SyncDir(dir)
+}
+
+func (id *Identity) Sign(msg []byte) []byte {
+	return ed25519.Sign(id.privateKey, msg)
+}
+
+func Verify(pub ed25519.PublicKey, msg, sig []byte) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, msg, sig)
+}
@@ -0,0 +1,223 @@
+package index
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Inverted index over tx payloads, values are empty. Terms are stored as
+// their hex HMAC-SHA256 under the term key of the node. Without the key a
+// copy of the index cannot be searched nor its terms guessed one word at a
+// time, and a redaction compacts the index so that the postings it drops
+// are not left in the file.
+//
+//	term: <term hash>/<height>/<txId>
+const TermIndex = "term"
+
+// Size of a term key in bytes.
+const TermKeySize = 32
+
+// Key of the term hashes. Until SetTermKey is called it is random, so an
+// index built without one is rebuilt on the next start.
+var termSecret = func() []byte {
+	key := make([]byte, TermKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// SetTermKey sets the key search terms are hashed with. It is called
+// before the indexes are built or caught up, which rebuild the term index
+// when the key changed.
+func SetTermKey(key []byte) {
+	termSecret = key
+}
+
+// LoadTermKey reads the hex term key at path, creating a random one
+// readable by the owner only if there is none.
+func LoadTermKey(path string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, TermKeySize)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, writeKey(path, []byte(hex.EncodeToString(key)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != TermKeySize {
+		return nil, fmt.Errorf("%s is not a hex term key of %d bytes", path, TermKeySize)
+	}
+	return key, nil
+}
+
+func writeKey(path string, raw []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(raw)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return data.SyncDir(filepath.Dir(path))
+}
+
+// termKeyId names the term key in the index meta without revealing it.
+func termKeyId() string {
+	return termHash("")
+}
+
+// Longer tokens are not indexed.
+const maxTermLen = 64
+
+// Splits a payload into distinct lower case terms of letters and digits.
+func Tokenize(payload []byte) []string {
+	fields := strings.FieldsFunc(strings.ToLower(string(payload)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool)
+	var terms []string
+	for _, f := range fields {
+		if len(f) > maxTermLen || seen[f] {
+			continue
+		}
+		seen[f] = true
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// Tokenize never returns an empty term, so the hash of one is free to
+// serve as termKeyId.
+func termHash(term string) string {
+	mac := hmac.New(sha256.New, termSecret)
+	mac.Write([]byte(term))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func termKey(term string, height, txId int) string {
+	return fmt.Sprintf("%s/%012d/%06d", termHash(term), height, txId)
+}
+
+func addTerms(st store.Store, block *data.BasicBlock) error {
+	for i := 0; i < block.HeadB.TxCount; i++ {
+		if err := AddTerms(st, block.HeadB.Height, i, block.TransactionsB[i].PayloadB); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveTerms drops the postings of a payload which is about to be
+// redacted and compacts the term index. It runs before the new payload is
+// stored, so a redacted term is never findable once the modification is
+// visible.
+func RemoveTerms(st store.Store, height, txId int, payload []byte) error {
+	for _, term := range Tokenize(payload) {
+		if err := st.IndexDelete(TermIndex, termKey(term, height, txId)); err != nil {
+			return err
+		}
+	}
+	return st.CompactIndex(TermIndex)
+}
+
+// AddTerms adds the postings of the payload stored at (height, txId).
+func AddTerms(st store.Store, height, txId int, payload []byte) error {
+	for _, term := range Tokenize(payload) {
+		if err := st.IndexPut(TermIndex, termKey(term, height, txId), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search returns txs whose payload contains every term of the query.
+// Postings of the first term are walked in chain order, the cursor is the
+// last posting of the page.
+func Search(st store.Store, query string, cursor string, limit int) ([]TxRef, string, error) {
+	limit = ClampLimit(limit)
+	terms := Tokenize([]byte(query))
+	if len(terms) == 0 {
+		return []TxRef{}, "", nil
+	}
+	prefix := termHash(terms[0]) + "/"
+	after := prefix
+	if cursor > after {
+		after = cursor
+	}
+	refs := []TxRef{}
+	for {
+		entries, err := st.IndexScan(TermIndex, prefix, after, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, e := range entries {
+			after = e.Key
+			f := strings.Split(strings.TrimPrefix(e.Key, prefix), "/")
+			if len(f) != 2 {
+				continue
+			}
+			height, _ := strconv.Atoi(f[0])
+			txId, _ := strconv.Atoi(f[1])
+			match := true
+			for _, term := range terms[1:] {
+				_, err := st.IndexGet(TermIndex, termKey(term, height, txId))
+				if err == store.ErrNotFound {
+					match = false
+					break
+				}
+				if err != nil {
+					return nil, "", err
+				}
+			}
+			if match {
+				refs = append(refs, TxRef{Height: height, TxId: txId})
+				if len(refs) == limit {
+					return refs, after, nil
+				}
+			}
+		}
+		if len(entries) < limit {
+			return refs, "", nil
+		}
+	}
+}
+
+// Matches reports whether a payload still contains every term of the query.
+// Search results are checked against the stored payload with it, so even a
+// stale posting can never surface redacted content.
+func Matches(payload []byte, query string) bool {
+	have := make(map[string]bool)
+	for _, term := range Tokenize(payload) {
+		have[term] = true
+	}
+	for _, term := range Tokenize([]byte(query)) {
+		if !have[term] {
+			return false
+		}
+	}
+	return true
+}
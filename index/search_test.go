@@ -0,0 +1,145 @@
+package index
+
+import (
+	"bytes"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func termKeys(t *testing.T, st store.Store) map[string]bool {
+	t.Helper()
+	entries, err := st.IndexScan(TermIndex, "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	for _, e := range entries {
+		keys[e.Key] = true
+	}
+	return keys
+}
+
+func TestSearchHashesTerms(t *testing.T) {
+	st := store.NewMemStore()
+	if err := AddTerms(st, 1, 0, []byte("Alice pays Bob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddTerms(st, 2, 0, []byte("bob pays carol")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := st.IndexScan(TermIndex, "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		for _, term := range []string{"alice", "bob", "carol", "pays"} {
+			if strings.Contains(e.Key, term) {
+				t.Fatalf("plaintext term in key %q", e.Key)
+			}
+		}
+	}
+
+	refs, _, err := Search(st, "BOB pays", "", 0)
+	if err != nil || len(refs) != 2 {
+		t.Fatalf("search %v, %v", refs, err)
+	}
+	if err := RemoveTerms(st, 1, 0, []byte("Alice pays Bob")); err != nil {
+		t.Fatal(err)
+	}
+	refs, _, err = Search(st, "bob", "", 0)
+	if err != nil || len(refs) != 1 || refs[0].Height != 2 {
+		t.Fatalf("search after redaction %v, %v", refs, err)
+	}
+}
+
+// Term hashes depend on the term key, and the term index is rebuilt when
+// the key changed.
+func TestTermKey(t *testing.T) {
+	saved := termSecret
+	defer SetTermKey(saved)
+	st := store.NewMemStore()
+	block := &data.BasicBlock{TransactionsB: []data.BasicTx{{PayloadB: []byte("alice pays bob")}}}
+	block.HeadB.TxCount = 1
+	if err := st.PutBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	SetTermKey(bytes.Repeat([]byte{1}, TermKeySize))
+	if err := CatchUp(st); err != nil {
+		t.Fatal(err)
+	}
+	before := termKeys(t, st)
+	SetTermKey(bytes.Repeat([]byte{2}, TermKeySize))
+	if err := CatchUp(st); err != nil {
+		t.Fatal(err)
+	}
+	after := termKeys(t, st)
+	if len(before) != 3 || len(after) != 3 {
+		t.Fatalf("%d postings, %d after the key changed", len(before), len(after))
+	}
+	for key := range after {
+		if before[key] {
+			t.Fatalf("posting %s under both keys", key)
+		}
+	}
+	refs, _, err := Search(st, "bob", "", 0)
+	if err != nil || len(refs) != 1 {
+		t.Fatalf("search under the new key %v, %v", refs, err)
+	}
+}
+
+func TestLoadTermKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index_key")
+	key, err := LoadTermKey(path)
+	if err != nil || len(key) != TermKeySize {
+		t.Fatalf("created key %x, %v", key, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file %v, %v", info.Mode(), err)
+	}
+	if again, err := LoadTermKey(path); err != nil || !bytes.Equal(again, key) {
+		t.Fatalf("reloaded key %x, %v", again, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTermKey(path); err == nil {
+		t.Fatal("invalid key loaded")
+	}
+}
+
+// A redaction leaves no record of the postings it drops in the index file.
+func TestRemoveTermsCompacts(t *testing.T) {
+	root := t.TempDir()
+	st, err := store.NewFileStore(filepath.Join(root, "config"), filepath.Join(root, "pool"), filepath.Join(root, "block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if err = AddTerms(st, 1, 0, []byte("alice pays bob")); err != nil {
+		t.Fatal(err)
+	}
+	if err = AddTerms(st, 2, 0, []byte("carol")); err != nil {
+		t.Fatal(err)
+	}
+	if err = RemoveTerms(st, 1, 0, []byte("alice pays bob")); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(root, "index", TermIndex+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, term := range []string{"alice", "pays", "bob"} {
+		if bytes.Contains(raw, []byte(termHash(term))) {
+			t.Fatalf("redacted term %s left in the index log", term)
+		}
+	}
+	if !bytes.Contains(raw, []byte(termHash("carol"))) {
+		t.Fatal("posting of another tx compacted away")
+	}
+}
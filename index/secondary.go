@@ -0,0 +1,143 @@
+package index
+
+import (
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/store"
+	"strconv"
+	"strings"
+)
+
+// Secondary indexes. Keys are fixed width so that their order is the order
+// of the numbers in them, values are empty.
+//
+//	pk:   <hex pk>/<timestamp>/<height>/<txId>
+//	time: <timestamp>/<height>
+const (
+	PkIndex   = "pk"
+	TimeIndex = "time"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// A tx found through a secondary index.
+type TxRef struct {
+	Height    int `json:"height"`
+	TxId      int `json:"tx_id"`
+	Timestamp int `json:"timestamp"`
+}
+
+// A block found through the time index.
+type BlockRef struct {
+	Height    int `json:"height"`
+	Timestamp int `json:"timestamp"`
+}
+
+func pkPrefix(pk []byte) string {
+	return fmt.Sprintf("%x/", pk)
+}
+
+func pkKey(pk []byte, timestamp, height, txId int) string {
+	return fmt.Sprintf("%s%020d/%012d/%06d", pkPrefix(pk), timestamp, height, txId)
+}
+
+func timeKey(timestamp, height int) string {
+	return fmt.Sprintf("%020d/%012d", timestamp, height)
+}
+
+func addSecondary(st store.Store, block *data.BasicBlock) error {
+	head := block.HeadB
+	for i := 0; i < head.TxCount; i++ {
+		key := pkKey(block.TransactionsB[i].ChameleonPkB, head.Timestamp, head.Height, i)
+		if err := st.IndexPut(PkIndex, key, nil); err != nil {
+			return err
+		}
+	}
+	return st.IndexPut(TimeIndex, timeKey(head.Timestamp, head.Height), nil)
+}
+
+// ClampLimit bounds the page size of a query, <= 0 asks for the default.
+func ClampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+// Where a range scan starts: after the cursor of the previous page, or
+// right before the first key with timestamp >= from.
+func startKey(prefix string, from int, cursor string) string {
+	start := prefix + fmt.Sprintf("%020d", from)
+	if from <= 0 {
+		start = prefix
+	}
+	if cursor > start {
+		return cursor
+	}
+	return start
+}
+
+// Txs owned by pk within [from, to] (unix seconds, to <= 0 is open ended).
+// Returns one page and the cursor of the next one, "" on the last page.
+func TxsByPk(st store.Store, pk []byte, from, to int, cursor string, limit int) ([]TxRef, string, error) {
+	limit = ClampLimit(limit)
+	prefix := pkPrefix(pk)
+	entries, err := st.IndexScan(PkIndex, prefix, startKey(prefix, from, cursor), limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	refs := []TxRef{}
+	next := ""
+	for i, e := range entries {
+		f := strings.Split(strings.TrimPrefix(e.Key, prefix), "/")
+		if len(f) != 3 {
+			continue
+		}
+		ts, _ := strconv.Atoi(f[0])
+		if to > 0 && ts > to {
+			break
+		}
+		if i == limit {
+			next = entries[i-1].Key
+			break
+		}
+		height, _ := strconv.Atoi(f[1])
+		txId, _ := strconv.Atoi(f[2])
+		refs = append(refs, TxRef{Height: height, TxId: txId, Timestamp: ts})
+	}
+	return refs, next, nil
+}
+
+// Blocks sealed within [from, to] (unix seconds, to <= 0 is open ended).
+func BlocksByTime(st store.Store, from, to int, cursor string, limit int) ([]BlockRef, string, error) {
+	limit = ClampLimit(limit)
+	entries, err := st.IndexScan(TimeIndex, "", startKey("", from, cursor), limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	refs := []BlockRef{}
+	next := ""
+	for i, e := range entries {
+		f := strings.Split(e.Key, "/")
+		if len(f) != 2 {
+			continue
+		}
+		ts, _ := strconv.Atoi(f[0])
+		if to > 0 && ts > to {
+			break
+		}
+		if i == limit {
+			next = entries[i-1].Key
+			break
+		}
+		height, _ := strconv.Atoi(f[1])
+		refs = append(refs, BlockRef{Height: height, Timestamp: ts})
+	}
+	return refs, next, nil
+}
@@ -0,0 +1,146 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+)
+
+// Name of the tx hash index, keyed by hex hash value.
+const TxIndex = "tx"
+
+// Meta keys of the highest block already in the indexes, of the index
+// layout version and of the term key the term index was built with. Bump
+// version whenever an index is added or changed, nodes rebuild their
+// indexes when it or the term key differs.
+const (
+	indexedHeightKey = "indexed_height"
+	versionKey       = "index_version"
+	termKeyIdKey     = "index_term_key"
+	version          = 5
+)
+
+// Where a tx lives: either in the pool or at (Height, TxId) on chain.
+type TxLocation struct {
+	InPool bool `json:"in_pool"`
+	Height int  `json:"height"`
+	TxId   int  `json:"tx_id"`
+}
+
+func LookupTx(st store.Store, hash string) (*TxLocation, error) {
+	raw, err := st.IndexGet(TxIndex, hash)
+	if err != nil {
+		return nil, err
+	}
+	loc := &TxLocation{}
+	if err = json.Unmarshal(raw, loc); err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
+
+func putTx(st store.Store, hash []byte, loc TxLocation) error {
+	raw, err := json.Marshal(loc)
+	if err != nil {
+		return err
+	}
+	return st.IndexPut(TxIndex, fmt.Sprintf("%x", hash), raw)
+}
+
+// Records a tx which entered the pool.
+func AddPoolTx(st store.Store, tx *data.BasicTx) error {
+	return putTx(st, tx.HashVal(), TxLocation{InPool: true})
+}
+
+// Records every tx of a committed block, replacing their pool entries.
+func AddBlock(st store.Store, block *data.BasicBlock) error {
+	for i := 0; i < block.HeadB.TxCount; i++ {
+		loc := TxLocation{Height: block.HeadB.Height, TxId: i}
+		if err := putTx(st, block.TransactionsB[i].HashVal(), loc); err != nil {
+			return err
+		}
+	}
+	if err := addSecondary(st, block); err != nil {
+		return err
+	}
+	if err := addTerms(st, block); err != nil {
+		return err
+	}
+	return st.PutMeta(indexedHeightKey, block.HeadB.Height)
+}
+
+// Indexes blocks committed after the last indexed one, e.g. when the node
+// stopped between committing a block and indexing it.
+func CatchUp(st store.Store) error {
+	v := 0
+	err := st.GetMeta(versionKey, &v)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	keyId := ""
+	err = st.GetMeta(termKeyIdKey, &keyId)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	if v != version || keyId != termKeyId() {
+		return Rebuild(st)
+	}
+	indexed := -1
+	err = st.GetMeta(indexedHeightKey, &indexed)
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	top, err := st.Height()
+	if err != nil {
+		return err
+	}
+	for h := indexed + 1; h <= top; h++ {
+		block, err := st.GetBlock(h)
+		if err != nil {
+			return err
+		}
+		if err = AddBlock(st, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drops the indexes and builds them again from blocks and pool.
+func Rebuild(st store.Store) error {
+	logging.Info("rebuilding indexes")
+	for _, name := range []string{TxIndex, PkIndex, TimeIndex, TermIndex} {
+		if err := st.DropIndex(name); err != nil {
+			return err
+		}
+	}
+	top, err := st.Height()
+	if err != nil {
+		return err
+	}
+	for h := 0; h <= top; h++ {
+		block, err := st.GetBlock(h)
+		if err != nil {
+			return err
+		}
+		if err = AddBlock(st, block); err != nil {
+			return err
+		}
+	}
+	txs, err := st.PoolTxs()
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err = AddPoolTx(st, tx); err != nil {
+			return err
+		}
+	}
+	logging.Info("indexes rebuilt", "height", top, "pool", len(txs))
+	if err = st.PutMeta(termKeyIdKey, termKeyId()); err != nil {
+		return err
+	}
+	return st.PutMeta(versionKey, version)
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mode decides how sensitive fields (tx payloads, proofs) are rendered.
+type Mode int
+
+const (
+	// hash: only a sha256 fingerprint of the field is logged
+	Hash Mode = iota
+	// truncate: the first few bytes followed by the original length,
+	// plaintext as well, honoured only when debug payloads are allowed
+	Truncate
+	// omit: only the length of the field is logged
+	Omit
+	// full: the plaintext, honoured only when debug payloads are allowed
+	Full
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Hash:
+		return "hash"
+	case Truncate:
+		return "truncate"
+	case Omit:
+		return "omit"
+	case Full:
+		return "full"
+	}
+	return "unknown"
+}
+
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "hash":
+		return Hash, nil
+	case "truncate":
+		return Truncate, nil
+	case "omit":
+		return Omit, nil
+	case "full":
+		return Full, nil
+	}
+	return Hash, errors.New("unknown payload log mode: " + s)
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// Config of the process wide logger
+type Config struct {
+	Level  slog.Level
+	Format string // text or json
+	Output io.Writer
+
+	// Scrubbing of sensitive fields
+	PayloadMode   Mode
+	TruncateLen   int
+	DebugPayloads bool // must be set for PayloadMode Truncate or Full to take effect
+}
+
+var (
+	mutex         sync.RWMutex
+	level         = new(slog.LevelVar)
+	logger        = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	payloadMode   = Hash
+	truncateLen   = 8
+	debugPayloads = false
+)
+
+// Setup replaces the process wide logger.
+func Setup(c Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	out := c.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	level.Set(c.Level)
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Format == "json" {
+		logger = slog.New(slog.NewJSONHandler(out, opts))
+	} else {
+		logger = slog.New(slog.NewTextHandler(out, opts))
+	}
+	payloadMode = c.PayloadMode
+	if c.TruncateLen > 0 {
+		truncateLen = c.TruncateLen
+	}
+	debugPayloads = c.DebugPayloads
+	if (payloadMode == Truncate || payloadMode == Full) && !debugPayloads {
+		logger.Warn("payload log mode requires debug payloads, falling back to hash", "mode", payloadMode)
+		payloadMode = Hash
+	}
+}
+
+func Logger() *slog.Logger {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return logger
+}
+
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+func Debug(msg string, args ...any) {
+	Logger().Debug(msg, args...)
+}
+
+func Info(msg string, args ...any) {
+	Logger().Info(msg, args...)
+}
+
+func Warn(msg string, args ...any) {
+	Logger().Warn(msg, args...)
+}
+
+func Error(msg string, args ...any) {
+	Logger().Error(msg, args...)
+}
+
+// Fatal logs at error level and exits the process.
+func Fatal(msg string, args ...any) {
+	Logger().Error(msg, args...)
+	os.Exit(1)
+}
+
+// Payload wraps a sensitive field so it is scrubbed according to the
+// configured mode whenever it is rendered by any handler.
+// Never pass tx payloads or proofs to the logger without it.
+func Payload(key string, b []byte) slog.Attr {
+	return slog.Any(key, scrubbed(b))
+}
+
+type scrubbed []byte
+
+func (s scrubbed) LogValue() slog.Value {
+	mutex.RLock()
+	mode, n, debug := payloadMode, truncateLen, debugPayloads
+	mutex.RUnlock()
+
+	switch mode {
+	case Full:
+		if debug {
+			return slog.StringValue(string(s))
+		}
+	case Truncate:
+		if !debug {
+			break
+		}
+		if len(s) <= n {
+			return slog.StringValue(fmt.Sprintf("%q(len=%d)", string(s), len(s)))
+		}
+		return slog.StringValue(fmt.Sprintf("%q...(len=%d)", string(s[:n]), len(s)))
+	case Omit:
+		return slog.StringValue(fmt.Sprintf("<omitted len=%d>", len(s)))
+	}
+	sum := sha256.Sum256(s)
+	return slog.StringValue(fmt.Sprintf("sha256:%x", sum[:8]))
+}
@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const secret = "attack at dawn"
+
+func render(t *testing.T, c Config) string {
+	t.Helper()
+	out := &bytes.Buffer{}
+	c.Output = out
+	Setup(c)
+	defer Setup(Config{Level: slog.LevelInfo})
+	Info("tx", Payload("payload", []byte(secret)))
+	return out.String()
+}
+
+func TestPayloadScrubbed(t *testing.T) {
+	for _, mode := range []Mode{Hash, Truncate, Omit, Full} {
+		for _, format := range []string{"text", "json"} {
+			out := render(t, Config{Format: format, PayloadMode: mode})
+			if strings.Contains(out, secret[:4]) {
+				t.Errorf("mode %s, format %s: payload bytes in log: %s", mode, format, out)
+			}
+		}
+	}
+}
+
+func TestPayloadDebug(t *testing.T) {
+	if out := render(t, Config{PayloadMode: Full, DebugPayloads: true}); !strings.Contains(out, secret) {
+		t.Errorf("full debug payload not logged: %s", out)
+	}
+	if out := render(t, Config{PayloadMode: Truncate, DebugPayloads: true, TruncateLen: 6}); !strings.Contains(out, secret[:6]) || strings.Contains(out, secret[:7]) {
+		t.Errorf("truncated payload not cut at 6 bytes: %s", out)
+	}
+}
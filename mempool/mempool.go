@@ -0,0 +1,443 @@
+package mempool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrDuplicate = errors.New("mempool: transaction already in pool")
+	ErrOnChain   = errors.New("mempool: transaction already on chain")
+	ErrTooLarge  = errors.New("mempool: transaction larger than the pool")
+	ErrFull      = errors.New("mempool: pool is full")
+)
+
+// Ordering of the pool, which is also the order txs are packed in.
+const (
+	FIFO     = "fifo"     // arrival order
+	Priority = "priority" // higher priority first, then arrival order
+)
+
+// Name of the index holding entry metadata, keyed by hex hash value.
+const EntryIndex = "mempool"
+
+// Meta key of the last arrival sequence number handed out.
+const seqKey = "mempool_seq"
+
+// Meta key of the replicated pool config.
+const ConfigKey = "mempool_config"
+
+// Every node applies the same AddTx and Pack commands in the same order,
+// so the limits below must be identical on all nodes of a cluster. They
+// are replicated: the config in store, once set, wins over the one New is
+// given.
+type Config struct {
+	MaxTxs   int    `json:"max_txs"`   // 0 means unlimited
+	MaxBytes int    `json:"max_bytes"` // 0 means unlimited
+	TTL      int    `json:"ttl"`       // seconds, 0 means txs never expire
+	Ordering string `json:"ordering"`  // FIFO or Priority
+}
+
+func (c Config) Validate() error {
+	if c.MaxTxs < 0 || c.MaxBytes < 0 || c.TTL < 0 {
+		return errors.New("mempool config: limits and ttl must not be negative")
+	}
+	if c.Ordering != FIFO && c.Ordering != Priority {
+		return errors.New("unknown mempool ordering: " + c.Ordering)
+	}
+	return nil
+}
+
+// Entry is a pooled tx plus what the pool knows about it.
+// Seq is assigned in log order and Arrival is stamped by the node which
+// proposed the tx, so both are the same on every node.
+type Entry struct {
+	Hash     string       `json:"hash"`
+	Seq      uint64       `json:"seq"`
+	Arrival  int64        `json:"arrival"`
+	Priority int          `json:"priority"`
+	Size     int          `json:"size"`
+	Tx       data.BasicTx `json:"-"`
+}
+
+type Pool struct {
+	mutex   sync.Mutex
+	st      store.Store
+	config  Config
+	entries map[string]*Entry
+	seq     uint64
+	bytes   int
+}
+
+// Loads the pool persisted in st.
+func New(st store.Store, c Config) (*Pool, error) {
+	err := st.GetMeta(ConfigKey, &c)
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	if c.Ordering == "" {
+		c.Ordering = FIFO
+	}
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Pool{
+		st:      st,
+		config:  c,
+		entries: make(map[string]*Entry),
+	}
+	err = st.GetMeta(seqKey, &p.seq)
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	txs, err := st.PoolTxs()
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range txs {
+		hash := fmt.Sprintf("%x", tx.HashVal())
+		e := &Entry{}
+		raw, err := st.IndexGet(EntryIndex, hash)
+		if err == nil {
+			err = json.Unmarshal(raw, e)
+		}
+		if err == store.ErrNotFound {
+			// pooled before the mempool existed: keep it, in hash order
+			p.seq++
+			e = &Entry{Hash: hash, Seq: p.seq, Size: Size(tx)}
+			err = p.persist(e)
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.Tx = *tx
+		p.entries[hash] = e
+		p.bytes += e.Size
+	}
+	logging.Info("mempool loaded", "count", len(p.entries), "bytes", p.bytes)
+	return p, nil
+}
+
+func (p *Pool) Config() Config {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.config
+}
+
+// SetConfig stores and applies a new config. Txs already pooled stay, the
+// new limits apply to the txs added from now on.
+func (p *Pool) SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.st.PutMeta(ConfigKey, c); err != nil {
+		return err
+	}
+	p.config = c
+	return nil
+}
+
+// Size of a tx as counted against byte limits: its JSON encoding.
+func Size(tx *data.BasicTx) int {
+	raw, _ := json.Marshal(tx)
+	return len(raw)
+}
+
+func (p *Pool) persist(e *Entry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err = p.st.IndexPut(EntryIndex, e.Hash, raw); err != nil {
+		return err
+	}
+	return p.st.PutMeta(seqKey, p.seq)
+}
+
+// less is the pool order.
+func (p *Pool) less(a, b *Entry) bool {
+	if p.config.Ordering == Priority && a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.Seq < b.Seq
+}
+
+func (p *Pool) sorted() []*Entry {
+	list := make([]*Entry, 0, len(p.entries))
+	for _, e := range p.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return p.less(list[i], list[j]) })
+	return list
+}
+
+// key orders entries like less. Cursors are keys, so that a page
+// continues where the previous one stopped, whatever was packed since.
+func (p *Pool) key(e *Entry) string {
+	if p.config.Ordering == Priority {
+		return fmt.Sprintf("%020d/%020d", uint64(1)<<63-uint64(int64(e.Priority)), e.Seq)
+	}
+	return fmt.Sprintf("%020d", e.Seq)
+}
+
+// fits reports whether count txs plus a new one, of bytes in total,
+// stay within the limits.
+func (p *Pool) fits(count, bytes int) bool {
+	return (p.config.MaxTxs <= 0 || count+1 <= p.config.MaxTxs) &&
+		(p.config.MaxBytes <= 0 || bytes <= p.config.MaxBytes)
+}
+
+// victims picks the lowest priority entries whose eviction makes room for
+// e, or reports false if that would evict txs of equal or higher priority.
+func (p *Pool) victims(e *Entry) ([]*Entry, bool) {
+	list := p.sorted()
+	count, bytes := len(list), p.bytes+e.Size
+	var victims []*Entry
+	for i := len(list) - 1; i >= 0; i-- {
+		if p.fits(count, bytes) {
+			return victims, true
+		}
+		if list[i].Priority >= e.Priority {
+			return nil, false
+		}
+		victims = append(victims, list[i])
+		count--
+		bytes -= list[i].Size
+	}
+	return victims, p.fits(count, bytes)
+}
+
+// Add pools a verified tx. With priority ordering a full pool evicts its
+// lowest priority txs to make room for a higher priority one, with FIFO
+// ordering a full pool rejects the new tx.
+func (p *Pool) Add(tx data.BasicTx, arrival int64, priority int) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	hash := fmt.Sprintf("%x", tx.HashVal())
+	if _, ok := p.entries[hash]; ok {
+		return ErrDuplicate
+	}
+	loc, err := index.LookupTx(p.st, hash)
+	if err == nil && !loc.InPool {
+		return ErrOnChain
+	}
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	e := &Entry{Hash: hash, Arrival: arrival, Priority: priority, Size: Size(&tx), Tx: tx}
+	if p.config.MaxBytes > 0 && e.Size > p.config.MaxBytes {
+		return ErrTooLarge
+	}
+	if !p.fits(len(p.entries), p.bytes+e.Size) {
+		if p.config.Ordering != Priority {
+			return ErrFull
+		}
+		victims, ok := p.victims(e)
+		if !ok {
+			return ErrFull
+		}
+		for _, v := range victims {
+			logging.Info("mempool evicted transaction", "hash", v.Hash, "priority", v.Priority)
+			if err := p.drop(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.seq++
+	e.Seq = p.seq
+	if err = p.st.PutPoolTx(&tx); err != nil {
+		return err
+	}
+	if err = p.persist(e); err != nil {
+		return err
+	}
+	if err = index.AddPoolTx(p.st, &tx); err != nil {
+		return err
+	}
+	p.entries[hash] = e
+	p.bytes += e.Size
+	return nil
+}
+
+// drop removes an entry which leaves the pool without being packed.
+func (p *Pool) drop(e *Entry) error {
+	if err := p.st.DeletePoolTx(e.Tx.HashVal()); err != nil {
+		return err
+	}
+	if err := p.st.IndexDelete(index.TxIndex, e.Hash); err != nil {
+		return err
+	}
+	return p.forget(e)
+}
+
+func (p *Pool) forget(e *Entry) error {
+	delete(p.entries, e.Hash)
+	p.bytes -= e.Size
+	return p.st.IndexDelete(EntryIndex, e.Hash)
+}
+
+func (p *Pool) Has(hash []byte) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, ok := p.entries[fmt.Sprintf("%x", hash)]
+	return ok
+}
+
+// Get returns the pooled tx with the hex hash.
+func (p *Pool) Get(hash string) (data.BasicTx, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	e, ok := p.entries[hash]
+	if !ok {
+		return data.BasicTx{}, false
+	}
+	return e.Tx, true
+}
+
+// Packed forgets the txs of a committed block. The block commit already
+// removed them from the store pool.
+func (p *Pool) Packed(block *data.BasicBlock) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := 0; i < block.HeadB.TxCount; i++ {
+		if e, ok := p.entries[fmt.Sprintf("%x", block.TransactionsB[i].HashVal())]; ok {
+			if err := p.forget(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Pool) expired(e *Entry, now int64) bool {
+	return p.config.TTL > 0 && e.Arrival > 0 && e.Arrival+int64(p.config.TTL) < now
+}
+
+// Expire drops txs older than the TTL at time now. It is called while
+// applying a block with the block timestamp, so every node expires the
+// same txs.
+func (p *Pool) Expire(now int64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, e := range p.sorted() {
+		if p.expired(e, now) {
+			logging.Info("mempool expired transaction", "hash", e.Hash, "arrival", e.Arrival)
+			if err := p.drop(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Select returns the txs of the next block in pool order: at most maxTxs
+// txs of at most maxBytes in total (0 means unlimited), skipping txs which
+// would be expired at time now. more reports that txs were left out
+// because of the limits.
+func (p *Pool) Select(maxTxs, maxBytes int, now int64) (txs []data.BasicTx, more bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	total := 0
+	for _, e := range p.sorted() {
+		if p.expired(e, now) {
+			continue
+		}
+		if (maxTxs > 0 && len(txs) >= maxTxs) || (maxBytes > 0 && total+e.Size > maxBytes) {
+			return txs, true
+		}
+		txs = append(txs, e.Tx)
+		total += e.Size
+	}
+	return txs, false
+}
+
+// Snapshot returns every entry, with its tx, in pool order and the last
+// sequence number handed out.
+func (p *Pool) Snapshot() ([]Entry, uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entries := []Entry{}
+	for _, e := range p.sorted() {
+		entries = append(entries, *e)
+	}
+	return entries, p.seq
+}
+
+// Restore replaces the pool with the entries of a snapshot. The caller
+// rebuilds the tx index afterwards.
+func (p *Pool) Restore(entries []Entry, seq uint64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, e := range p.entries {
+		if err := p.st.DeletePoolTx(e.Tx.HashVal()); err != nil {
+			return err
+		}
+		if err := p.forget(e); err != nil {
+			return err
+		}
+	}
+	p.seq = seq
+	for i := range entries {
+		e := entries[i]
+		e.Hash = fmt.Sprintf("%x", e.Tx.HashVal())
+		e.Size = Size(&e.Tx)
+		if err := p.st.PutPoolTx(&e.Tx); err != nil {
+			return err
+		}
+		if err := p.persist(&e); err != nil {
+			return err
+		}
+		p.entries[e.Hash] = &e
+		p.bytes += e.Size
+	}
+	return p.st.PutMeta(seqKey, p.seq)
+}
+
+// Status of the pool for the inspection endpoint.
+type Status struct {
+	Config  Config  `json:"config"`
+	Count   int     `json:"count"`
+	Bytes   int     `json:"bytes"`
+	Entries []Entry `json:"entries"`
+}
+
+func (p *Pool) Status() *Status {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	s := &Status{Config: p.config, Count: len(p.entries), Bytes: p.bytes, Entries: []Entry{}}
+	for _, e := range p.sorted() {
+		s.Entries = append(s.Entries, *e)
+	}
+	return s
+}
+
+// Page returns up to limit entries, with their txs, in pool order after
+// cursor, and the cursor of the next page, "" on the last one. limit <= 0
+// means no limit.
+func (p *Pool) Page(cursor string, limit int) ([]Entry, string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entries := []Entry{}
+	for _, e := range p.sorted() {
+		if p.key(e) <= cursor {
+			continue
+		}
+		if limit > 0 && len(entries) == limit {
+			return entries, p.key(&entries[limit-1])
+		}
+		entries = append(entries, *e)
+	}
+	return entries, ""
+}
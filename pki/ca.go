@@ -0,0 +1,138 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Lifetimes of generated certificates.
+const (
+	CAValidity   = 10 * 365 * 24 * time.Hour
+	NodeValidity = 2 * 365 * 24 * time.Hour
+)
+
+// File names in a CA directory.
+const (
+	CACert = "ca.crt"
+	CAKey  = "ca.key"
+)
+
+func serial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// writePEM writes a file which only the owner may read when private.
+func writePEM(path, kind string, der []byte, private bool) error {
+	mode := os.FileMode(0644)
+	if private {
+		mode = 0600
+	}
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), mode)
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "EC PRIVATE KEY", der, true)
+}
+
+// InitCA creates a CA certificate and key in dir. An existing CA is never
+// overwritten.
+func InitCA(dir, name string) error {
+	if _, err := os.Stat(filepath.Join(dir, CAKey)); err == nil {
+		return errors.New("a CA already exists in " + dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	sn, err := serial()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          sn,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	if err = writeKey(filepath.Join(dir, CAKey), key); err != nil {
+		return err
+	}
+	return writePEM(filepath.Join(dir, CACert), "CERTIFICATE", der, false)
+}
+
+// Issue creates a certificate for the node name, valid for serving on
+// hosts and as a client, signed by the CA in caDir. It writes <name>.crt
+// and <name>.key to outDir.
+func Issue(caDir, name string, hosts []string, outDir string) error {
+	ca, err := tls.LoadX509KeyPair(filepath.Join(caDir, CACert), filepath.Join(caDir, CAKey))
+	if err != nil {
+		return err
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	sn, err := serial()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: sn,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(NodeValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(outDir, 0700); err != nil {
+		return err
+	}
+	if err = writeKey(filepath.Join(outDir, name+".key"), key); err != nil {
+		return err
+	}
+	return writePEM(filepath.Join(outDir, name+".crt"), "CERTIFICATE", der, false)
+}
@@ -0,0 +1,107 @@
+// Package pki sets up TLS between nodes and clients from a node-local CA:
+// every node holds a certificate issued to its name, used both to serve and
+// to authenticate to its peers.
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// CA which issued the certificates of the cluster.
+	CAFile string
+	// Require a certificate of the CA on peer traffic.
+	PeerAuth bool
+}
+
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+func (c Config) Validate() error {
+	if c.Enabled() && (c.CertFile == "" || c.KeyFile == "" || c.CAFile == "") {
+		return errors.New("tls needs a certificate, its key and the CA certificate")
+	}
+	if c.PeerAuth && !c.Enabled() {
+		return errors.New("peer authentication needs tls")
+	}
+	return nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, errors.New("no certificate in " + path)
+	}
+	return pool, nil
+}
+
+// Load returns the server and the client side of c. The server asks every
+// client for a certificate of the CA but only checks it when one is sent;
+// which routes require one is up to the server, see PeerName. The client
+// presents the node certificate and trusts the CA only.
+func (c Config) Load() (server *tls.Config, client *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pool, err := loadPool(c.CAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return server, client, nil
+}
+
+// ClientConfig is the client side for tools: the CA to trust and, when the
+// API asks for one, a client certificate.
+func ClientConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	pool, err := loadPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// UseForDefaultClient makes the HTTP clients of the process, which all go
+// through http.DefaultTransport, speak TLS with config.
+func UseForDefaultClient(config *tls.Config) {
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = config
+}
+
+// PeerName returns the name in the verified client certificate of req, ""
+// when the client sent none.
+func PeerName(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	return req.TLS.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,92 @@
+package pki
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// issue creates a CA and certificates of names in a temporary directory.
+func issue(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := InitCA(dir, "test ca"); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitCA(dir, "test ca"); err == nil {
+		t.Fatal("existing CA overwritten")
+	}
+	for _, name := range names {
+		if err := Issue(dir, name, []string{"127.0.0.1", "localhost"}, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func nodeConfig(dir, name string) Config {
+	return Config{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+		CAFile:   filepath.Join(dir, CACert),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		config Config
+		valid  bool
+	}{
+		{Config{}, true},
+		{Config{CertFile: "a", KeyFile: "b", CAFile: "c", PeerAuth: true}, true},
+		{Config{CertFile: "a", KeyFile: "b"}, false},
+		{Config{PeerAuth: true}, false},
+	} {
+		if err := c.config.Validate(); (err == nil) != c.valid {
+			t.Errorf("%+v: %v", c.config, err)
+		}
+	}
+}
+
+// The server names the peer of a verified client certificate, and no one
+// when a client sends none.
+func TestPeerName(t *testing.T) {
+	dir := issue(t, "node1", "node2")
+	server, _, err := nodeConfig(dir, "node1").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, client, err := nodeConfig(dir, "node2").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(PeerName(req)))
+	}))
+	ts.TLS = server
+	ts.StartTLS()
+	defer ts.Close()
+
+	anonymous, err := ClientConfig(filepath.Join(dir, CACert), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want, config := range map[string]*tls.Config{"node2": client, "": anonymous} {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(name) != want {
+			t.Errorf("peer %q, want %q", name, want)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+package raft
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the versioned API. Routes without it are deprecated aliases,
+// except for the traffic between nodes.
+const apiPrefix = "/v1/"
+
+// The published schema of the v1 API.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// Stable error codes of the v1 API. Clients branch on these, messages may
+// change.
+const (
+	CodeInvalidArgument  = "invalid_argument"
+	CodeUnauthenticated  = "unauthenticated"
+	CodePermissionDenied = "permission_denied"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeCursorExpired    = "cursor_expired"
+	CodeTooLarge         = "payload_too_large"
+	CodePoolFull         = "pool_full"
+	CodeNotLeader        = "not_leader"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// An error of the v1 API. Leader is set with not_leader and unavailable
+// while a leader is known.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Leader  string `json:"leader,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, a ...interface{}) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidArgument, Message: fmt.Sprintf(format, a...)}
+}
+
+func notFound(format string, a ...interface{}) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: fmt.Sprintf(format, a...)}
+}
+
+func conflict(format string, a ...interface{}) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeConflict, Message: fmt.Sprintf(format, a...)}
+}
+
+// toAPIError maps the errors of the store, the pool and the engine to
+// their codes. Anything else is internal.
+func toAPIError(err error) *APIError {
+	var e *APIError
+	status, code := http.StatusInternalServerError, CodeInternal
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, store.ErrNotFound):
+		status, code = http.StatusNotFound, CodeNotFound
+	case errors.Is(err, mempool.ErrDuplicate), errors.Is(err, mempool.ErrOnChain):
+		status, code = http.StatusConflict, CodeConflict
+	case errors.Is(err, mempool.ErrTooLarge):
+		status, code = http.StatusRequestEntityTooLarge, CodeTooLarge
+	case errors.Is(err, mempool.ErrFull):
+		status, code = http.StatusTooManyRequests, CodePoolFull
+	case errors.Is(err, consensus.ErrNotLeader):
+		status, code = http.StatusServiceUnavailable, CodeNotLeader
+	case errors.Is(err, consensus.ErrStopped):
+		status, code = http.StatusServiceUnavailable, CodeUnavailable
+	}
+	return &APIError{Status: status, Code: code, Message: err.Error()}
+}
+
+// The body of every v1 response: data on success, error otherwise.
+type Envelope struct {
+	Data  interface{} `json:"data,omitempty"`
+	Error *APIError   `json:"error,omitempty"`
+}
+
+func isV1(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, apiPrefix)
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, env Envelope) {
+	resp, err := json.Marshal(env)
+	if err != nil {
+		status = http.StatusInternalServerError
+		resp, _ = json.Marshal(Envelope{Error: &APIError{Code: CodeInternal, Message: err.Error()}})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// writeError answers v1 requests with an envelope and the deprecated
+// routes with the plain message they always sent.
+func writeError(w http.ResponseWriter, req *http.Request, e *APIError) {
+	if !isV1(req) {
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+	writeEnvelope(w, e.Status, Envelope{Error: e})
+}
+
+// A v1 handler returns the data of the response or an error.
+type apiFunc func(req *http.Request) (interface{}, error)
+
+// Returned by v1 handlers which answer with another status than 200.
+type withStatus struct {
+	status   int
+	location string
+	data     interface{}
+}
+
+func accepted(v interface{}) withStatus {
+	return withStatus{status: http.StatusAccepted, data: v}
+}
+
+func created(location string, v interface{}) withStatus {
+	return withStatus{status: http.StatusCreated, location: location, data: v}
+}
+
+// api serves a v1 handler.
+func (s *Server) api(h apiFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		v, err := h(req)
+		if err != nil {
+			e := toAPIError(err)
+			if e.Status >= http.StatusInternalServerError {
+				logging.Warn("request failed", "path", req.URL.Path, "code", e.Code, "err", err)
+			} else {
+				logging.Debug("request rejected", "path", req.URL.Path, "code", e.Code, "err", err)
+			}
+			writeError(w, req, e)
+			return
+		}
+		status := http.StatusOK
+		if ws, ok := v.(withStatus); ok {
+			if ws.location != "" {
+				w.Header().Set("Location", ws.location)
+			}
+			status, v = ws.status, ws.data
+		}
+		writeEnvelope(w, status, Envelope{Data: v})
+	}
+}
+
+// deprecated marks a route kept for clients of the unversioned API.
+func deprecated(successor string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		h(w, req)
+	}
+}
+
+func notFoundHandler(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, notFound("no route for %s", req.URL.Path))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, &APIError{
+		Status:  http.StatusMethodNotAllowed,
+		Code:    CodeMethodNotAllowed,
+		Message: req.Method + " is not allowed on " + req.URL.Path,
+	})
+}
+
+func decodeBody(req *http.Request, v interface{}) error {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func pathInt(req *http.Request, name string) (int, error) {
+	n, err := strconv.Atoi(mux.Vars(req)[name])
+	if err != nil {
+		return 0, badRequest("invalid %s: %s", name, mux.Vars(req)[name])
+	}
+	return n, nil
+}
+
+// The current height of the chain.
+type HeightResponse struct {
+	Height int `json:"height"`
+}
+
+type LeaderResponse struct {
+	Name             string `json:"name"`
+	ConnectionString string `json:"connection_string"`
+}
+
+// A tx with its place on the chain.
+type LocatedTx struct {
+	Height      int          `json:"height"`
+	TxId        int          `json:"tx_id"`
+	Transaction data.BasicTx `json:"transaction"`
+}
+
+// Answer to a tx write. Height and TxId are set once the tx is on the
+// chain.
+type TxReceipt struct {
+	Hash   string `json:"hash"`
+	Status string `json:"status"`
+	Height *int   `json:"height,omitempty"`
+	TxId   *int   `json:"tx_id,omitempty"`
+}
+
+type BlockReceipt struct {
+	Height   int    `json:"height"`
+	HashRoot string `json:"hash_root"`
+}
+
+// Statuses of a TxReceipt.
+const (
+	TxPending  = "pending"
+	TxModified = "modified"
+)
+
+// block returns the block at height, not_found above the top.
+func (s *Server) block(height int) (*data.BasicBlock, error) {
+	top, err := s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	if height < 0 || height > top {
+		return nil, notFound("no block at height %d, the chain ends at %d", height, top)
+	}
+	return s.store.GetBlock(height)
+}
+
+func (s *Server) tx(height, txId int) (*data.BasicTx, error) {
+	block, err := s.block(height)
+	if err != nil {
+		return nil, err
+	}
+	if txId < 0 || txId >= block.HeadB.TxCount {
+		return nil, notFound("block %d has no transaction %d", height, txId)
+	}
+	tx := block.Transactions(txId)
+	return &tx, nil
+}
+
+// Client function
+// call sends a request to the v1 API and decodes the data of the answer
+// into v. Like post, it follows redirects to the leader and retries while
+// the cluster has no leader. Errors of the API are *APIError.
+func call(method, u string, content []byte, v interface{}) error {
+	return callAs("", method, u, content, v)
+}
+
+// callAs is call on behalf of a client, a node passes its Authorization
+// header on. auth may be empty.
+func callAs(auth, method, u string, content []byte, v interface{}) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if content != nil {
+			body = bytes.NewReader(content)
+		}
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			return err
+		}
+		if content != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		if attempt > 0 && method != http.MethodGet {
+			req.Header.Set(retryHeader, strconv.Itoa(attempt))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		env := struct {
+			Data  json.RawMessage `json:"data"`
+			Error *APIError       `json:"error"`
+		}{}
+		if err = json.Unmarshal(res, &env); err != nil {
+			return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(res)))
+		}
+		if env.Error != nil {
+			env.Error.Status = resp.StatusCode
+			if resp.StatusCode == http.StatusServiceUnavailable && attempt < 5 {
+				time.Sleep(backoff)
+				backoff *= 2
+				continue
+			}
+			return env.Error
+		}
+		if v == nil || len(env.Data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(env.Data, v)
+	}
+}
+
+// getV1 reads u with consistency, "" leaves the server default.
+func getV1(consistency, u string, v interface{}) error {
+	return call(http.MethodGet, readURL(u, consistency), nil, v)
+}
+
+// sendV1 sends v as JSON and returns the data of the answer as JSON.
+func sendV1(method, u string, v interface{}) ([]byte, error) {
+	var content []byte
+	if v != nil {
+		var err error
+		if content, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var res json.RawMessage
+	if err := call(method, u, content, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Server handler
+func (s *Server) apiSchemaHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+func (s *Server) apiHeight(req *http.Request) (interface{}, error) {
+	height, err := s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	return HeightResponse{Height: height}, nil
+}
+
+func (s *Server) apiLeader(req *http.Request) (interface{}, error) {
+	leader := s.engine.Leader()
+	if leader.ConnectionString == "" {
+		return nil, &APIError{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "no leader available"}
+	}
+	return LeaderResponse{Name: leader.Name, ConnectionString: leader.ConnectionString}, nil
+}
+
+func (s *Server) apiBlock(req *http.Request) (interface{}, error) {
+	height, err := pathInt(req, "height")
+	if err != nil {
+		return nil, err
+	}
+	return s.block(height)
+}
+
+func (s *Server) apiTx(req *http.Request) (interface{}, error) {
+	height, err := pathInt(req, "height")
+	if err != nil {
+		return nil, err
+	}
+	txId, err := pathInt(req, "txId")
+	if err != nil {
+		return nil, err
+	}
+	return s.tx(height, txId)
+}
+
+func (s *Server) apiTxByHash(req *http.Request) (interface{}, error) {
+	hash := strings.ToLower(mux.Vars(req)["hash"])
+	start, err := queryInt(req, "start_height", 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.txByHash(hash, start)
+}
+
+// txByHash finds a committed tx at or above height start.
+func (s *Server) txByHash(hash string, start int) (LocatedTx, error) {
+	loc, err := index.LookupTx(s.store, hash)
+	if err == store.ErrNotFound || (err == nil && loc.InPool) {
+		return LocatedTx{}, notFound("transaction %s is not on the chain", hash)
+	} else if err != nil {
+		return LocatedTx{}, err
+	}
+	if loc.Height < start {
+		return LocatedTx{}, notFound("transaction %s is below height %d", hash, start)
+	}
+	tx, err := s.tx(loc.Height, loc.TxId)
+	if err != nil {
+		return LocatedTx{}, err
+	}
+	return LocatedTx{Height: loc.Height, TxId: loc.TxId, Transaction: *tx}, nil
+}
+
+func (s *Server) apiAddTx(req *http.Request) (interface{}, error) {
+	tx := &data.BasicTx{}
+	if err := decodeBody(req, tx); err != nil {
+		return nil, err
+	}
+	priority, err := queryInt(req, "priority", 0)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := s.addTx(tx, priority)
+	if txApplied(req, err) {
+		receipt, err = TxReceipt{Hash: fmt.Sprintf("%x", tx.HashVal()), Status: TxPending}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return accepted(receipt), nil
+}
+
+// addTx proposes a tx after checking it. Must run on the leader.
+func (s *Server) addTx(tx *data.BasicTx, priority int) (TxReceipt, error) {
+	para, _, _, err := store.ChameleonParameter(s.store)
+	if err != nil {
+		return TxReceipt{}, err
+	}
+	if !tx.Verify(para) {
+		return TxReceipt{}, badRequest("invalid transaction")
+	}
+	if _, err = s.engine.Propose(NewAddTxCommand(*tx, para, time.Now().Unix(), priority)); err != nil {
+		return TxReceipt{}, err
+	}
+	return TxReceipt{Hash: fmt.Sprintf("%x", tx.HashVal()), Status: TxPending}, nil
+}
+
+func (s *Server) apiModifyTx(req *http.Request) (interface{}, error) {
+	height, err := pathInt(req, "height")
+	if err != nil {
+		return nil, err
+	}
+	txId, err := pathInt(req, "txId")
+	if err != nil {
+		return nil, err
+	}
+	tx := &data.BasicTx{}
+	if err = decodeBody(req, tx); err != nil {
+		return nil, err
+	}
+	return s.modifyTx(height, txId, tx)
+}
+
+// modifyTx proposes the redaction of a committed tx after checking it,
+// announced to the webhooks first. Must run on the leader.
+func (s *Server) modifyTx(height, txId int, tx *data.BasicTx) (TxReceipt, error) {
+	old, err := s.tx(height, txId)
+	if err != nil {
+		return TxReceipt{}, err
+	}
+	if !bytes.Equal(old.HashVal(), tx.HashVal()) {
+		return TxReceipt{}, badRequest("the new transaction has another hash than transaction %d of block %d", txId, height)
+	}
+	para, _, _, err := store.ChameleonParameter(s.store)
+	if err != nil {
+		return TxReceipt{}, err
+	}
+	if !tx.Verify(para) {
+		return TxReceipt{}, badRequest("invalid transaction")
+	}
+	now := time.Now().Unix()
+	n, err := newNotification(HookRedactionProposed, now, height, txId, tx)
+	if err != nil {
+		return TxReceipt{}, err
+	}
+	if _, err = s.engine.Propose(&NotifyCommand{Notification: n}); err != nil {
+		return TxReceipt{}, err
+	}
+	if _, err = s.engine.Propose(NewModifyCommand(height, txId, *tx, para, now)); err != nil {
+		return TxReceipt{}, err
+	}
+	return TxReceipt{Hash: fmt.Sprintf("%x", tx.HashVal()), Status: TxModified, Height: &height, TxId: &txId}, nil
+}
+
+func (s *Server) apiAddBlock(req *http.Request) (interface{}, error) {
+	block := &data.BasicBlock{}
+	if err := decodeBody(req, block); err != nil {
+		return nil, err
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	if block.HeadB.Height != top+1 && !s.blockApplied(req, block) {
+		return nil, conflict("block height %d, the next block is %d", block.HeadB.Height, top+1)
+	}
+	if !block.Verify() {
+		return nil, badRequest("block does not match its hash root")
+	}
+	if err = s.Policy().Check(block); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if block.HeadB.Height == top+1 {
+		// the leader vouches for the block it proposes
+		block.Seal(s.identity.Name, s.identity.PublicKey, s.identity.Sign)
+		_, err = s.engine.Propose(NewPackCommand(*block))
+		if err != nil && !s.blockApplied(req, block) {
+			return nil, err
+		}
+	}
+	height := block.HeadB.Height
+	return created(apiPrefix+"blocks/"+strconv.Itoa(height), BlockReceipt{
+		Height:   height,
+		HashRoot: fmt.Sprintf("%x", block.HeadB.HashRoot),
+	}), nil
+}
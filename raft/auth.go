@@ -0,0 +1,671 @@
+package raft
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/pki"
+	"github.com/RedactableBlockChain/store"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Meta key of the replicated principals.
+const principalsKey = "auth_principals"
+
+// Files in the data path.
+const (
+	adminTokenFile = "admin_token"
+	auditFile      = "audit.log"
+)
+
+// What a principal may do through the API.
+type Role string
+
+const (
+	// Query blocks, transactions and the cluster.
+	RoleReader Role = "reader"
+	// Add transactions.
+	RoleSubmitter Role = "submitter"
+	// Modify committed transactions.
+	RoleRedactor Role = "redactor"
+	// Submit whole blocks.
+	RoleBlockProducer Role = "block-producer"
+	// Change the policy, the membership and the principals. Holds every
+	// other role.
+	RoleAdmin Role = "admin"
+	// Traffic between nodes, authenticated by certificate; no principal
+	// holds it.
+	rolePeer Role = "peer"
+)
+
+var roles = []Role{RoleReader, RoleSubmitter, RoleRedactor, RoleBlockProducer, RoleAdmin}
+
+func ValidRole(r Role) error {
+	for _, known := range roles {
+		if r == known {
+			return nil
+		}
+	}
+	return errors.New("unknown role: " + string(r))
+}
+
+// The role each route requires, by method and path template. Routes
+// installed through HandleFunc carry consensus traffic and are peer
+// routes, every other route missing here is for admins only.
+var routeRoles = map[string]Role{
+	"GET /get_transaction_by_hash/{hash}/{startHeight}": RoleReader,
+	"GET /get_transaction_by_index/{height}/{txId}":     RoleReader,
+	"GET /get_block_by_height/{height}":                 RoleReader,
+	"GET /get_current_height":                           RoleReader,
+	"GET /get_current_leader":                           RoleReader,
+	"GET /transactions":                                 RoleReader,
+	"GET /blocks_by_time":                               RoleReader,
+	"GET /search":                                       RoleReader,
+	"GET /mempool":                                      RoleReader,
+	"GET /policy":                                       RoleReader,
+	"GET /cluster":                                      RoleReader,
+	"GET /keys":                                         RoleReader,
+	"GET /certified_block/{height}":                     RoleReader,
+	"POST /new_transaction":                             RoleSubmitter,
+	"POST /modify/{height}/{txId}":                      RoleRedactor,
+	"POST /new_block":                                   RoleBlockProducer,
+	"POST /policy":                                      RoleAdmin,
+	"POST /remove/{name}":                               RoleAdmin,
+	"POST /leave":                                       RoleAdmin,
+	"GET /principals":                                   RoleAdmin,
+	"POST /principals/{name}":                           RoleAdmin,
+	"POST /principals/{name}/revoke":                    RoleAdmin,
+	"GET /v1/openapi.json":                              RoleReader,
+	"GET /v1/height":                                    RoleReader,
+	"GET /v1/leader":                                    RoleReader,
+	"GET /v1/blocks":                                    RoleReader,
+	"GET /v1/blocks/by_time":                            RoleReader,
+	"GET /v1/blocks/{height:[0-9]+}":                    RoleReader,
+	"GET /v1/blocks/{height:[0-9]+}/certificate":        RoleReader,
+	"GET /v1/blocks/{height:[0-9]+}/transactions/{txId:[0-9]+}": RoleReader,
+	"GET /v1/transactions":         RoleReader,
+	"GET /v1/transactions/{hash}":  RoleReader,
+	"GET /v1/search":               RoleReader,
+	"GET /v1/mempool/transactions": RoleReader,
+	"GET /v1/mempool":              RoleReader,
+	"GET /v1/mempool/config":       RoleReader,
+	"GET /v1/policy":               RoleReader,
+	"GET /v1/cluster":              RoleReader,
+	"GET /v1/keys":                 RoleReader,
+	"GET /v1/events":               RoleReader,
+	"GET /v1/events/ws":            RoleReader,
+	"POST /v1/transactions":        RoleSubmitter,
+	"PUT /v1/blocks/{height:[0-9]+}/transactions/{txId:[0-9]+}": RoleRedactor,
+	"POST /v1/blocks":                            RoleBlockProducer,
+	"PUT /v1/policy":                             RoleAdmin,
+	"PUT /v1/mempool/config":                     RoleAdmin,
+	"DELETE /v1/cluster/members/{name}":          RoleAdmin,
+	"POST /v1/leave":                             RoleAdmin,
+	"GET /v1/principals":                         RoleAdmin,
+	"PUT /v1/principals/{name}":                  RoleAdmin,
+	"DELETE /v1/principals/{name}":               RoleAdmin,
+	"GET /v1/webhooks":                           RoleAdmin,
+	"GET /v1/webhooks/outbox":                    RoleAdmin,
+	"GET /v1/webhooks/dead_letters":              RoleAdmin,
+	"PUT /v1/webhooks/{name}":                    RoleAdmin,
+	"DELETE /v1/webhooks/{name}":                 RoleAdmin,
+	"POST /v1/webhooks/dead_letters/{key}/retry": RoleAdmin,
+	"GET /read_index":                            rolePeer,
+	"GET /status":                                rolePeer,
+	"GET /genesis":                               rolePeer,
+	"GET /sync/blocks/{height:[0-9]+}":           rolePeer,
+	"POST /join":                                 rolePeer,
+	"POST /keys":                                 rolePeer,
+	"POST /vote":                                 rolePeer,
+}
+
+// A holder of an API token. Only the SHA-256 of the token is replicated,
+// the token itself is handed out once when it is created.
+type Principal struct {
+	Name      string `json:"name"`
+	TokenHash string `json:"token_hash,omitempty"`
+	Roles     []Role `json:"roles"`
+}
+
+// Has reports whether p may act as r. Every principal may read.
+func (p *Principal) Has(r Role) bool {
+	for _, held := range p.Roles {
+		if held == r || held == RoleAdmin {
+			return true
+		}
+	}
+	return r == RoleReader && len(p.Roles) > 0
+}
+
+// The principals of the cluster by name. While there are none the API is
+// open, as before authentication existed.
+type Principals map[string]Principal
+
+func loadPrincipals(st store.Store) (Principals, error) {
+	ps := Principals{}
+	err := st.GetMeta(principalsKey, &ps)
+	if err == store.ErrNotFound {
+		return Principals{}, nil
+	}
+	return ps, err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// lookup finds the principal holding token.
+func (ps Principals) lookup(token string) (Principal, bool) {
+	hash := []byte(hashToken(token))
+	for _, p := range ps {
+		if subtle.ConstantTimeCompare(hash, []byte(p.TokenHash)) == 1 {
+			return p, true
+		}
+	}
+	return Principal{}, false
+}
+
+func (ps Principals) admins() int {
+	n := 0
+	for _, p := range ps {
+		for _, r := range p.Roles {
+			if r == RoleAdmin {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+func (s *Server) Principals() Principals {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.principals
+}
+
+func (s *Server) setPrincipals(ps Principals) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.principals = ps
+}
+
+// Creates an admin token when this node starts a new cluster, written to
+// admin_token in the data path. Nodes take each other's consensus traffic
+// by certificate once tokens are required, so it needs peer certificates,
+// see SetTLS. Must be called after SetTLS and before ListenAndServe.
+func (s *Server) EnableAuth() error {
+	if !s.peerAuth {
+		return errAuthWithoutPeerAuth
+	}
+	s.authBootstrap = true
+	return nil
+}
+
+var errAuthWithoutPeerAuth = errors.New("authentication requires peer certificates")
+
+// bootstrapAuth creates the first admin of a new cluster.
+func (s *Server) bootstrapAuth() error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	cmd := &SetPrincipalCommand{Name: "admin", TokenHash: hashToken(token), Roles: []Role{RoleAdmin}}
+	if _, err = s.engine.Propose(cmd); err != nil {
+		return err
+	}
+	path := filepath.Join(s.path, adminTokenFile)
+	if err = ioutil.WriteFile(path, []byte(token), 0600); err != nil {
+		return err
+	}
+	logging.Info("admin token created", "path", path)
+	return nil
+}
+
+// Appends one JSON line per authorization decision.
+type auditLog struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal"`
+	Role      Role      `json:"role"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Remote    string    `json:"remote"`
+	Allowed   bool      `json:"allowed"`
+	Status    int       `json:"status"`
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f}, nil
+}
+
+func (a *auditLog) record(e AuditEntry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, err = a.file.Write(append(line, '\n')); err != nil {
+		logging.Warn("audit log write failed", "err", err)
+	}
+}
+
+// Keeps the status a handler answered with, for the audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Event streams flush and upgrade through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// routeRole returns the role the matched route of req requires.
+func (s *Server) routeRole(req *http.Request) Role {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return RoleAdmin
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return RoleAdmin
+	}
+	if r, ok := routeRoles[req.Method+" "+tmpl]; ok {
+		return r
+	}
+	if s.peerRoutes[tmpl] {
+		return rolePeer
+	}
+	return RoleAdmin
+}
+
+func bearerToken(req *http.Request) string {
+	h := req.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[len("Bearer "):])
+}
+
+// authorize is the router middleware which enforces the roles of the
+// replicated principals and records the decisions in the audit log.
+// Peer routes take nodes of the cluster by certificate, or an admin
+// token. Consensus traffic is only recorded when it is denied.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		principals := s.Principals()
+		if len(principals) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		role := s.routeRole(req)
+		entry := AuditEntry{
+			Time:   time.Now().UTC(),
+			Role:   role,
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Remote: req.RemoteAddr,
+		}
+		var denied *APIError
+		if token := bearerToken(req); token != "" {
+			if p, ok := principals.lookup(token); ok {
+				entry.Principal = p.Name
+				entry.Allowed = p.Has(role)
+				if !entry.Allowed {
+					denied = permissionDenied(p, role)
+				}
+			} else {
+				denied = errUnauthenticated
+			}
+		} else if role == rolePeer && s.peerAuth && pki.PeerName(req) != "" {
+			next.ServeHTTP(w, req)
+			return
+		} else {
+			denied = errUnauthenticated
+		}
+
+		if denied != nil {
+			entry.Status = denied.Status
+			s.audit.record(entry)
+			logging.Warn("request denied", "path", req.URL.Path, "principal", entry.Principal, "role", role, "remote", req.RemoteAddr)
+			if denied == errUnauthenticated {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="RedactableBlockChain"`)
+			}
+			writeError(w, req, denied)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+		entry.Status = rec.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		s.audit.record(entry)
+	})
+}
+
+var errUnauthenticated = &APIError{
+	Status:  http.StatusUnauthorized,
+	Code:    CodeUnauthenticated,
+	Message: "valid bearer token required",
+}
+
+func permissionDenied(p Principal, role Role) *APIError {
+	return &APIError{
+		Status:  http.StatusForbidden,
+		Code:    CodePermissionDenied,
+		Message: fmt.Sprintf("%s lacks role %s", p.Name, role),
+	}
+}
+
+// Returned by principal commands which would leave the cluster without
+// an admin.
+var errLastAdmin = &APIError{
+	Status:  http.StatusConflict,
+	Code:    CodeConflict,
+	Message: "the cluster needs an admin",
+}
+
+// This command creates or updates a principal. An empty token hash keeps
+// the token of an existing principal.
+type SetPrincipalCommand struct {
+	Name      string `json:"name"`
+	TokenHash string `json:"token_hash"`
+	Roles     []Role `json:"roles"`
+}
+
+// The name of the command in the log.
+func (c *SetPrincipalCommand) CommandName() string {
+	return "Set Principal"
+}
+
+func (c *SetPrincipalCommand) Validate() error {
+	if c.Name == "" {
+		return errors.New("principal needs a name")
+	}
+	if len(c.Roles) == 0 {
+		return errors.New("principal needs a role")
+	}
+	for _, r := range c.Roles {
+		if err := ValidRole(r); err != nil {
+			return err
+		}
+	}
+	if c.TokenHash != "" {
+		if b, err := hex.DecodeString(c.TokenHash); err != nil || len(b) != sha256.Size {
+			return errors.New("invalid token hash")
+		}
+	}
+	return nil
+}
+
+func (c *SetPrincipalCommand) Execute(state interface{}) (interface{}, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	st := storeOf(state)
+	ps, err := loadPrincipals(st)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := ps[c.Name]
+	if !ok && c.TokenHash == "" {
+		return nil, errors.New("new principal " + c.Name + " needs a token")
+	}
+	next := Principals{}
+	for name, q := range ps {
+		next[name] = q
+	}
+	p.Name = c.Name
+	p.Roles = c.Roles
+	if c.TokenHash != "" {
+		p.TokenHash = c.TokenHash
+	}
+	next[c.Name] = p
+	if ps.admins() > 0 && next.admins() == 0 {
+		return nil, errLastAdmin
+	}
+	if err = st.PutMeta(principalsKey, next); err != nil {
+		return nil, err
+	}
+	chainOf(state).setPrincipals(next)
+	logging.Info("principal set", "name", c.Name, "roles", c.Roles)
+	return nil, nil
+}
+
+// This command removes a principal and with it their token.
+type RevokePrincipalCommand struct {
+	Name string `json:"name"`
+}
+
+// The name of the command in the log.
+func (c *RevokePrincipalCommand) CommandName() string {
+	return "Revoke Principal"
+}
+
+func (c *RevokePrincipalCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	ps, err := loadPrincipals(st)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ps[c.Name]; !ok {
+		return nil, nil
+	}
+	next := Principals{}
+	for name, p := range ps {
+		if name != c.Name {
+			next[name] = p
+		}
+	}
+	if next.admins() == 0 {
+		return nil, errLastAdmin
+	}
+	if err = st.PutMeta(principalsKey, next); err != nil {
+		return nil, err
+	}
+	chainOf(state).setPrincipals(next)
+	logging.Info("principal revoked", "name", c.Name)
+	return nil, nil
+}
+
+// What the API answers when a principal is set: the token is only shown
+// when it was created.
+type Credential struct {
+	Name  string `json:"name"`
+	Roles []Role `json:"roles"`
+	Token string `json:"token,omitempty"`
+}
+
+// Client function
+// Sends token with every request of the process, which all go through
+// http.DefaultClient.
+func UseToken(token string) {
+	base := http.DefaultClient.Transport
+	if t, ok := base.(*tokenTransport); ok {
+		base = t.base
+	} else if base == nil {
+		base = http.DefaultTransport
+	}
+	http.DefaultClient.Transport = &tokenTransport{token: token, base: base}
+}
+
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+func GetPrincipals(host, consistency string) (list []Credential, err error) {
+	err = getV1(consistency, host+"/v1/principals", &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Sets the roles of a principal. A new principal, or one with rotate set,
+// gets a new token, which is returned.
+func SetPrincipal(host, name string, roles []Role, rotate bool) (c *Credential, err error) {
+	content, err := json.Marshal(principalRequest{Roles: roles, Rotate: rotate})
+	if err != nil {
+		return nil, err
+	}
+	c = &Credential{}
+	if err = call(http.MethodPut, host+"/v1/principals/"+url.PathEscape(name), content, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func RevokePrincipal(host, name string) (returnData []byte, err error) {
+	return sendV1(http.MethodDelete, host+"/v1/principals/"+url.PathEscape(name), nil)
+}
+
+type principalRequest struct {
+	Roles  []Role `json:"roles"`
+	Rotate bool   `json:"rotate"`
+}
+
+func (s *Server) principalList() []Credential {
+	list := []Credential{}
+	for _, p := range s.Principals() {
+		list = append(list, Credential{Name: p.Name, Roles: p.Roles})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// setPrincipal proposes the roles of r for name. The token is only
+// created, and returned, for a new principal or on rotation.
+func (s *Server) setPrincipal(name string, r principalRequest) (*Credential, error) {
+	cmd := &SetPrincipalCommand{Name: name, Roles: r.Roles}
+	c := &Credential{Name: cmd.Name, Roles: cmd.Roles}
+	if _, ok := s.Principals()[cmd.Name]; !ok || r.Rotate {
+		token, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		c.Token = token
+		cmd.TokenHash = hashToken(token)
+	}
+	if err := cmd.Validate(); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if _, err := s.engine.Propose(cmd); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Server handler
+func (s *Server) getPrincipalsHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, req, s.principalList(), nil)
+}
+
+func (s *Server) setPrincipalHandler(w http.ResponseWriter, req *http.Request) {
+	r := principalRequest{}
+	err := json.NewDecoder(req.Body).Decode(&r)
+	var c *Credential
+	if err == nil {
+		c, err = s.setPrincipal(mux.Vars(req)["name"], r)
+	}
+	writeJSON(w, req, c, err)
+}
+
+func (s *Server) revokePrincipalHandler(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	if _, err := s.engine.Propose(&RevokePrincipalCommand{Name: name}); err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("Success:Principal " + name + " revoked"))
+}
+
+func (s *Server) apiPrincipals(req *http.Request) (interface{}, error) {
+	return s.principalList(), nil
+}
+
+func (s *Server) apiSetPrincipal(req *http.Request) (interface{}, error) {
+	r := principalRequest{}
+	if err := decodeBody(req, &r); err != nil {
+		return nil, err
+	}
+	return s.setPrincipal(mux.Vars(req)["name"], r)
+}
+
+func (s *Server) apiRevokePrincipal(req *http.Request) (interface{}, error) {
+	name := mux.Vars(req)["name"]
+	if _, err := s.engine.Propose(&RevokePrincipalCommand{Name: name}); err != nil {
+		return nil, err
+	}
+	return map[string]string{"revoked": name}, nil
+}
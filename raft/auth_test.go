@@ -0,0 +1,60 @@
+package raft
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Once tokens are required, peer routes take a verified peer certificate
+// or a token, never a request without credentials.
+func TestPeerRoutesNeedCredentials(t *testing.T) {
+	s, _ := newTestServer(t)
+	if err := s.EnableAuth(); err == nil {
+		t.Fatal("authentication enabled without peer certificates")
+	}
+	token := "secret"
+	s.setPrincipals(Principals{"admin": {Name: "admin", TokenHash: hashToken(token), Roles: []Role{RoleAdmin}}})
+	router := mux.NewRouter()
+	router.Use(s.authorize)
+	router.HandleFunc("/vote", func(w http.ResponseWriter, req *http.Request) {}).Methods("POST")
+
+	peer := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "node2"}}}}}
+	for _, c := range []struct {
+		name     string
+		peerAuth bool
+		cert     bool
+		token    string
+		status   int
+	}{
+		{"anonymous", false, false, "", http.StatusUnauthorized},
+		{"anonymous with peer auth", true, false, "", http.StatusUnauthorized},
+		{"certificate", true, true, "", http.StatusOK},
+		{"token", false, false, token, http.StatusOK},
+		{"wrong token", true, true, "wrong", http.StatusUnauthorized},
+	} {
+		s.peerAuth = c.peerAuth
+		req := httptest.NewRequest("POST", "/vote", nil)
+		if c.cert {
+			req.TLS = peer
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, w.Code, c.status)
+		}
+	}
+
+	s.peerAuth = true
+	if err := s.EnableAuth(); err != nil {
+		t.Fatal(err)
+	}
+}
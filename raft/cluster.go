@@ -0,0 +1,198 @@
+package raft
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// How long the cluster view waits for each peer's status.
+const peerStatusTimeout = 2 * time.Second
+
+// What one node reports about itself.
+type NodeStatus struct {
+	Name             string `json:"name"`
+	ConnectionString string `json:"connection_string"`
+	State            string `json:"state"`
+	Leader           string `json:"leader"`
+	Term             uint64 `json:"term"`
+	CommitIndex      uint64 `json:"commit_index"`
+	Height           int    `json:"height"`
+	// The key which seals the node's blocks.
+	PublicKey ed25519.PublicKey `json:"public_key,omitempty"`
+	// Set instead of the fields above when the node did not answer.
+	Error string `json:"error,omitempty"`
+}
+
+// The cluster as seen from one node.
+type ClusterStatus struct {
+	Leader string       `json:"leader"`
+	Nodes  []NodeStatus `json:"nodes"`
+}
+
+func (s *Server) status() NodeStatus {
+	height, _ := s.store.Height()
+	status := s.engine.Status()
+	return NodeStatus{
+		Name:             status.Name,
+		ConnectionString: s.connectionString(),
+		State:            status.State,
+		Leader:           status.Leader,
+		Term:             status.Term,
+		CommitIndex:      status.CommitIndex,
+		Height:           height,
+		PublicKey:        s.identity.PublicKey,
+	}
+}
+
+// Removes a node from the cluster. Must run on the leader.
+func (s *Server) remove(name string) error {
+	known := false
+	for _, m := range s.engine.Members() {
+		known = known || m.Name == name
+	}
+	if !known {
+		return notFound("unknown node: %s", name)
+	}
+	if name == s.engine.Name() {
+		logging.Info("leaving cluster")
+	}
+	return s.engine.RemoveMember(name)
+}
+
+// Client function
+func GetCluster(host, consistency string) (cluster *ClusterStatus, err error) {
+	cluster = &ClusterStatus{}
+	err = getV1(consistency, host+"/v1/cluster", cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// Removes the named node, e.g. a dead one, through any node.
+func RemoveNode(host, name string) (returnData []byte, err error) {
+	return sendV1(http.MethodDelete, host+"/v1/cluster/members/"+url.PathEscape(name), nil)
+}
+
+// Makes the node at host leave the cluster and stop.
+func Leave(host string) (returnData []byte, err error) {
+	return sendV1(http.MethodPost, host+"/v1/leave", nil)
+}
+
+// Server handler
+func (s *Server) statusHandler(w http.ResponseWriter, req *http.Request) {
+	resp, err := json.Marshal(s.status())
+	if err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// cluster asks every peer for its status.
+func (s *Server) cluster() *ClusterStatus {
+	client := &http.Client{Timeout: peerStatusTimeout}
+	cluster := &ClusterStatus{Leader: s.engine.Leader().Name}
+	for _, m := range s.engine.Members() {
+		if m.Name == s.engine.Name() {
+			cluster.Nodes = append(cluster.Nodes, s.status())
+			continue
+		}
+		node := NodeStatus{Name: m.Name, ConnectionString: m.ConnectionString}
+		resp, err := client.Get(m.ConnectionString + "/status")
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				err = json.NewDecoder(resp.Body).Decode(&node)
+			} else {
+				err = errors.New(resp.Status)
+			}
+			resp.Body.Close()
+		}
+		if err != nil {
+			node.Error = err.Error()
+		}
+		cluster.Nodes = append(cluster.Nodes, node)
+	}
+	return cluster
+}
+
+// leave removes this node through the leader and, once the removal is
+// committed, shuts the node down: a node outside the cluster must neither
+// mint nor answer reads from its stale state. A follower passes the
+// credentials of the request on to the leader.
+func (s *Server) leave(req *http.Request) error {
+	if s.engine.IsLeader() {
+		if err := s.remove(s.engine.Name()); err != nil {
+			return err
+		}
+	} else {
+		leader := s.leaderURL()
+		if leader == "" {
+			return &APIError{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "no leader available"}
+		}
+		err := callAs(req.Header.Get("Authorization"), http.MethodDelete, leader+"/v1/cluster/members/"+url.PathEscape(s.engine.Name()), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	logging.Info("left cluster")
+	s.Shutdown()
+	return nil
+}
+
+func (s *Server) clusterHandler(w http.ResponseWriter, req *http.Request) {
+	resp, err := json.Marshal(s.cluster())
+	if err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *Server) removeHandler(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	if err := s.remove(name); err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("Success:Node " + name + " removed"))
+}
+
+func (s *Server) leaveHandler(w http.ResponseWriter, req *http.Request) {
+	if err := s.leave(req); err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("Success:Node " + s.engine.Name() + " left the cluster"))
+}
+
+func (s *Server) apiCluster(req *http.Request) (interface{}, error) {
+	return s.cluster(), nil
+}
+
+func (s *Server) apiRemoveMember(req *http.Request) (interface{}, error) {
+	name := mux.Vars(req)["name"]
+	if err := s.remove(name); err != nil {
+		return nil, err
+	}
+	return map[string]string{"removed": name}, nil
+}
+
+func (s *Server) apiLeave(req *http.Request) (interface{}, error) {
+	if err := s.leave(req); err != nil {
+		return nil, err
+	}
+	return map[string]string{"left": s.engine.Name()}, nil
+}
@@ -0,0 +1,34 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/consensus"
+)
+
+// A node which shut down, e.g. after leaving its cluster, stops its engine
+// and its background loops.
+func TestShutdown(t *testing.T) {
+	s, _ := newTestServer(t)
+	minted := make(chan struct{})
+	go func() {
+		s.Mint()
+		close(minted)
+	}()
+	s.Shutdown()
+	s.Shutdown()
+	select {
+	case <-minted:
+	case <-time.After(time.Second):
+		t.Fatal("mint loop still running")
+	}
+	select {
+	case <-s.finished:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not finish")
+	}
+	if state := s.engine.Status().State; state != consensus.Stopped {
+		t.Fatalf("engine %s", state)
+	}
+}
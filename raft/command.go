@@ -3,29 +3,47 @@ package raft
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"github.com/RedactableBlockChain/data"
-	"github.com/RedactableBlockChain/path"
-	"github.com/goraft/raft"
-	"log"
-	"os"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
 	"strconv"
 )
 
+// Commands run against the Server the consensus engine was created with.
+func chainOf(state interface{}) *Server {
+	return state.(*Server)
+}
+
+func storeOf(state interface{}) store.Store {
+	return chainOf(state).store
+}
+
+func poolOf(state interface{}) *mempool.Pool {
+	return chainOf(state).pool
+}
+
 // This command Modifys a transaction.
 type ModifyCommand struct {
 	BlockHeight        int          `json:"block-height"`
 	TxId               int          `json:"tx-id"`
 	NewTx              data.BasicTx `json:"new_tx"`
 	ChameleonParameter [][]byte     `json:"chameleon_parameter"`
+	// Unix seconds the proposing node accepted the redaction, the time of
+	// its webhook notification.
+	Proposed int64 `json:"proposed,omitempty"`
 }
 
 // Creates a new Modify command.
-func NewModifyCommand(height, txId int, newtx data.BasicTx, para [][]byte) *ModifyCommand {
+func NewModifyCommand(height, txId int, newtx data.BasicTx, para [][]byte, proposed int64) *ModifyCommand {
 	return &ModifyCommand{
 		BlockHeight:        height,
 		TxId:               txId,
 		NewTx:              newtx,
 		ChameleonParameter: para,
+		Proposed:           proposed,
 	}
 }
 
@@ -34,64 +52,107 @@ func (c *ModifyCommand) CommandName() string {
 	return "Modify Transaction"
 }
 
-// Modify a transaction.
-func (c *ModifyCommand) Apply(server raft.Server) (interface{}, error) {
+// Modify a transaction. The webhooks learn the outcome, after the leader
+// announced the proposal with a NotifyCommand.
+func (c *ModifyCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	event := HookTxModified
+	err := c.modify(st)
+	if err != nil {
+		event = HookRedactionRejected
+	}
+	n, nerr := newNotification(event, c.Proposed, c.BlockHeight, c.TxId, &c.NewTx)
+	if nerr == nil {
+		nerr = enqueue(st, n)
+	}
+	if nerr != nil {
+		if err == nil {
+			return nil, nerr
+		}
+		logging.Warn("redaction rejection not queued", "height", c.BlockHeight, "tx_id", c.TxId, "err", nerr)
+	}
+	return nil, err
+}
 
+func (c *ModifyCommand) modify(st store.Store) error {
 	para := c.ChameleonParameter
-	flag, err := data.CompareGolbalChameleonParameterWithLocal(para)
+	flag, err := store.CompareChameleonParameter(st, para)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if !flag {
-		return nil, errors.New("global chameleon parameter in Modify request diff from local")
+		return errors.New("global chameleon parameter in Modify request diff from local")
 	}
 
-	block := &data.BasicBlock{}
-	err = data.Load(block, path.GetBlockPath(c.BlockHeight))
+	block, err := st.GetBlock(c.BlockHeight)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if c.TxId < 0 || c.TxId >= block.HeadB.TxCount || c.TxId >= len(block.TransactionsB) {
+		return errors.New("block " + strconv.Itoa(c.BlockHeight) + " has no transaction " + strconv.Itoa(c.TxId))
 	}
 	old := block.Transactions(c.TxId)
 	tx := c.NewTx
 
 	if !bytes.Equal(old.HashVal(), tx.HashVal()) {
-		return nil, errors.New("new_tx and old_tx have different hash value")
+		return errors.New("new_tx and old_tx have different hash value")
 	}
 
 	if !tx.Verify(para) {
-		return nil, errors.New("invalid tx transaction")
+		return errors.New("invalid tx transaction")
 	}
 
 	err = block.ReplaceTx(tx, c.TxId)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = data.Write(block, path.GetBlockPath(c.BlockHeight))
+	err = index.RemoveTerms(st, c.BlockHeight, c.TxId, old.PayloadB)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	err = st.PutBlock(block)
+	if err != nil {
+		return err
+	}
+	err = index.AddTerms(st, c.BlockHeight, c.TxId, tx.PayloadB)
+	if err != nil {
+		return err
+	}
+	err = markRedacted(st, c.BlockHeight)
+	if err != nil {
+		return err
 	}
 
-	log.Printf(
-		"transaction %x at block /%d/%d has been modified.\n before: payload: %s\n proof: %s\n after: payload: %s\n proof: %s\n",
-		old.HashVal(), c.BlockHeight, c.TxId,
-		old.Payload(), old.Proof(),
-		tx.Payload(), tx.Proof())
+	logging.Info("transaction modified",
+		"hash", fmt.Sprintf("%x", old.HashVal()),
+		"height", c.BlockHeight,
+		"tx_id", c.TxId,
+		logging.Payload("before_payload", old.PayloadB),
+		logging.Payload("before_proof", old.ProofB),
+		logging.Payload("after_payload", tx.PayloadB),
+		logging.Payload("after_proof", tx.ProofB))
 
-	return nil, nil
+	return nil
 }
 
 // This command adds a new tx.
+// Arrival (unix seconds) is stamped by the proposing node so that the
+// mempool orders and expires txs the same way on every node.
 type AddTxCommand struct {
 	Transaction        data.BasicTx `json:"transaction"`
 	ChameleonParameter [][]byte     `json:"chameleon_parameter"`
+	Arrival            int64        `json:"arrival,omitempty"`
+	Priority           int          `json:"priority,omitempty"`
 }
 
 // Creates a new tx command.
-func NewAddTxCommand(tx data.BasicTx, para [][]byte) *AddTxCommand {
+func NewAddTxCommand(tx data.BasicTx, para [][]byte, arrival int64, priority int) *AddTxCommand {
 	return &AddTxCommand{
 		Transaction:        tx,
 		ChameleonParameter: para,
+		Arrival:            arrival,
+		Priority:           priority,
 	}
 }
 
@@ -101,10 +162,11 @@ func (c *AddTxCommand) CommandName() string {
 }
 
 // Writes a tx to Txpool.
-func (c *AddTxCommand) Apply(server raft.Server) (interface{}, error) {
+func (c *AddTxCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
 
 	para := c.ChameleonParameter
-	flag, err := data.CompareGolbalChameleonParameterWithLocal(para)
+	flag, err := store.CompareChameleonParameter(st, para)
 	if err != nil {
 		return nil, err
 	}
@@ -116,12 +178,16 @@ func (c *AddTxCommand) Apply(server raft.Server) (interface{}, error) {
 	if !tx.Verify(para) {
 		return nil, errors.New("invalid transaction")
 	}
-	err = data.Write(tx, path.GetPoolTxPath(tx.HashVal()))
+	err = poolOf(state).Add(tx, c.Arrival, c.Priority)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("new transaction. payload: %s ;proof: %s ; hk: %s \n", tx.Payload(), tx.Proof(), tx.ChameleonPk())
+	logging.Info("new transaction",
+		"hash", fmt.Sprintf("%x", tx.HashVal()),
+		"hk", string(tx.ChameleonPkB),
+		logging.Payload("payload", tx.PayloadB),
+		logging.Payload("proof", tx.ProofB))
 
 	return nil, nil
 }
@@ -143,11 +209,13 @@ func (c *PackCommand) CommandName() string {
 	return "Generate New Block"
 }
 
-//Pack some tx to a block.
-func (c *PackCommand) Apply(server raft.Server) (interface{}, error) {
+// Pack some tx to a block.
+func (c *PackCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	pool := poolOf(state)
 
 	para := c.BlockContent.HeadB.ChameleonParameter
-	flag, err := data.CompareGolbalChameleonParameterWithLocal(para)
+	flag, err := store.CompareChameleonParameter(st, para)
 	if err != nil {
 		return nil, err
 	}
@@ -155,16 +223,18 @@ func (c *PackCommand) Apply(server raft.Server) (interface{}, error) {
 		return nil, errors.New("global chameleon parameter in pack request diff from local")
 	}
 
-	top, err := data.GetCurrentBlockHeight()
+	top, err := st.Height()
 	if err != nil {
 		return nil, err
 	}
+	if c.BlockContent.HeadB.TxCount != len(c.BlockContent.TransactionsB) {
+		return nil, errors.New("block holds " + strconv.Itoa(len(c.BlockContent.TransactionsB)) + " transactions, its head counts " + strconv.Itoa(c.BlockContent.HeadB.TxCount))
+	}
 	if c.BlockContent.HeadB.Height != top+1 {
 		return nil, errors.New("New block height invalid!,Expect: " + strconv.Itoa(top+1) + " Get: " + strconv.Itoa(c.BlockContent.HeadB.Height))
 	}
 
-	prvBlock := &data.BasicBlock{}
-	err = data.Load(&prvBlock, path.GetBlockPath(top))
+	prvBlock, err := st.GetBlock(top)
 	if err != nil {
 		return nil, err
 	}
@@ -174,8 +244,7 @@ func (c *PackCommand) Apply(server raft.Server) (interface{}, error) {
 
 	for i := 0; i < c.BlockContent.HeadB.TxCount; i++ {
 		hash := c.BlockContent.TransactionsB[i].HashVal()
-		_, err = os.Stat(path.GetPoolTxPath(hash))
-		if err != nil && os.IsNotExist(err) {
+		if !pool.Has(hash) {
 			return nil, errors.New("transaction " + string(hash) + " does not exisit in pool")
 		}
 		if !c.BlockContent.TransactionsB[i].Verify(para) {
@@ -183,23 +252,41 @@ func (c *PackCommand) Apply(server raft.Server) (interface{}, error) {
 		}
 	}
 
+	err = chainOf(state).Policy().Check(&c.BlockContent)
+	if err != nil {
+		return nil, err
+	}
+	err = chainOf(state).checkSeal(&c.BlockContent)
+	if err != nil {
+		return nil, err
+	}
+
 	if !c.BlockContent.Verify() {
 		return nil, errors.New("invaild Block")
 	}
 
-	data.AddCurrentBlockHeight()
-	data.Write(c.BlockContent, path.GetBlockPath(c.BlockContent.HeadB.Height))
-
-	for i := 0; i < c.BlockContent.HeadB.TxCount; i++ {
-		hash := c.BlockContent.TransactionsB[i].HashVal()
-		os.Remove(path.GetPoolTxPath(hash))
-		if err != nil {
-			return nil, err
-		}
+	err = st.CommitBlock(&c.BlockContent)
+	if err != nil {
+		return nil, err
+	}
+	err = index.AddBlock(st, &c.BlockContent)
+	if err != nil {
+		return nil, err
+	}
+	err = pool.Packed(&c.BlockContent)
+	if err != nil {
+		return nil, err
+	}
+	err = pool.Expire(int64(c.BlockContent.HeadB.Timestamp))
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("new block generated. height: %d; timestamp: %d; hashRoot: %x ",
-		c.BlockContent.HeadB.Height, c.BlockContent.HeadB.Timestamp, c.BlockContent.HeadB.HashRoot)
+	logging.Info("new block generated",
+		"height", c.BlockContent.HeadB.Height,
+		"timestamp", c.BlockContent.HeadB.Timestamp,
+		"hash_root", fmt.Sprintf("%x", c.BlockContent.HeadB.HashRoot),
+		"tx_count", c.BlockContent.HeadB.TxCount)
 
 	return nil, nil
 }
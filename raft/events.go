@@ -0,0 +1,530 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of events.
+const (
+	// A block was committed.
+	EventBlock = "block"
+	// A tx entered the pool.
+	EventTx = "tx"
+	// A committed tx was modified.
+	EventRedaction = "redaction"
+)
+
+var eventTypes = []string{EventBlock, EventTx, EventRedaction}
+
+const (
+	// Events a node keeps for subscribers which resume from a cursor.
+	eventHistory = 4096
+	// Events a subscriber may fall behind before it is dropped.
+	eventBuffer = 256
+	// How often an idle stream shows it is alive.
+	eventKeepalive = 15 * time.Second
+	// How long a WebSocket write may take.
+	eventWriteTimeout = 10 * time.Second
+)
+
+// Something which happened to the chain. Cursor is the index of the
+// command in the consensus log, so it is the same on every node of a
+// goraft cluster.
+type Event struct {
+	Cursor uint64 `json:"cursor"`
+	Type   string `json:"type"`
+	// Height of a block, and of the tx of a redaction.
+	Height int  `json:"height,omitempty"`
+	TxId   *int `json:"tx_id,omitempty"`
+	// Hex hash of a tx.
+	Hash string `json:"hash,omitempty"`
+	// Head of a block and the hex hashes of its txs.
+	Head   *data.BasicHead `json:"head,omitempty"`
+	Hashes []string        `json:"hashes,omitempty"`
+	// A new tx, or a modified one as it is after the redaction.
+	Transaction *data.BasicTx `json:"transaction,omitempty"`
+
+	// chameleon public keys of the txs the event is about
+	pks []string
+}
+
+// Which events a subscriber gets. Empty fields match every event.
+type EventFilter struct {
+	Types []string
+	// Chameleon public key: txs and redactions of it, blocks holding one.
+	Pk string
+}
+
+func (f EventFilter) Validate() error {
+	for _, t := range f.Types {
+		known := false
+		for _, k := range eventTypes {
+			known = known || t == k
+		}
+		if !known {
+			return errors.New("unknown event type: " + t)
+		}
+	}
+	return nil
+}
+
+func (f EventFilter) match(e *Event) bool {
+	if len(f.Types) != 0 {
+		found := false
+		for _, t := range f.Types {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Pk == "" {
+		return true
+	}
+	for _, pk := range e.pks {
+		if pk == f.Pk {
+			return true
+		}
+	}
+	return false
+}
+
+func (f EventFilter) query() url.Values {
+	q := url.Values{}
+	if len(f.Types) != 0 {
+		q.Set("types", strings.Join(f.Types, ","))
+	}
+	if f.Pk != "" {
+		q.Set("pk", f.Pk)
+	}
+	return q
+}
+
+// eventsOf returns the events of a committed command.
+func eventsOf(c consensus.Committed) []Event {
+	switch cmd := c.Command.(type) {
+	case *PackCommand:
+		block := &cmd.BlockContent
+		head := block.HeadB
+		e := Event{Cursor: c.Index, Type: EventBlock, Height: head.Height, Head: &head}
+		for i := range block.TransactionsB {
+			tx := &block.TransactionsB[i]
+			e.Hashes = append(e.Hashes, fmt.Sprintf("%x", tx.HashVal()))
+			e.pks = append(e.pks, string(tx.ChameleonPkB))
+		}
+		return []Event{e}
+	case *AddTxCommand:
+		tx := cmd.Transaction
+		return []Event{{
+			Cursor:      c.Index,
+			Type:        EventTx,
+			Hash:        fmt.Sprintf("%x", tx.HashVal()),
+			Transaction: &tx,
+			pks:         []string{string(tx.ChameleonPkB)},
+		}}
+	case *ModifyCommand:
+		tx := cmd.NewTx
+		txId := cmd.TxId
+		return []Event{{
+			Cursor:      c.Index,
+			Type:        EventRedaction,
+			Height:      cmd.BlockHeight,
+			TxId:        &txId,
+			Hash:        fmt.Sprintf("%x", tx.HashVal()),
+			Transaction: &tx,
+			pks:         []string{string(tx.ChameleonPkB)},
+		}}
+	}
+	return nil
+}
+
+type eventSub struct {
+	c      chan Event
+	filter EventFilter
+}
+
+// The event bus of a node, fed by the commands it applies. It keeps the
+// last eventHistory events, so a subscriber may resume after the cursor
+// of the last event it got. The history keeps no tx payloads, which a
+// redaction may erase later; replayed events carry the tx as it is now,
+// see Server.payload. publish runs on the apply path and must not
+// block: a subscriber which falls eventBuffer events behind is dropped by
+// closing its channel, and resumes.
+type eventBus struct {
+	mutex   sync.Mutex
+	history []Event
+	// Cursors from horizon to last may be resumed from. Commands before
+	// the first one this node applied since it started, e.g. those in a
+	// snapshot, are beyond the horizon.
+	horizon uint64
+	last    uint64
+	started bool
+	subs    map[*eventSub]bool
+}
+
+func (b *eventBus) publish(c consensus.Committed) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.started && c.Index > 0 {
+		b.horizon = c.Index - 1
+		b.started = true
+	}
+	if c.Index > b.last {
+		b.last = c.Index
+	}
+	if c.Err != nil {
+		return
+	}
+	for _, e := range eventsOf(c) {
+		kept := e
+		kept.Transaction = nil
+		b.history = append(b.history, kept)
+		if len(b.history) > eventHistory {
+			b.horizon = b.history[0].Cursor
+			b.history = b.history[1:]
+		}
+		for sub := range b.subs {
+			if !sub.filter.match(&e) {
+				continue
+			}
+			select {
+			case sub.c <- e:
+			default:
+				delete(b.subs, sub)
+				close(sub.c)
+			}
+		}
+	}
+}
+
+// subscribe returns a subscription to the events matching filter and,
+// with resume, the kept events after cursor which match it.
+func (b *eventBus) subscribe(filter EventFilter, cursor uint64, resume bool) (*eventSub, []Event, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var backlog []Event
+	if resume {
+		if cursor < b.horizon || cursor > b.last {
+			return nil, nil, errCursorExpired
+		}
+		for i := range b.history {
+			if b.history[i].Cursor > cursor && filter.match(&b.history[i]) {
+				backlog = append(backlog, b.history[i])
+			}
+		}
+	}
+	if b.subs == nil {
+		b.subs = make(map[*eventSub]bool)
+	}
+	sub := &eventSub{c: make(chan Event, eventBuffer), filter: filter}
+	b.subs[sub] = true
+	return sub, backlog, nil
+}
+
+func (b *eventBus) unsubscribe(sub *eventSub) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.subs, sub)
+}
+
+var errCursorExpired = &APIError{
+	Status:  http.StatusGone,
+	Code:    CodeCursorExpired,
+	Message: "cursor is outside the event history of this node, read the chain and subscribe again",
+}
+
+// subscribeEvents subscribes with the filter of a stream request. The
+// cursor comes from the Last-Event-ID header of a reconnecting
+// EventSource, or the cursor parameter.
+func (s *Server) subscribeEvents(req *http.Request) (*eventSub, []Event, error) {
+	q := req.URL.Query()
+	filter := EventFilter{Pk: q.Get("pk")}
+	if types := q.Get("types"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, nil, badRequest("%v", err)
+	}
+	raw := req.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = q.Get("cursor")
+	}
+	var cursor uint64
+	if raw != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			return nil, nil, badRequest("invalid cursor: %s", raw)
+		}
+	}
+	sub, backlog, err := s.events.subscribe(filter, cursor, raw != "")
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range backlog {
+		if err = s.payload(&backlog[i]); err != nil {
+			s.events.unsubscribe(sub)
+			return nil, nil, err
+		}
+	}
+	return sub, backlog, nil
+}
+
+// payload adds the tx of a replayed event as the store holds it now: the
+// pooled or committed tx of a tx event, the tx at the position of a
+// redaction. An event whose tx changed or is gone since stays without.
+func (s *Server) payload(e *Event) error {
+	var tx *data.BasicTx
+	switch e.Type {
+	case EventTx:
+		if pooled, ok := s.pool.Get(e.Hash); ok {
+			tx = &pooled
+			break
+		}
+		loc, err := index.LookupTx(s.store, e.Hash)
+		if err == store.ErrNotFound || (err == nil && loc.InPool) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if tx, err = s.tx(loc.Height, loc.TxId); err != nil {
+			return err
+		}
+	case EventRedaction:
+		var err error
+		if tx, err = s.tx(e.Height, *e.TxId); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	if fmt.Sprintf("%x", tx.HashVal()) == e.Hash {
+		e.Transaction = tx
+	}
+	return nil
+}
+
+// Client function
+// SubscribeEvents calls fn with the events matching filter, after cursor
+// or, with cursor 0, from now on. A dropped stream is resumed after the
+// last event fn got. It returns the error of fn, or of the API, e.g. a
+// cursor_expired *APIError.
+func SubscribeEvents(host string, filter EventFilter, cursor uint64, fn func(Event) error) error {
+	resume := cursor != 0
+	var fnErr error
+	backoff := 100 * time.Millisecond
+	for failures := 0; ; failures++ {
+		got := false
+		err := streamEvents(host, filter, cursor, resume, func(e Event) error {
+			cursor, resume, got = e.Cursor, true, true
+			fnErr = fn(e)
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		var e *APIError
+		if errors.As(err, &e) && e.Status < http.StatusInternalServerError {
+			return err
+		}
+		if got {
+			failures, backoff = 0, 100*time.Millisecond
+		}
+		if failures == 5 {
+			return err
+		}
+		logging.Debug("event stream dropped, resuming", "cursor", cursor, "err", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// streamEvents reads one Server-Sent Events stream.
+func streamEvents(host string, filter EventFilter, cursor uint64, resume bool, fn func(Event) error) error {
+	q := filter.query()
+	if resume {
+		q.Set("cursor", strconv.FormatUint(cursor, 10))
+	}
+	req, err := http.NewRequest(http.MethodGet, host+apiPrefix+"events?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res, _ := ioutil.ReadAll(resp.Body)
+		env := struct {
+			Error *APIError `json:"error"`
+		}{}
+		if json.Unmarshal(res, &env) != nil || env.Error == nil {
+			return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(res)))
+		}
+		env.Error.Status = resp.StatusCode
+		return env.Error
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 64<<20)
+	var payload bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			payload.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case line == "" && payload.Len() > 0:
+			e := Event{}
+			if err = json.Unmarshal(payload.Bytes(), &e); err != nil {
+				return err
+			}
+			payload.Reset()
+			if err = fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("event stream closed")
+}
+
+// Server handler
+// eventsHandler streams events as Server-Sent Events, with the cursor as
+// event id. A subscriber which fell behind is disconnected and resumes
+// with Last-Event-ID.
+func (s *Server) eventsHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, req, &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "streaming unsupported"})
+		return
+	}
+	sub, backlog, err := s.subscribeEvents(req)
+	if err != nil {
+		writeError(w, req, toAPIError(err))
+		return
+	}
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(e Event) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Cursor, e.Type, b)
+		return err
+	}
+	for _, e := range backlog {
+		if err = send(e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.c:
+			if !ok {
+				logging.Debug("event subscriber fell behind", "remote", req.RemoteAddr)
+				return
+			}
+			if err = send(e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err = fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+var upgrader = websocket.Upgrader{}
+
+// eventsWSHandler streams events over a WebSocket, one JSON text message
+// per event. A subscriber which fell behind is closed with status 1013
+// and resumes with the cursor parameter.
+func (s *Server) eventsWSHandler(w http.ResponseWriter, req *http.Request) {
+	sub, backlog, err := s.subscribeEvents(req)
+	if err != nil {
+		writeError(w, req, toAPIError(err))
+		return
+	}
+	defer s.events.unsubscribe(sub)
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		logging.Debug("websocket upgrade failed", "remote", req.RemoteAddr, "err", err)
+		return
+	}
+	defer conn.Close()
+
+	// the client sends nothing, reading only notices it closing
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	send := func(e Event) error {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(e)
+	}
+	for _, e := range backlog {
+		if err = send(e); err != nil {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.c:
+			if !ok {
+				logging.Debug("event subscriber fell behind", "remote", req.RemoteAddr)
+				msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind, resume from the last cursor")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(eventWriteTimeout))
+				return
+			}
+			if err = send(e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package raft
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// Resumed streams replay txs as they are after a redaction, the history
+// does not keep the payload from before.
+func TestReplayAfterRedaction(t *testing.T) {
+	s, para := newTestServer(t)
+	s.engine.Subscribe(s.events.publish)
+	addAndPack(t, s, para, "secret-before")
+	tx, err := s.tx(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Modify([]byte("after"), []byte("proof"), para.Tk, chainParameter(para)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.modifyTx(1, 0, tx); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range s.events.history {
+		if e.Transaction != nil {
+			t.Fatalf("%s event keeps its tx in the history", e.Type)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/v1/events?cursor="+strconv.FormatUint(s.events.horizon, 10), nil)
+	sub, backlog, err := s.subscribeEvents(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.events.unsubscribe(sub)
+	replayed := map[string]bool{}
+	for _, e := range backlog {
+		if e.Type == EventBlock {
+			continue
+		}
+		if e.Transaction == nil || string(e.Transaction.PayloadB) != "after" {
+			t.Fatalf("%s event replayed with %+v", e.Type, e.Transaction)
+		}
+		replayed[e.Type] = true
+	}
+	if !replayed[EventTx] || !replayed[EventRedaction] {
+		t.Fatalf("replayed %v", replayed)
+	}
+}
@@ -0,0 +1,472 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/identity"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// How long a node waits for a peer to take its vote.
+	voteTimeout = 2 * time.Second
+	// Votes a peer did not take are sent again this often. A node keeps
+	// the latest maxPendingVotes for each peer.
+	voteRetry       = time.Second
+	maxPendingVotes = 1000
+	// Ballots of heights this far below the chain head are dropped, votes
+	// this far above it are rejected.
+	ballotWindow = 1000
+)
+
+// A node's signature on a committed block, and on the members and quorum
+// it counts the votes of the block among.
+type Vote struct {
+	Height    int               `json:"height"`
+	HashRoot  []byte            `json:"hash_root"`
+	Members   []string          `json:"members"`
+	Quorum    int               `json:"quorum"`
+	Name      string            `json:"name"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Signature []byte            `json:"signature"`
+}
+
+// What a vote signs. The hash root covers the transactions and, through
+// the previous root, the chain before the block.
+func voteBytes(height int, hashRoot []byte, members []string, quorum int) []byte {
+	names, _ := json.Marshal(members)
+	return []byte(fmt.Sprintf("commit block:%d:%x:%s:%d", height, hashRoot, names, quorum))
+}
+
+// newVote signs block as id, counting among the members of the cluster as
+// this node sees them.
+func (s *Server) newVote(id *identity.Identity, block *data.BasicBlock) Vote {
+	members, quorum := s.electorate()
+	return Vote{
+		Height:    block.HeadB.Height,
+		HashRoot:  block.HeadB.HashRoot,
+		Members:   members,
+		Quorum:    quorum,
+		Name:      id.Name,
+		PublicKey: id.PublicKey,
+		Signature: id.Sign(voteBytes(block.HeadB.Height, block.HeadB.HashRoot, members, quorum)),
+	}
+}
+
+// A finality certificate: votes of a quorum of the cluster's members on
+// one block. Members and Quorum are signed by every vote.
+type Certificate struct {
+	Height   int      `json:"height"`
+	HashRoot []byte   `json:"hash_root"`
+	Members  []string `json:"members"`
+	Quorum   int      `json:"quorum"`
+	Votes    []Vote   `json:"votes"`
+}
+
+// A block with the evidence that the cluster committed it, as exported to
+// partners.
+type CertifiedBlock struct {
+	Block       data.BasicBlock `json:"block"`
+	Certificate *Certificate    `json:"certificate"`
+}
+
+// The least quorum a certificate may claim: a majority of its members.
+func majority(members int) int {
+	return members/2 + 1
+}
+
+// Verify checks that the certificate is for block and carries valid votes
+// of its quorum of members. The votes sign the member set and quorum, so
+// neither changes after the fact, whatever keys the verifier holds.
+// Partners verify with the keys they got from us out of band, which may
+// include nodes which left.
+func (c *Certificate) Verify(block *data.BasicBlock, keys NodeKeys) error {
+	if c.Height != block.HeadB.Height || !bytes.Equal(c.HashRoot, block.HeadB.HashRoot) {
+		return errors.New("certificate is for another block")
+	}
+	if !block.Verify() {
+		return errors.New("block does not match its hash root")
+	}
+	if c.Quorum < majority(len(c.Members)) || c.Quorum > len(c.Members) {
+		return fmt.Errorf("certificate quorum %d of %d members", c.Quorum, len(c.Members))
+	}
+	members := make(map[string]bool)
+	for _, name := range c.Members {
+		members[name] = true
+	}
+	msg := voteBytes(c.Height, c.HashRoot, c.Members, c.Quorum)
+	signed := make(map[string]bool)
+	for _, v := range c.Votes {
+		key, ok := keys[v.Name]
+		if !ok || !members[v.Name] || !key.Equal(v.PublicKey) || signed[v.Name] {
+			continue
+		}
+		if identity.Verify(key, msg, v.Signature) {
+			signed[v.Name] = true
+		}
+	}
+	if len(signed) < c.Quorum {
+		return fmt.Errorf("certificate has %d valid votes, %d needed", len(signed), c.Quorum)
+	}
+	return nil
+}
+
+func certificateKey(height int) string {
+	return "certificate_" + strconv.Itoa(height)
+}
+
+// Collects the votes of blocks which are not certified yet.
+type ballots struct {
+	mutex sync.Mutex
+	votes map[int]map[string]Vote
+}
+
+// Votes of this node which peers did not take yet, by peer and height.
+type voteOutbox struct {
+	mutex sync.Mutex
+	votes map[string]map[int]Vote
+	wake  chan struct{}
+}
+
+// electorate returns the names of the current members, sorted, and the
+// votes a certificate needs among them: a majority, more under an engine
+// which tolerates faulty members. Nodes which left do not count towards
+// the quorum, members which did not register a key yet do.
+func (s *Server) electorate() ([]string, int) {
+	members := s.engine.Members()
+	names := make([]string, 0, len(members))
+	for _, m := range members {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names, consensus.Quorum(s.engine, len(names))
+}
+
+// voters returns the keys of the current members.
+func (s *Server) voters() (NodeKeys, error) {
+	keys, err := loadKeys(s.store)
+	if err != nil {
+		return nil, err
+	}
+	voters := NodeKeys{}
+	for _, m := range s.engine.Members() {
+		if key, ok := keys[m.Name]; ok {
+			voters[m.Name] = key
+		}
+	}
+	return voters, nil
+}
+
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// finalize votes on a block once this node committed it.
+func (s *Server) finalize(c consensus.Committed) {
+	cmd, ok := c.Command.(*PackCommand)
+	if !ok || c.Err != nil {
+		return
+	}
+	vote := s.newVote(s.identity, &cmd.BlockContent)
+	if err := s.addVote(vote); err != nil {
+		logging.Warn("vote failed", "height", vote.Height, "err", err)
+		return
+	}
+	s.outbox.mutex.Lock()
+	defer s.outbox.mutex.Unlock()
+	if s.outbox.votes == nil {
+		s.outbox.votes = make(map[string]map[int]Vote)
+	}
+	for _, m := range s.engine.Members() {
+		if m.Name == s.engine.Name() {
+			continue
+		}
+		votes := s.outbox.votes[m.Name]
+		if votes == nil {
+			votes = make(map[int]Vote)
+			s.outbox.votes[m.Name] = votes
+		}
+		votes[vote.Height] = vote
+		for h := range votes {
+			if h <= vote.Height-maxPendingVotes {
+				delete(votes, h)
+			}
+		}
+	}
+	select {
+	case s.outbox.wake <- struct{}{}:
+	default:
+	}
+}
+
+// voteLoop sends the votes of this node to its peers until they took
+// them, retrying every voteRetry.
+func (s *Server) voteLoop() {
+	client := &http.Client{Timeout: voteTimeout}
+	for {
+		select {
+		case <-s.stopped:
+			return
+		case <-s.outbox.wake:
+		case <-time.After(voteRetry):
+		}
+		s.sendVotes(client)
+	}
+}
+
+// sendVotes sends the pending votes to each member in height order. An
+// unreachable member holds back the rest of its votes until the next
+// round; the votes of nodes which left are dropped.
+func (s *Server) sendVotes(client *http.Client) {
+	members := s.engine.Members()
+	pending := make(map[string][]Vote)
+	s.outbox.mutex.Lock()
+	for name := range s.outbox.votes {
+		if !s.isMember(name) {
+			delete(s.outbox.votes, name)
+		}
+	}
+	for name, votes := range s.outbox.votes {
+		for _, v := range votes {
+			pending[name] = append(pending[name], v)
+		}
+		sort.Slice(pending[name], func(i, j int) bool { return pending[name][i].Height < pending[name][j].Height })
+	}
+	s.outbox.mutex.Unlock()
+
+	for _, m := range members {
+		for _, vote := range pending[m.Name] {
+			if err := postVote(client, m.ConnectionString, vote); err != nil {
+				logging.Debug("vote not delivered", "to", m.Name, "height", vote.Height, "err", err)
+				break
+			}
+			s.outbox.mutex.Lock()
+			delete(s.outbox.votes[m.Name], vote.Height)
+			s.outbox.mutex.Unlock()
+		}
+	}
+}
+
+func postVote(client *http.Client, host string, vote Vote) error {
+	content, err := json.Marshal(vote)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(host+"/vote", "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(string(res))
+	}
+	return nil
+}
+
+// addVote records a vote of a member and stores the certificate once a
+// quorum of the members voted. Votes may arrive before the node committed
+// the block itself, they are checked against the block when the
+// certificate is built. Only votes which count among the members this
+// node sees make it into a certificate. Ballots which fall too far behind
+// the chain head are dropped uncertified.
+func (s *Server) addVote(vote Vote) error {
+	keys, err := s.voters()
+	if err != nil {
+		return err
+	}
+	key, ok := keys[vote.Name]
+	if !ok || !key.Equal(vote.PublicKey) {
+		return errors.New("vote from unknown node " + vote.Name)
+	}
+	if !identity.Verify(key, voteBytes(vote.Height, vote.HashRoot, vote.Members, vote.Quorum), vote.Signature) {
+		return errors.New("invalid vote signature from " + vote.Name)
+	}
+	if _, err = s.Certificate(vote.Height); err == nil {
+		return nil
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		return err
+	}
+	if vote.Height > top+ballotWindow {
+		return fmt.Errorf("vote for height %d too far ahead of %d", vote.Height, top)
+	}
+
+	s.ballots.mutex.Lock()
+	defer s.ballots.mutex.Unlock()
+	if s.ballots.votes == nil {
+		s.ballots.votes = make(map[int]map[string]Vote)
+	}
+	for h := range s.ballots.votes {
+		if h <= top-ballotWindow {
+			delete(s.ballots.votes, h)
+		}
+	}
+	if vote.Height <= top-ballotWindow {
+		return nil
+	}
+	votes := s.ballots.votes[vote.Height]
+	if votes == nil {
+		votes = make(map[string]Vote)
+		s.ballots.votes[vote.Height] = votes
+	}
+	votes[vote.Name] = vote
+
+	block, err := s.store.GetBlock(vote.Height)
+	if err == store.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	members, quorum := s.electorate()
+	cert := &Certificate{Height: block.HeadB.Height, HashRoot: block.HeadB.HashRoot, Members: members, Quorum: quorum}
+	for _, v := range votes {
+		if bytes.Equal(v.HashRoot, cert.HashRoot) && v.Quorum == quorum && sameMembers(v.Members, members) {
+			cert.Votes = append(cert.Votes, v)
+		}
+	}
+	sort.Slice(cert.Votes, func(i, j int) bool { return cert.Votes[i].Name < cert.Votes[j].Name })
+	if cert.Verify(block, keys) != nil {
+		return nil
+	}
+	if err = s.store.PutMeta(certificateKey(cert.Height), cert); err != nil {
+		return err
+	}
+	delete(s.ballots.votes, vote.Height)
+	logging.Info("block certified", "height", cert.Height, "votes", len(cert.Votes))
+	return nil
+}
+
+func (s *Server) Certificate(height int) (*Certificate, error) {
+	cert := &Certificate{}
+	if err := s.store.GetMeta(certificateKey(height), cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// certifiedBlock returns the block at height with its certificate, nil
+// while the block is not certified yet.
+func (s *Server) certifiedBlock(height int) (*CertifiedBlock, error) {
+	block, err := s.block(height)
+	if err != nil {
+		return nil, err
+	}
+	cb := &CertifiedBlock{Block: *block}
+	cb.Certificate, err = s.Certificate(height)
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// Client function
+// Gets a block with its finality certificate, for export.
+func GetCertifiedBlock(host string, height int, consistency string) (cb *CertifiedBlock, err error) {
+	cb = &CertifiedBlock{}
+	err = getV1(consistency, host+"/v1/blocks/"+strconv.Itoa(height)+"/certificate", cb)
+	if err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// Verifies an exported block without our API: its seal and certificate
+// must check out against keys, the key map served by /v1/keys.
+func VerifyCertifiedBlock(cb *CertifiedBlock, keys NodeKeys) error {
+	if cb.Certificate == nil {
+		return errors.New("block is not certified")
+	}
+	if err := keys.Verify(&cb.Block); err != nil {
+		return err
+	}
+	return cb.Certificate.Verify(&cb.Block, keys)
+}
+
+// Reads an exported block and a key map from files and verifies them.
+func VerifyCertifiedBlockFile(blockPath, keysPath string) (*CertifiedBlock, error) {
+	raw, err := ioutil.ReadFile(blockPath)
+	if err != nil {
+		return nil, err
+	}
+	cb := &CertifiedBlock{}
+	if err = json.Unmarshal(raw, cb); err != nil {
+		return nil, err
+	}
+	keys, err := ReadKeysFile(keysPath)
+	if err != nil {
+		return nil, err
+	}
+	return cb, VerifyCertifiedBlock(cb, keys)
+}
+
+// Server handler
+func (s *Server) voteHandler(w http.ResponseWriter, req *http.Request) {
+	vote := Vote{}
+	if err := json.NewDecoder(req.Body).Decode(&vote); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.addVote(vote); err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("Success:Vote of " + vote.Name + " recorded"))
+}
+
+// certifiedBlockHandler serves a block with its certificate, null while
+// the block is not certified yet.
+func (s *Server) certifiedBlockHandler(w http.ResponseWriter, req *http.Request) {
+	var err error
+	defer func() {
+		if err != nil {
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}()
+	height, err := strconv.Atoi(mux.Vars(req)["height"])
+	if err != nil {
+		return
+	}
+	cb, err := s.certifiedBlock(height)
+	if err != nil {
+		return
+	}
+	resp, err := json.Marshal(cb)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *Server) apiCertifiedBlock(req *http.Request) (interface{}, error) {
+	height, err := pathInt(req, "height")
+	if err != nil {
+		return nil, err
+	}
+	return s.certifiedBlock(height)
+}
@@ -0,0 +1,205 @@
+package raft
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/identity"
+)
+
+// An engine with a fixed member list.
+type membersEngine struct {
+	consensus.Engine
+	members []consensus.Member
+}
+
+func (e membersEngine) Members() []consensus.Member {
+	return e.members
+}
+
+func newPeer(t *testing.T, s *Server, name string) *identity.Identity {
+	t.Helper()
+	id, err := identity.Generate(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.engine.Propose(NewRegisterKeyCommand(id)); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Certificates need a quorum of the current members, whatever keys were
+// registered before.
+func TestQuorumOfMembers(t *testing.T) {
+	s, para := newTestServer(t)
+	left := newPeer(t, s, "left")
+	addAndPack(t, s, para, "a")
+	block, err := s.store.GetBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.addVote(s.newVote(left, block)); err == nil {
+		t.Fatal("vote of a node which left accepted")
+	}
+	if err = s.addVote(s.newVote(s.identity, block)); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := s.Certificate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Votes) != 1 {
+		t.Fatalf("votes %+v", cert.Votes)
+	}
+}
+
+// An engine which needs every member to agree.
+type unanimousEngine struct {
+	membersEngine
+}
+
+func (e unanimousEngine) Quorum(members int) int {
+	return members
+}
+
+// Certificates count votes among the members they were signed for, so
+// keys of nodes which left neither lower nor raise their quorum, and
+// neither the member set nor the quorum can be changed afterwards.
+func TestCertificateMembers(t *testing.T) {
+	s, para := newTestServer(t)
+	peer := newPeer(t, s, "peer")
+	for _, name := range []string{"left", "gone"} {
+		newPeer(t, s, name)
+	}
+	members := membersEngine{s.engine, []consensus.Member{{Name: s.Name()}, {Name: "peer"}, {Name: "new"}}}
+	s.SetEngine(members)
+	addAndPack(t, s, para, "a")
+	block, err := s.store.GetBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []*identity.Identity{s.identity, peer} {
+		if err = s.addVote(s.newVote(id, block)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := s.Certificate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Quorum != 2 || len(cert.Members) != 3 {
+		t.Fatalf("certificate of %v with quorum %d", cert.Members, cert.Quorum)
+	}
+	keys, err := loadKeys(s.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 4 {
+		t.Fatalf("%d keys", len(keys))
+	}
+	if err = cert.Verify(block, keys); err != nil {
+		t.Fatalf("verify with the keys of nodes which left: %v", err)
+	}
+
+	tampered := *cert
+	tampered.Votes = cert.Votes[:1]
+	tampered.Quorum = 1
+	if tampered.Verify(block, keys) == nil {
+		t.Fatal("certificate verified with a lowered quorum")
+	}
+	tampered.Members = []string{cert.Votes[0].Name}
+	if tampered.Verify(block, keys) == nil {
+		t.Fatal("certificate verified with fewer members")
+	}
+	tampered = *cert
+	tampered.Members = append([]string{"extra1", "extra2"}, cert.Members...)
+	if tampered.Verify(block, keys) == nil {
+		t.Fatal("certificate verified with a quorum below a majority")
+	}
+
+	// an engine which tolerates faulty members needs more votes
+	s.SetEngine(unanimousEngine{members})
+	addAndPack(t, s, para, "b")
+	if block, err = s.store.GetBlock(2); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []*identity.Identity{s.identity, peer} {
+		if err = s.addVote(s.newVote(id, block)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = s.Certificate(2); err == nil {
+		t.Fatal("certified with two of three votes under a quorum of three")
+	}
+}
+
+// Ballots are kept only within the window around the chain head.
+func TestBallotWindow(t *testing.T) {
+	s, para := newTestServer(t)
+	peer := newPeer(t, s, "peer")
+	s.SetEngine(membersEngine{s.engine, []consensus.Member{{Name: s.Name()}, {Name: "peer"}}})
+	addAndPack(t, s, para, "a")
+	block, err := s.store.GetBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	far := s.newVote(peer, block)
+	far.Height = 1 + ballotWindow + 1
+	far.Signature = peer.Sign(voteBytes(far.Height, far.HashRoot, far.Members, far.Quorum))
+	if err = s.addVote(far); err == nil {
+		t.Fatal("vote far ahead of the chain accepted")
+	}
+
+	s.ballots.votes = map[int]map[string]Vote{1 - ballotWindow: {}}
+	if err = s.addVote(s.newVote(s.identity, block)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Certificate(1); err == nil {
+		t.Fatal("certified with half of the members")
+	}
+	if len(s.ballots.votes) != 1 || s.ballots.votes[1] == nil {
+		t.Fatalf("ballots %v", s.ballots.votes)
+	}
+	if err = s.addVote(s.newVote(peer, block)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Certificate(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A vote a peer did not take is sent again.
+func TestVoteRetried(t *testing.T) {
+	var mutex sync.Mutex
+	calls := 0
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if calls++; calls == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer peer.Close()
+
+	s, para := newTestServer(t)
+	s.SetEngine(membersEngine{s.engine, []consensus.Member{{Name: s.Name()}, {Name: "peer", ConnectionString: peer.URL}}})
+	addAndPack(t, s, para, "a")
+	block, err := s.store.GetBlock(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.finalize(consensus.Committed{Command: NewPackCommand(*block)})
+	client := &http.Client{}
+	s.sendVotes(client)
+	if len(s.outbox.votes["peer"]) != 1 {
+		t.Fatalf("failed vote dropped: %v", s.outbox.votes)
+	}
+	s.sendVotes(client)
+	if len(s.outbox.votes["peer"]) != 0 || calls != 2 {
+		t.Fatalf("%d calls, pending %v", calls, s.outbox.votes)
+	}
+}
@@ -0,0 +1,269 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How a follower answers a write request.
+const (
+	ForwardProxy    = "proxy"    // pass it to the leader and relay the answer
+	ForwardRedirect = "redirect" // answer 307 with the leader in Location
+)
+
+// Set on requests a follower proxies, so they are never forwarded twice.
+const forwardedHeader = "X-Raft-Forwarded-By"
+
+// Set on every attempt of a write after the first, see retried. Only
+// taken from members, see leaderOnly.
+const retryHeader = "X-Raft-Retry"
+
+// Forwarding of write requests received by followers. While no leader is
+// known, e.g. during an election, a request is retried up to Retries times
+// with Backoff (ms) doubling between attempts. Write commands are not
+// idempotent: a retry after an unknown outcome may find the first attempt
+// applied. Handlers answer that as the success of the first attempt, see
+// retried. Retries which a follower proxies are only recognized with peer
+// authentication.
+type ForwardConfig struct {
+	Mode    string
+	Retries int
+	Backoff int
+}
+
+func DefaultForwardConfig() ForwardConfig {
+	return ForwardConfig{Mode: ForwardProxy, Retries: 5, Backoff: 100}
+}
+
+func (c ForwardConfig) Validate() error {
+	if c.Mode != ForwardProxy && c.Mode != ForwardRedirect {
+		return errors.New("unknown forward mode: " + c.Mode)
+	}
+	if c.Retries < 0 || c.Backoff < 0 {
+		return errors.New("forward retries and backoff must not be negative")
+	}
+	return nil
+}
+
+func (s *Server) SetForwarding(c ForwardConfig) {
+	s.forward = c
+}
+
+// Body of write responses which did not reach the leader.
+type NotLeaderResponse struct {
+	Error  string `json:"error"`
+	Leader string `json:"leader"`
+}
+
+// retried reports whether a request is a retry of a write, which the
+// cluster may already have applied. A tx which is then pooled or on chain
+// already, or a block whose height is taken by the same block, is the
+// outcome of the earlier attempt rather than a conflict.
+func retried(req *http.Request) bool {
+	return req.Header.Get(retryHeader) != ""
+}
+
+// txApplied reports whether err of an AddTx is the earlier attempt of a
+// retry having pooled the tx.
+func txApplied(req *http.Request, err error) bool {
+	return retried(req) && (errors.Is(err, mempool.ErrDuplicate) || errors.Is(err, mempool.ErrOnChain))
+}
+
+// blockApplied reports whether the earlier attempt of a retry committed
+// the block already.
+func (s *Server) blockApplied(req *http.Request, block *data.BasicBlock) bool {
+	if !retried(req) {
+		return false
+	}
+	prev, err := s.store.GetBlock(block.HeadB.Height)
+	return err == nil && bytes.Equal(prev.HeadB.HashRoot, block.HeadB.HashRoot)
+}
+
+// Connection string of the current leader, "" while none is known.
+func (s *Server) leaderURL() string {
+	return s.engine.Leader().ConnectionString
+}
+
+// Buffers a handler response, so that a request whose node lost leadership
+// while handling it can be retried against the new leader.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *bufferedResponse) send(w http.ResponseWriter) {
+	for k, v := range r.header {
+		w.Header()[k] = v
+	}
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
+
+// writeNotLeader answers a request which needs the leader. The v1 API
+// answers not_leader with a redirect and unavailable otherwise.
+func writeNotLeader(w http.ResponseWriter, req *http.Request, status int, msg, leader string) {
+	if isV1(req) {
+		code := CodeUnavailable
+		if status == http.StatusTemporaryRedirect {
+			code = CodeNotLeader
+		}
+		writeEnvelope(w, status, Envelope{Error: &APIError{Code: code, Message: msg, Leader: leader}})
+		return
+	}
+	resp, _ := json.Marshal(NotLeaderResponse{Error: msg, Leader: leader})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// proxy passes a write request to the leader and relays its answer.
+func (s *Server) proxy(w http.ResponseWriter, req *http.Request, body []byte, leader string) error {
+	preq, err := http.NewRequest(req.Method, leader+req.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	preq.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		preq.Header.Set("Authorization", auth)
+	}
+	if retry := req.Header.Get(retryHeader); retry != "" {
+		preq.Header.Set(retryHeader, retry)
+	}
+	preq.Header.Set(forwardedHeader, s.name)
+	resp, err := http.DefaultClient.Do(preq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return errors.New(string(res))
+	}
+	for _, k := range []string{"Content-Type", "Location"} {
+		if v := resp.Header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(res)
+	return nil
+}
+
+// leaderOnly wraps a handler which proposes raft commands, so that any node
+// accepts the request: the leader handles it, a follower proxies it to the
+// leader or redirects the client there. Clients cannot claim a retry: the
+// retry header is dropped unless a member forwarded the request.
+func (s *Server) leaderOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !s.forwardedByMember(req) {
+			req.Header.Del(retryHeader)
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		backoff := time.Duration(s.forward.Backoff) * time.Millisecond
+		for attempt := 0; ; attempt++ {
+			if attempt > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+				req.Header.Set(retryHeader, strconv.Itoa(attempt))
+			}
+			last := attempt == s.forward.Retries
+			if s.engine.IsLeader() {
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+				resp := &bufferedResponse{header: make(http.Header)}
+				h(resp, req)
+				failed := resp.status == 0 || resp.status >= http.StatusMultipleChoices
+				if failed && !s.engine.IsLeader() && !last {
+					logging.Info("lost leadership while handling request, retrying", "path", req.URL.Path)
+					continue
+				}
+				resp.send(w)
+				return
+			}
+			leader := s.leaderURL()
+			if leader != "" && (s.forward.Mode == ForwardRedirect || req.Header.Get(forwardedHeader) != "") {
+				w.Header().Set("Location", leader+req.URL.RequestURI())
+				writeNotLeader(w, req, http.StatusTemporaryRedirect, "not leader", leader)
+				return
+			}
+			if leader != "" {
+				err = s.proxy(w, req, body, leader)
+				if err == nil {
+					return
+				}
+				logging.Warn("forward to leader failed", "path", req.URL.Path, "leader", leader, "err", err)
+			}
+			if last {
+				writeNotLeader(w, req, http.StatusServiceUnavailable, "no leader available", leader)
+				return
+			}
+		}
+	}
+}
+
+// Client function
+// post sends a write request to any node. Redirects to the leader are
+// followed, and requests are retried while the cluster has no leader.
+func post(u string, content []byte) ([]byte, error) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable && attempt < 5 {
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New(string(res))
+		}
+		return res, nil
+	}
+}
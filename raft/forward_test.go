@@ -0,0 +1,112 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
+)
+
+func writeRequest(t *testing.T, path string, v interface{}, retry bool) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	if retry {
+		req.Header.Set(retryHeader, "1")
+	}
+	return req
+}
+
+// A retry whose earlier attempt was applied succeeds, the same request
+// sent twice by a client is still a conflict.
+func TestRetriedWrites(t *testing.T) {
+	s, para := newTestServer(t)
+	tx, err := data.NewBasicTx([]byte("once"), []byte("p"), para.Hk, chainParameter(para))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.apiAddTx(writeRequest(t, "/v1/transactions", tx, false)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.apiAddTx(writeRequest(t, "/v1/transactions", tx, false)); !errors.Is(err, mempool.ErrDuplicate) {
+		t.Fatalf("duplicate: %v", err)
+	}
+	if _, err = s.apiAddTx(writeRequest(t, "/v1/transactions", tx, true)); err != nil {
+		t.Fatalf("retried duplicate: %v", err)
+	}
+
+	block := data.NewBasicBlock(chainParameter(para))
+	if err = block.AppendTx(*tx); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := s.store.GetBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = block.Finalize(int(time.Now().Unix()), 1, genesis.HeadB.HashRoot); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.apiAddBlock(writeRequest(t, "/v1/blocks", block, false)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.apiAddBlock(writeRequest(t, "/v1/blocks", block, false)); err == nil {
+		t.Fatal("block accepted twice")
+	}
+	if _, err = s.apiAddBlock(writeRequest(t, "/v1/blocks", block, true)); err != nil {
+		t.Fatalf("retried block: %v", err)
+	}
+	if _, err = s.apiAddTx(writeRequest(t, "/v1/transactions", tx, true)); err != nil {
+		t.Fatalf("retried tx on chain: %v", err)
+	}
+	if top, _ := store.TopBlock(s.store); top.HeadB.Height != 1 {
+		t.Fatalf("height %d", top.HeadB.Height)
+	}
+}
+
+// Only members forwarding a write may claim a retry.
+func TestRetryFromMembersOnly(t *testing.T) {
+	s, para := newTestServer(t)
+	s.peerAuth = true
+	s.SetEngine(membersEngine{s.engine, []consensus.Member{{Name: s.Name()}, {Name: "node2"}}})
+	tx, err := data.NewBasicTx([]byte("once"), []byte("p"), para.Hk, chainParameter(para))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.leaderOnly(s.api(s.apiAddTx))
+	for _, c := range []struct {
+		name      string
+		cert      string
+		forwarded string
+		status    int
+	}{
+		{"first attempt", "", "", http.StatusAccepted},
+		{"client claiming a retry", "", "", http.StatusConflict},
+		{"client certificate claiming a retry", "node2", "", http.StatusConflict},
+		{"forwarded by a non member", "node3", "node3", http.StatusConflict},
+		{"forwarded by a member", "node2", "node2", http.StatusAccepted},
+	} {
+		req := writeRequest(t, "/v1/transactions", tx, c.name != "first attempt")
+		if c.cert != "" {
+			req.TLS = certified(c.cert)
+		}
+		if c.forwarded != "" {
+			req.Header.Set(forwardedHeader, c.forwarded)
+		}
+		w := httptest.NewRecorder()
+		h(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d: %s", c.name, w.Code, c.status, w.Body)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+	"net/http"
+)
+
+// What a joining node needs before it can apply the log: the public chain
+// parameter and block 0. The trapdoor key Tk is never part of it.
+type Genesis struct {
+	Parameter data.GolbalParameter `json:"parameter"`
+	Block     data.BasicBlock      `json:"block"`
+}
+
+// Returns the parameter without trapdoor material.
+func PublicParameter(para *data.GolbalParameter) data.GolbalParameter {
+	return data.GolbalParameter{
+		Bits: para.Bits,
+		P:    para.P,
+		Q:    para.Q,
+		G:    para.G,
+		Hk:   para.Hk,
+	}
+}
+
+func sameParameter(a, b *data.GolbalParameter) bool {
+	return a.Bits == b.Bits && bytes.Equal(a.P, b.P) && bytes.Equal(a.Q, b.Q) && bytes.Equal(a.G, b.G)
+}
+
+// VerifyGenesis checks that the block is a genesis block of the parameter.
+func VerifyGenesis(g *Genesis) error {
+	para := g.Parameter
+	if len(para.P) == 0 || len(para.Q) == 0 || len(para.G) == 0 {
+		return errors.New("genesis: incomplete chain parameter")
+	}
+	head := g.Block.HeadB
+	if head.Height != 0 || head.TxCount != 0 || len(head.PreviousRoot) != 0 {
+		return errors.New("genesis: block is not a genesis block")
+	}
+	if len(head.ChameleonParameter) != 3 ||
+		!bytes.Equal(head.ChameleonParameter[0], para.P) ||
+		!bytes.Equal(head.ChameleonParameter[1], para.Q) ||
+		!bytes.Equal(head.ChameleonParameter[2], para.G) {
+		return errors.New("genesis: block parameter differs from chain parameter")
+	}
+	if !g.Block.Verify() {
+		return errors.New("genesis: invalid block hash root")
+	}
+	return nil
+}
+
+// Bootstrap fetches the genesis of the cluster led by leader and writes it
+// to an empty store. A store which already holds a parameter or block 0
+// must match the cluster's, otherwise the node would diverge.
+func Bootstrap(st store.Store, leader string) error {
+	g, err := GetGenesis(leader)
+	if err != nil {
+		return err
+	}
+	if err = VerifyGenesis(g); err != nil {
+		return err
+	}
+	remote := PublicParameter(&g.Parameter)
+
+	local, err := st.Parameter()
+	if err == store.ErrNotFound {
+		logging.Info("bootstrapping chain parameter from leader", "leader", leader)
+		err = st.PutParameter(&remote)
+	} else if err == nil && !sameParameter(local, &remote) {
+		err = errors.New("local chain parameter differs from the cluster's, remove it to bootstrap from the leader")
+	}
+	if err != nil {
+		return err
+	}
+
+	block, err := st.GetBlock(0)
+	if err == store.ErrNotFound {
+		logging.Info("bootstrapping genesis block from leader", "leader", leader)
+		return st.PutBlock(&g.Block)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.HeadB.HashRoot, g.Block.HeadB.HashRoot) {
+		return fmt.Errorf("local genesis block %x differs from the cluster's %x", block.HeadB.HashRoot, g.Block.HeadB.HashRoot)
+	}
+	return nil
+}
+
+// Client function
+func GetGenesis(host string) (g *Genesis, err error) {
+	g = &Genesis{}
+	err = getJSON(host+"/genesis", g)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Server handler
+func (s *Server) genesisHandler(w http.ResponseWriter, req *http.Request) {
+	var err error
+	defer func() {
+		if err != nil {
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}()
+	para, err := s.store.Parameter()
+	if err != nil {
+		return
+	}
+	block, err := s.store.GetBlock(0)
+	if err != nil {
+		return
+	}
+	resp, err := json.Marshal(&Genesis{Parameter: PublicParameter(para), Block: *block})
+	if err != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,65 @@
+package raft
+
+import (
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/goraft/raft"
+)
+
+// goraft applies the commands of its log through these, see
+// consensus.Goraft. Other engines call Execute directly.
+
+func (c *ModifyCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *AddTxCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *PackCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *SetPolicyCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *SetPoolConfigCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *RegisterKeyCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *ActivateSealsCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *SetPrincipalCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *RevokePrincipalCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *SetWebhookCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *RemoveWebhookCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *NotifyCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *SettleDeliveriesCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
+
+func (c *RedriveCommand) Apply(ctx raft.Context) (interface{}, error) {
+	return consensus.ApplyGoraft(ctx, c)
+}
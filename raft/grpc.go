@@ -0,0 +1,652 @@
+package raft
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/chainpb"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata of gRPC calls, the counterparts of the Authorization header and
+// the consistency query parameter.
+const (
+	authorizationKey = "authorization"
+	consistencyKey   = "consistency"
+)
+
+// The role each gRPC method requires, every method missing here is for
+// admins only.
+var grpcRoles = map[string]Role{
+	chainpb.Chain_GetHeight_FullMethodName:           RoleReader,
+	chainpb.Chain_GetBlock_FullMethodName:            RoleReader,
+	chainpb.Chain_GetTx_FullMethodName:               RoleReader,
+	chainpb.Chain_SubscribeBlocks_FullMethodName:     RoleReader,
+	chainpb.Chain_SubscribeRedactions_FullMethodName: RoleReader,
+	chainpb.Chain_SubmitTx_FullMethodName:            RoleSubmitter,
+	chainpb.Chain_Modify_FullMethodName:              RoleRedactor,
+}
+
+// The gRPC status of each error code of the API.
+var grpcCodes = map[string]codes.Code{
+	CodeInvalidArgument:  codes.InvalidArgument,
+	CodeUnauthenticated:  codes.Unauthenticated,
+	CodePermissionDenied: codes.PermissionDenied,
+	CodeNotFound:         codes.NotFound,
+	CodeMethodNotAllowed: codes.Unimplemented,
+	CodeConflict:         codes.AlreadyExists,
+	CodeCursorExpired:    codes.OutOfRange,
+	CodeTooLarge:         codes.ResourceExhausted,
+	CodePoolFull:         codes.ResourceExhausted,
+	CodeNotLeader:        codes.Unavailable,
+	CodeUnavailable:      codes.Unavailable,
+	CodeInternal:         codes.Internal,
+}
+
+// Returned to a stream which fell behind, it may subscribe again.
+var errFellBehind = &APIError{
+	Status:  http.StatusServiceUnavailable,
+	Code:    CodeUnavailable,
+	Message: "stream fell behind",
+}
+
+// A committed tx replaced by a modify request.
+type Redaction struct {
+	Height      int          `json:"height"`
+	TxId        int          `json:"tx_id"`
+	Transaction data.BasicTx `json:"transaction"`
+}
+
+// Serves the gRPC API on port, 0 disables it. Must be called before
+// ListenAndServe.
+func (s *Server) SetGRPC(port int) {
+	s.grpcPort = port
+}
+
+// serveGRPC starts the gRPC API, with the TLS config of the REST API.
+func (s *Server) serveGRPC() error {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	}
+	if s.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tls)))
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+	chainpb.RegisterChainServer(s.grpcServer, &chainService{s: s})
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.grpcPort))
+	if err != nil {
+		return err
+	}
+	logging.Info("grpc listening", "port", s.grpcPort)
+	go func() {
+		if err := s.grpcServer.Serve(lis); err != nil {
+			logging.Warn("grpc server stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+func grpcMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(key)) == 0 {
+		return ""
+	}
+	return md.Get(key)[0]
+}
+
+// grpcAuthorize enforces the roles of the replicated principals on a gRPC
+// call, like authorize does on the REST API. The returned function records
+// the outcome of an allowed call in the audit log.
+func (s *Server) grpcAuthorize(ctx context.Context, method string) (func(error), error) {
+	principals := s.Principals()
+	if len(principals) == 0 {
+		return func(error) {}, nil
+	}
+	role, ok := grpcRoles[method]
+	if !ok {
+		role = RoleAdmin
+	}
+	entry := AuditEntry{
+		Time:   time.Now().UTC(),
+		Role:   role,
+		Method: "GRPC",
+		Path:   method,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		entry.Remote = p.Addr.String()
+	}
+	var denied *APIError
+	auth := grpcMetadata(ctx, authorizationKey)
+	if !strings.HasPrefix(auth, "Bearer ") {
+		denied = errUnauthenticated
+	} else if p, ok := principals.lookup(strings.TrimSpace(auth[len("Bearer "):])); !ok {
+		denied = errUnauthenticated
+	} else {
+		entry.Principal = p.Name
+		entry.Allowed = p.Has(role)
+		if !entry.Allowed {
+			denied = permissionDenied(p, role)
+		}
+	}
+	if denied != nil {
+		entry.Status = denied.Status
+		s.audit.record(entry)
+		logging.Warn("request denied", "method", method, "principal", entry.Principal, "role", role, "remote", entry.Remote)
+		return nil, denied
+	}
+	return func(err error) {
+		entry.Status = http.StatusOK
+		if err != nil && status.Code(err) != codes.Canceled && !errors.Is(err, context.Canceled) {
+			entry.Status = toAPIError(err).Status
+		}
+		s.audit.record(entry)
+	}, nil
+}
+
+// grpcError turns the error of a handler into a gRPC status. Errors of
+// the transport, e.g. of a client which went away, already are one.
+func grpcError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	e := toAPIError(err)
+	if e.Status >= http.StatusInternalServerError {
+		logging.Warn("request failed", "method", method, "code", e.Code, "err", err)
+	} else {
+		logging.Debug("request rejected", "method", method, "code", e.Code, "err", err)
+	}
+	code, ok := grpcCodes[e.Code]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, e.Message)
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	done, err := s.grpcAuthorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, grpcError(info.FullMethod, err)
+	}
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, grpcError(info.FullMethod, err)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	done, err := s.grpcAuthorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return grpcError(info.FullMethod, err)
+	}
+	err = handler(srv, ss)
+	done(err)
+	return grpcError(info.FullMethod, err)
+}
+
+// grpcConsistent applies the read consistency of a call. A follower cannot
+// pass a gRPC read on to the leader, so it serves leader reads after a
+// read barrier, like linearizable ones.
+func (s *Server) grpcConsistent(ctx context.Context) error {
+	mode := grpcMetadata(ctx, consistencyKey)
+	if mode == "" {
+		mode = s.readMode
+	}
+	if err := ValidReadConsistency(mode); err != nil {
+		return badRequest("%v", err)
+	}
+	if mode == ReadLocal || (mode == ReadLeader && s.engine.IsLeader()) {
+		return nil
+	}
+	err := s.readBarrier()
+	if errors.Is(err, consensus.ErrUnsupported) {
+		return errNoLinearizable
+	}
+	if err != nil {
+		return &APIError{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: err.Error(), Leader: s.leaderURL()}
+	}
+	return nil
+}
+
+// onLeader runs a write: the leader runs local, a follower passes the
+// request to the v1 API of the leader with the token of the caller. While
+// no leader is known it retries like leaderOnly.
+func (s *Server) onLeader(ctx context.Context, method, path string, body interface{}, local func() (TxReceipt, error)) (TxReceipt, error) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return TxReceipt{}, err
+	}
+	backoff := time.Duration(s.forward.Backoff) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return TxReceipt{}, ctx.Err()
+			}
+			backoff *= 2
+		}
+		last := attempt == s.forward.Retries
+		if s.engine.IsLeader() {
+			receipt, err := local()
+			if err != nil && !s.engine.IsLeader() && !last {
+				logging.Info("lost leadership while handling request, retrying", "path", path)
+				continue
+			}
+			return receipt, err
+		}
+		if leader := s.leaderURL(); leader != "" {
+			receipt := TxReceipt{}
+			err = callAs(grpcMetadata(ctx, authorizationKey), method, leader+path, content, &receipt)
+			return receipt, err
+		}
+		if last {
+			return TxReceipt{}, &APIError{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "no leader available"}
+		}
+	}
+}
+
+func txToPB(tx *data.BasicTx) *chainpb.Transaction {
+	return &chainpb.Transaction{
+		Payload:            tx.PayloadB,
+		Proof:              tx.ProofB,
+		ChameleonPublicKey: tx.ChameleonPkB,
+		CheckString:        tx.CheckStringB,
+		Hash:               tx.HashValB,
+	}
+}
+
+func txFromPB(tx *chainpb.Transaction) *data.BasicTx {
+	return &data.BasicTx{
+		PayloadB:     tx.GetPayload(),
+		ProofB:       tx.GetProof(),
+		ChameleonPkB: tx.GetChameleonPublicKey(),
+		CheckStringB: tx.GetCheckString(),
+		HashValB:     tx.GetHash(),
+	}
+}
+
+func blockToPB(b *data.BasicBlock) *chainpb.Block {
+	h := b.HeadB
+	block := &chainpb.Block{Head: &chainpb.BlockHead{
+		Height:             int64(h.Height),
+		Timestamp:          int64(h.Timestamp),
+		TxCount:            int64(h.TxCount),
+		HashRoot:           h.HashRoot,
+		PreviousRoot:       h.PreviousRoot,
+		ChameleonParameter: h.ChameleonParameter,
+		Sealer:             h.Sealer,
+		SealerKey:          h.SealerKey,
+		Signature:          h.Signature,
+	}}
+	for i := range b.TransactionsB {
+		block.Transactions = append(block.Transactions, txToPB(&b.TransactionsB[i]))
+	}
+	return block
+}
+
+func blockFromPB(b *chainpb.Block) *data.BasicBlock {
+	h := b.GetHead()
+	block := &data.BasicBlock{HeadB: data.BasicHead{
+		Height:             int(h.GetHeight()),
+		Timestamp:          int(h.GetTimestamp()),
+		TxCount:            int(h.GetTxCount()),
+		HashRoot:           h.GetHashRoot(),
+		PreviousRoot:       h.GetPreviousRoot(),
+		ChameleonParameter: h.GetChameleonParameter(),
+		Sealer:             h.GetSealer(),
+		SealerKey:          h.GetSealerKey(),
+		Signature:          h.GetSignature(),
+	}}
+	for _, tx := range b.GetTransactions() {
+		block.TransactionsB = append(block.TransactionsB, *txFromPB(tx))
+	}
+	return block
+}
+
+func locatedTxToPB(tx LocatedTx) *chainpb.LocatedTx {
+	return &chainpb.LocatedTx{Height: int64(tx.Height), TxId: int64(tx.TxId), Transaction: txToPB(&tx.Transaction)}
+}
+
+func locatedTxFromPB(tx *chainpb.LocatedTx) *LocatedTx {
+	return &LocatedTx{Height: int(tx.GetHeight()), TxId: int(tx.GetTxId()), Transaction: *txFromPB(tx.GetTransaction())}
+}
+
+var receiptStatus = map[string]chainpb.TxReceipt_Status{
+	TxPending:  chainpb.TxReceipt_PENDING,
+	TxModified: chainpb.TxReceipt_MODIFIED,
+}
+
+func receiptToPB(r TxReceipt) *chainpb.TxReceipt {
+	receipt := &chainpb.TxReceipt{Hash: r.Hash, Status: receiptStatus[r.Status]}
+	if r.Height != nil && r.TxId != nil {
+		receipt.Location = &chainpb.TxLocation{Height: int64(*r.Height), TxId: int64(*r.TxId)}
+	}
+	return receipt
+}
+
+func receiptFromPB(r *chainpb.TxReceipt) *TxReceipt {
+	receipt := &TxReceipt{Hash: r.GetHash()}
+	for name, st := range receiptStatus {
+		if st == r.GetStatus() {
+			receipt.Status = name
+		}
+	}
+	if loc := r.GetLocation(); loc != nil {
+		height, txId := int(loc.GetHeight()), int(loc.GetTxId())
+		receipt.Height, receipt.TxId = &height, &txId
+	}
+	return receipt
+}
+
+// Client function
+// A client of the gRPC API, for services which speak gRPC rather than the
+// REST API. Errors are gRPC statuses.
+type GRPCClient struct {
+	conn  *grpc.ClientConn
+	chain chainpb.ChainClient
+}
+
+// Sends an API token with every call.
+type bearerCredentials struct {
+	token  string
+	secure bool
+}
+
+func (c bearerCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{authorizationKey: "Bearer " + c.token}, nil
+}
+
+func (c bearerCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// DialGRPC connects to the gRPC API of a node at target, host:port. A nil
+// tlsConfig dials without TLS. token, if set, goes with every call.
+func DialGRPC(target string, tlsConfig *tls.Config, token string) (*GRPCClient, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerCredentials{token: token, secure: tlsConfig != nil}))
+	}
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{conn: conn, chain: chainpb.NewChainClient(conn)}, nil
+}
+
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// WithReadConsistency makes the reads of a GRPCClient call with ctx use
+// consistency instead of the server default.
+func WithReadConsistency(ctx context.Context, consistency string) context.Context {
+	if consistency == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, consistencyKey, consistency)
+}
+
+func (c *GRPCClient) Height(ctx context.Context) (int, error) {
+	res, err := c.chain.GetHeight(ctx, &chainpb.GetHeightRequest{})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.GetHeight()), nil
+}
+
+func (c *GRPCClient) Block(ctx context.Context, height int) (*data.BasicBlock, error) {
+	res, err := c.chain.GetBlock(ctx, &chainpb.GetBlockRequest{Height: int64(height)})
+	if err != nil {
+		return nil, err
+	}
+	return blockFromPB(res), nil
+}
+
+func (c *GRPCClient) Tx(ctx context.Context, height, txId int) (*LocatedTx, error) {
+	res, err := c.chain.GetTx(ctx, &chainpb.GetTxRequest{Key: &chainpb.GetTxRequest_Location{
+		Location: &chainpb.TxLocation{Height: int64(height), TxId: int64(txId)},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return locatedTxFromPB(res), nil
+}
+
+func (c *GRPCClient) TxByHash(ctx context.Context, hash string) (*LocatedTx, error) {
+	res, err := c.chain.GetTx(ctx, &chainpb.GetTxRequest{Key: &chainpb.GetTxRequest_Hash{Hash: hash}})
+	if err != nil {
+		return nil, err
+	}
+	return locatedTxFromPB(res), nil
+}
+
+// SubmitTx adds tx, see data.NewBasicTx, to the pool through any node.
+func (c *GRPCClient) SubmitTx(ctx context.Context, tx *data.BasicTx, priority int) (*TxReceipt, error) {
+	res, err := c.chain.SubmitTx(ctx, &chainpb.SubmitTxRequest{Transaction: txToPB(tx), Priority: int32(priority)})
+	if err != nil {
+		return nil, err
+	}
+	return receiptFromPB(res), nil
+}
+
+// Modify replaces transaction txId of block height by tx, which must have
+// the same chameleon hash, see data.BasicTx.Modify.
+func (c *GRPCClient) Modify(ctx context.Context, height, txId int, tx *data.BasicTx) (*TxReceipt, error) {
+	res, err := c.chain.Modify(ctx, &chainpb.ModifyRequest{Height: int64(height), TxId: int64(txId), Transaction: txToPB(tx)})
+	if err != nil {
+		return nil, err
+	}
+	return receiptFromPB(res), nil
+}
+
+// SubscribeBlocks calls fn with every block from height from on, until
+// ctx is done or fn fails.
+func (c *GRPCClient) SubscribeBlocks(ctx context.Context, from int, fn func(*data.BasicBlock) error) error {
+	stream, err := c.chain.SubscribeBlocks(ctx, &chainpb.SubscribeBlocksRequest{FromHeight: int64(from)})
+	if err != nil {
+		return err
+	}
+	for {
+		block, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = fn(blockFromPB(block)); err != nil {
+			return err
+		}
+	}
+}
+
+// SubscribeRedactions calls fn with every redaction from now on, until ctx
+// is done or fn fails.
+func (c *GRPCClient) SubscribeRedactions(ctx context.Context, fn func(Redaction) error) error {
+	stream, err := c.chain.SubscribeRedactions(ctx, &chainpb.SubscribeRedactionsRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = fn(Redaction{Height: int(r.GetHeight()), TxId: int(r.GetTxId()), Transaction: *txFromPB(r.GetTransaction())})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Server handler
+// The chainpb.ChainServer of a node.
+type chainService struct {
+	chainpb.UnimplementedChainServer
+	s *Server
+}
+
+func (g *chainService) GetHeight(ctx context.Context, req *chainpb.GetHeightRequest) (*chainpb.GetHeightResponse, error) {
+	if err := g.s.grpcConsistent(ctx); err != nil {
+		return nil, err
+	}
+	height, err := g.s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	return &chainpb.GetHeightResponse{Height: int64(height)}, nil
+}
+
+func (g *chainService) GetBlock(ctx context.Context, req *chainpb.GetBlockRequest) (*chainpb.Block, error) {
+	if err := g.s.grpcConsistent(ctx); err != nil {
+		return nil, err
+	}
+	block, err := g.s.block(int(req.GetHeight()))
+	if err != nil {
+		return nil, err
+	}
+	return blockToPB(block), nil
+}
+
+func (g *chainService) GetTx(ctx context.Context, req *chainpb.GetTxRequest) (*chainpb.LocatedTx, error) {
+	if err := g.s.grpcConsistent(ctx); err != nil {
+		return nil, err
+	}
+	switch key := req.GetKey().(type) {
+	case *chainpb.GetTxRequest_Location:
+		height, txId := int(key.Location.GetHeight()), int(key.Location.GetTxId())
+		tx, err := g.s.tx(height, txId)
+		if err != nil {
+			return nil, err
+		}
+		return locatedTxToPB(LocatedTx{Height: height, TxId: txId, Transaction: *tx}), nil
+	case *chainpb.GetTxRequest_Hash:
+		tx, err := g.s.txByHash(strings.ToLower(key.Hash), 0)
+		if err != nil {
+			return nil, err
+		}
+		return locatedTxToPB(tx), nil
+	}
+	return nil, badRequest("location or hash required")
+}
+
+func (g *chainService) SubmitTx(ctx context.Context, req *chainpb.SubmitTxRequest) (*chainpb.TxReceipt, error) {
+	if req.GetTransaction() == nil {
+		return nil, badRequest("transaction required")
+	}
+	tx := txFromPB(req.GetTransaction())
+	priority := int(req.GetPriority())
+	receipt, err := g.s.onLeader(ctx, http.MethodPost, apiPrefix+"transactions?priority="+strconv.Itoa(priority), tx, func() (TxReceipt, error) {
+		return g.s.addTx(tx, priority)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receiptToPB(receipt), nil
+}
+
+func (g *chainService) Modify(ctx context.Context, req *chainpb.ModifyRequest) (*chainpb.TxReceipt, error) {
+	if req.GetTransaction() == nil {
+		return nil, badRequest("transaction required")
+	}
+	tx := txFromPB(req.GetTransaction())
+	height, txId := int(req.GetHeight()), int(req.GetTxId())
+	path := fmt.Sprintf("%sblocks/%d/transactions/%d", apiPrefix, height, txId)
+	receipt, err := g.s.onLeader(ctx, http.MethodPut, path, tx, func() (TxReceipt, error) {
+		return g.s.modifyTx(height, txId, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receiptToPB(receipt), nil
+}
+
+// SubscribeBlocks reads the blocks from the store and waits on the event
+// bus for new ones, so a stream which fell behind just subscribes again.
+func (g *chainService) SubscribeBlocks(req *chainpb.SubscribeBlocksRequest, stream chainpb.Chain_SubscribeBlocksServer) error {
+	next := int(req.GetFromHeight())
+	if next < 0 {
+		return badRequest("invalid from_height: %d", next)
+	}
+	filter := EventFilter{Types: []string{EventBlock}}
+	sub, _, _ := g.s.events.subscribe(filter, 0, false)
+	defer func() {
+		g.s.events.unsubscribe(sub)
+	}()
+	for {
+		top, err := g.s.store.Height()
+		if err != nil {
+			return err
+		}
+		for ; next <= top; next++ {
+			block, err := g.s.store.GetBlock(next)
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(blockToPB(block)); err != nil {
+				return err
+			}
+		}
+		select {
+		case _, ok := <-sub.c:
+			if !ok {
+				sub, _, _ = g.s.events.subscribe(filter, 0, false)
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (g *chainService) SubscribeRedactions(req *chainpb.SubscribeRedactionsRequest, stream chainpb.Chain_SubscribeRedactionsServer) error {
+	sub, _, _ := g.s.events.subscribe(EventFilter{Types: []string{EventRedaction}}, 0, false)
+	defer g.s.events.unsubscribe(sub)
+	for {
+		select {
+		case e, ok := <-sub.c:
+			if !ok {
+				return errFellBehind
+			}
+			err := stream.Send(&chainpb.Redaction{
+				Height:      int64(e.Height),
+				TxId:        int64(*e.TxId),
+				Transaction: txToPB(e.Transaction),
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
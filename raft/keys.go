@@ -0,0 +1,250 @@
+package raft
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/identity"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Meta key of the replicated node key map.
+const keysKey = "node_keys"
+
+// How often a node retries registering its key until it is committed.
+const registerRetry = time.Second
+
+// Public keys of the cluster members by name, replicated through the
+// consensus engine. A name keeps the key it registered first.
+type NodeKeys map[string]ed25519.PublicKey
+
+func loadKeys(st store.Store) (NodeKeys, error) {
+	keys := NodeKeys{}
+	err := st.GetMeta(keysKey, &keys)
+	if err == store.ErrNotFound {
+		return NodeKeys{}, nil
+	}
+	return keys, err
+}
+
+// Reads a key map as served by /v1/keys from a file.
+func ReadKeysFile(path string) (NodeKeys, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := NodeKeys{}
+	if err = json.Unmarshal(raw, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Verify checks the seal of a block and that the sealer is a member with
+// that key. The genesis block is not sealed.
+func (keys NodeKeys) Verify(block *data.BasicBlock) error {
+	if block.HeadB.Height == 0 {
+		return nil
+	}
+	if !block.VerifySeal() {
+		return fmt.Errorf("block %d has no valid seal", block.HeadB.Height)
+	}
+	key, ok := keys[block.HeadB.Sealer]
+	if !ok {
+		return fmt.Errorf("block %d sealed by unknown node %q", block.HeadB.Height, block.HeadB.Sealer)
+	}
+	if !key.Equal(ed25519.PublicKey(block.HeadB.SealerKey)) {
+		return fmt.Errorf("block %d sealed with a key which is not %s's", block.HeadB.Height, block.HeadB.Sealer)
+	}
+	return nil
+}
+
+// Replaces the node key, by default created in the data path on first
+// start. Must be called before ListenAndServe.
+func (s *Server) SetIdentity(id *identity.Identity) {
+	s.identity = id
+}
+
+func (s *Server) Identity() *identity.Identity {
+	return s.identity
+}
+
+// registerKey adds the node key to the cluster's key map, retrying until
+// the registration is committed.
+func (s *Server) registerKey() {
+	for {
+		keys, err := loadKeys(s.store)
+		if err == nil && keys[s.identity.Name].Equal(s.identity.PublicKey) {
+			return
+		}
+		if err == nil {
+			err = s.proposeKey()
+		}
+		if err == nil {
+			return
+		}
+		logging.Debug("node key registration pending", "err", err)
+		if !s.sleep(registerRetry) {
+			return
+		}
+	}
+}
+
+func (s *Server) proposeKey() error {
+	cmd := NewRegisterKeyCommand(s.identity)
+	_, err := s.engine.Propose(cmd)
+	if err != consensus.ErrNotLeader {
+		return err
+	}
+	leader := s.leaderURL()
+	if leader == "" {
+		return errors.New("no leader available")
+	}
+	content, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	_, err = post(leader+"/keys", content)
+	return err
+}
+
+// isMember reports whether name is a member of the cluster. Only members
+// register keys, so a key map entry names a node of the cluster.
+func (s *Server) isMember(name string) bool {
+	for _, m := range s.engine.Members() {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// This command adds a node's public key to the key map. The node signs its
+// name with the key, so nobody registers a key they do not hold.
+type RegisterKeyCommand struct {
+	Name      string            `json:"name"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Signature []byte            `json:"signature"`
+}
+
+func registration(name string) []byte {
+	return []byte("register node key:" + name)
+}
+
+// Creates a new key registration of id.
+func NewRegisterKeyCommand(id *identity.Identity) *RegisterKeyCommand {
+	return &RegisterKeyCommand{
+		Name:      id.Name,
+		PublicKey: id.PublicKey,
+		Signature: id.Sign(registration(id.Name)),
+	}
+}
+
+// The name of the command in the log.
+func (c *RegisterKeyCommand) CommandName() string {
+	return "Register Node Key"
+}
+
+func (c *RegisterKeyCommand) Verify() error {
+	if c.Name == "" || !identity.Verify(c.PublicKey, registration(c.Name), c.Signature) {
+		return errors.New("invalid node key registration")
+	}
+	return nil
+}
+
+func (c *RegisterKeyCommand) Execute(state interface{}) (interface{}, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	st := storeOf(state)
+	keys, err := loadKeys(st)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[c.Name]; ok {
+		if key.Equal(c.PublicKey) {
+			return nil, nil
+		}
+		return nil, errors.New("node " + c.Name + " already has another key")
+	}
+	keys[c.Name] = c.PublicKey
+	if err = st.PutMeta(keysKey, keys); err != nil {
+		return nil, err
+	}
+	logging.Info("node key registered", "name", c.Name)
+	return nil, nil
+}
+
+// Client function
+func GetKeys(host, consistency string) (keys NodeKeys, err error) {
+	keys = NodeKeys{}
+	err = getV1(consistency, host+"/v1/keys", &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Checks the seal of a block against the key map of the cluster at host.
+// A block file carries its sealer's key, so it also verifies when it was
+// copied from another node.
+func VerifyBlock(host string, block *data.BasicBlock) error {
+	keys, err := GetKeys(host, "")
+	if err != nil {
+		return err
+	}
+	return keys.Verify(block)
+}
+
+// Server handler
+func (s *Server) getKeysHandler(w http.ResponseWriter, req *http.Request) {
+	keys, err := loadKeys(s.store)
+	if err == nil {
+		var resp []byte
+		if resp, err = json.Marshal(keys); err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(resp)
+			return
+		}
+	}
+	logging.Warn("request failed", "path", req.URL.Path, "err", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (s *Server) registerKeyHandler(w http.ResponseWriter, req *http.Request) {
+	var err error
+	defer func() {
+		if err != nil {
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}()
+	cmd := &RegisterKeyCommand{}
+	if err = json.NewDecoder(req.Body).Decode(cmd); err != nil {
+		return
+	}
+	if err = cmd.Verify(); err != nil {
+		return
+	}
+	if !s.isMember(cmd.Name) {
+		logging.Warn("key registration rejected", "name", cmd.Name, "remote", req.RemoteAddr)
+		http.Error(w, "node "+cmd.Name+" is not a member of the cluster", http.StatusForbidden)
+		err = nil
+		return
+	}
+	if _, err = s.engine.Propose(cmd); err != nil {
+		return
+	}
+	w.Write([]byte("Success:Key of node " + cmd.Name + " registered"))
+}
+
+func (s *Server) apiKeys(req *http.Request) (interface{}, error) {
+	return loadKeys(s.store)
+}
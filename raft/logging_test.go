@@ -0,0 +1,38 @@
+package raft
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/RedactableBlockChain/logging"
+)
+
+// No code path of the chain writes tx payloads or proofs to the log while
+// debug payloads are off, whatever the level and payload mode.
+func TestNoPayloadInLog(t *testing.T) {
+	for _, mode := range []logging.Mode{logging.Hash, logging.Truncate, logging.Omit, logging.Full} {
+		out := &bytes.Buffer{}
+		logging.Setup(logging.Config{Level: slog.LevelDebug, Output: out, PayloadMode: mode})
+		s, para := newTestServer(t)
+		addAndPack(t, s, para, "secret-before")
+		tx, err := s.tx(1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Modify([]byte("secret-after"), []byte("secret-proof"), para.Tk, chainParameter(para)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.modifyTx(1, 0, tx); err != nil {
+			t.Fatal(err)
+		}
+		logging.Setup(logging.Config{Level: slog.LevelInfo})
+		if !strings.Contains(out.String(), "transaction modified") {
+			t.Fatalf("mode %s: modification not logged:\n%s", mode, out)
+		}
+		if strings.Contains(out.String(), "secret") {
+			t.Errorf("mode %s: payload in log:\n%s", mode, out)
+		}
+	}
+}
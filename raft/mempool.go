@@ -0,0 +1,73 @@
+package raft
+
+import (
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"net/http"
+)
+
+// This command changes the mempool config of the cluster. Admission and
+// eviction run inside the replicated AddTx and Pack commands, so the limits
+// must come from the log rather than from the flags of each node.
+type SetPoolConfigCommand struct {
+	Config mempool.Config `json:"config"`
+}
+
+// Creates a new pool config command.
+func NewSetPoolConfigCommand(c mempool.Config) *SetPoolConfigCommand {
+	return &SetPoolConfigCommand{Config: c}
+}
+
+// The name of the command in the log.
+func (c *SetPoolConfigCommand) CommandName() string {
+	return "Set Pool Config"
+}
+
+// Stores the config and applies it to the pool.
+func (c *SetPoolConfigCommand) Execute(state interface{}) (interface{}, error) {
+	if err := poolOf(state).SetConfig(c.Config); err != nil {
+		return nil, err
+	}
+	logging.Info("mempool config set",
+		"max_txs", c.Config.MaxTxs,
+		"max_bytes", c.Config.MaxBytes,
+		"ttl", c.Config.TTL,
+		"ordering", c.Config.Ordering)
+	return nil, nil
+}
+
+// Client function
+func GetPoolConfig(host, consistency string) (c *mempool.Config, err error) {
+	c = &mempool.Config{}
+	err = getV1(consistency, host+"/v1/mempool/config", c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func SetPoolConfig(host string, c mempool.Config) (returnData []byte, err error) {
+	return sendV1(http.MethodPut, host+"/v1/mempool/config", c)
+}
+
+// Server handler
+func (s *Server) apiPoolConfig(req *http.Request) (interface{}, error) {
+	return s.pool.Config(), nil
+}
+
+func (s *Server) apiSetPoolConfig(req *http.Request) (interface{}, error) {
+	c := mempool.Config{}
+	if err := decodeBody(req, &c); err != nil {
+		return nil, err
+	}
+	if c.Ordering == "" {
+		c.Ordering = mempool.FIFO
+	}
+	if err := c.Validate(); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if _, err := s.engine.Propose(NewSetPoolConfigCommand(c)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
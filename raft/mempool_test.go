@@ -0,0 +1,68 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/mempool"
+)
+
+// The replicated config, not the one the pool was opened with, decides
+// admission, and it survives a reopen of the pool.
+func TestPoolConfigReplicated(t *testing.T) {
+	s, para := newTestServer(t)
+	c := mempool.Config{MaxTxs: 1, Ordering: mempool.FIFO}
+	if _, err := s.engine.Propose(NewSetPoolConfigCommand(c)); err != nil {
+		t.Fatal(err)
+	}
+	for i, payload := range []string{"first", "second"} {
+		tx, err := data.NewBasicTx([]byte(payload), []byte("p"), para.Hk, chainParameter(para))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.addTx(tx, 0)
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && !errors.Is(err, mempool.ErrFull) {
+			t.Fatalf("second tx: %v", err)
+		}
+	}
+	if _, err := s.engine.Propose(NewSetPoolConfigCommand(mempool.Config{Ordering: "lifo"})); err == nil {
+		t.Fatal("invalid config accepted")
+	}
+
+	reopened, err := mempool.New(s.store, mempool.Config{MaxTxs: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Config() != c {
+		t.Fatalf("reopened with %+v", reopened.Config())
+	}
+}
+
+// Pages of the pool hold every pooled tx once, limit <= 0 all of them.
+func TestPoolPage(t *testing.T) {
+	s, para := newTestServer(t)
+	for _, payload := range []string{"a", "b", "c"} {
+		tx, err := data.NewBasicTx([]byte(payload), []byte("p"), para.Hk, chainParameter(para))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.addTx(tx, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, cursor := s.pool.Page("", 2)
+	if len(first) != 2 || cursor == "" {
+		t.Fatalf("first page %d entries, cursor %q", len(first), cursor)
+	}
+	rest, cursor := s.pool.Page(cursor, 2)
+	if len(rest) != 1 || cursor != "" || rest[0].Hash == first[0].Hash || rest[0].Hash == first[1].Hash {
+		t.Fatalf("second page %+v, cursor %q", rest, cursor)
+	}
+	if all, cursor := s.pool.Page("", 0); len(all) != 3 || cursor != "" {
+		t.Fatalf("unlimited page %d entries, cursor %q", len(all), cursor)
+	}
+}
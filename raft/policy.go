@@ -0,0 +1,206 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
+	"net/http"
+	"time"
+)
+
+// Meta key of the replicated block policy.
+const policyKey = "block_policy"
+
+// How often the leader checks whether a block is due.
+const mintTick = 100 * time.Millisecond
+
+// BlockPolicy decides when the leader seals a block and what a block may
+// hold. Durations are milliseconds, 0 disables the rule.
+//
+// A block is sealed as soon as the pool holds more than fits into one block,
+// when Interval has passed since the last block and txs are pending, or when
+// the oldest pending tx has waited MaxWait. With Heartbeat set an empty
+// block is sealed after that long without any block.
+type BlockPolicy struct {
+	MaxTxs    int `json:"max_txs"`
+	MaxBytes  int `json:"max_bytes"`
+	Interval  int `json:"interval"`
+	MaxWait   int `json:"max_wait"`
+	Heartbeat int `json:"heartbeat"`
+}
+
+func DefaultBlockPolicy() BlockPolicy {
+	return BlockPolicy{MaxTxs: MAX_BLOCK_TX_NUM, Interval: 10000}
+}
+
+func (p BlockPolicy) Validate() error {
+	if p.MaxTxs <= 0 {
+		return errors.New("block policy: max_txs must be positive")
+	}
+	if p.MaxBytes < 0 || p.Interval < 0 || p.MaxWait < 0 || p.Heartbeat < 0 {
+		return errors.New("block policy: limits and durations must not be negative")
+	}
+	if p.Interval == 0 && p.MaxWait == 0 {
+		return errors.New("block policy: interval or max_wait is required to seal partial blocks")
+	}
+	return nil
+}
+
+// Check rejects blocks the policy does not allow.
+func (p BlockPolicy) Check(block *data.BasicBlock) error {
+	count := block.HeadB.TxCount
+	if count == 0 && p.Heartbeat == 0 {
+		return errors.New("empty block while heartbeat blocks are disabled")
+	}
+	if count > p.MaxTxs {
+		return fmt.Errorf("block holds %d transactions, policy allows %d", count, p.MaxTxs)
+	}
+	if p.MaxBytes > 0 {
+		size := 0
+		for i := 0; i < count; i++ {
+			size += mempool.Size(&block.TransactionsB[i])
+		}
+		if size > p.MaxBytes {
+			return fmt.Errorf("block holds %d bytes of transactions, policy allows %d", size, p.MaxBytes)
+		}
+	}
+	return nil
+}
+
+func elapsed(since, now time.Time, ms int) bool {
+	return ms > 0 && !since.IsZero() && now.Sub(since) >= time.Duration(ms)*time.Millisecond
+}
+
+// due reports whether the leader should seal a block of count txs now.
+// full means the pool holds more than one block, last is when the last
+// block was sealed and pending since when txs have been waiting.
+func (p BlockPolicy) due(count int, full bool, last, pending, now time.Time) bool {
+	if count == 0 {
+		return elapsed(last, now, p.Heartbeat)
+	}
+	return full || count >= p.MaxTxs || elapsed(last, now, p.Interval) || elapsed(pending, now, p.MaxWait)
+}
+
+// Loads the replicated policy, or def if none was set yet.
+func loadPolicy(st store.Store, def BlockPolicy) (BlockPolicy, error) {
+	p := BlockPolicy{}
+	err := st.GetMeta(policyKey, &p)
+	if err == store.ErrNotFound {
+		return def, nil
+	}
+	return p, err
+}
+
+func (s *Server) Policy() BlockPolicy {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.policy
+}
+
+func (s *Server) setPolicy(p BlockPolicy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.policy = p
+}
+
+// This command changes the block policy of the cluster.
+type SetPolicyCommand struct {
+	Policy BlockPolicy `json:"policy"`
+}
+
+// Creates a new policy command.
+func NewSetPolicyCommand(p BlockPolicy) *SetPolicyCommand {
+	return &SetPolicyCommand{Policy: p}
+}
+
+// The name of the command in the log.
+func (c *SetPolicyCommand) CommandName() string {
+	return "Set Block Policy"
+}
+
+// Stores the policy and applies it to block production and validation.
+func (c *SetPolicyCommand) Execute(state interface{}) (interface{}, error) {
+	if err := c.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := storeOf(state).PutMeta(policyKey, c.Policy); err != nil {
+		return nil, err
+	}
+	chainOf(state).setPolicy(c.Policy)
+	logging.Info("block policy set",
+		"max_txs", c.Policy.MaxTxs,
+		"max_bytes", c.Policy.MaxBytes,
+		"interval", c.Policy.Interval,
+		"max_wait", c.Policy.MaxWait,
+		"heartbeat", c.Policy.Heartbeat)
+	return nil, nil
+}
+
+// Client function
+func GetPolicy(host, consistency string) (p *BlockPolicy, err error) {
+	p = &BlockPolicy{}
+	err = getV1(consistency, host+"/v1/policy", p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func SetPolicy(host string, p BlockPolicy) (returnData []byte, err error) {
+	return sendV1(http.MethodPut, host+"/v1/policy", p)
+}
+
+// Server handler
+func (s *Server) getPolicyHandler(w http.ResponseWriter, req *http.Request) {
+	resp, err := json.Marshal(s.Policy())
+	if err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *Server) setPolicyHandler(w http.ResponseWriter, req *http.Request) {
+	var err error
+	defer func() {
+		if err != nil {
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}()
+	p := BlockPolicy{}
+	if err = json.NewDecoder(req.Body).Decode(&p); err != nil {
+		return
+	}
+	if err = p.Validate(); err != nil {
+		return
+	}
+	if _, err = s.engine.Propose(NewSetPolicyCommand(p)); err != nil {
+		return
+	}
+	w.Write([]byte("Success:Block policy updated"))
+}
+
+func (s *Server) apiPolicy(req *http.Request) (interface{}, error) {
+	return s.Policy(), nil
+}
+
+func (s *Server) apiSetPolicy(req *http.Request) (interface{}, error) {
+	p := BlockPolicy{}
+	if err := decodeBody(req, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if _, err := s.engine.Propose(NewSetPolicyCommand(p)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,466 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// One page of txs: of a chameleon public key, of the whole chain or found
+// by a search.
+type TxPage struct {
+	Transactions []TxEntry `json:"transactions"`
+	NextCursor   string    `json:"next_cursor"`
+}
+
+type TxEntry struct {
+	index.TxRef
+	Transaction data.BasicTx `json:"transaction"`
+}
+
+// One page of block heads.
+type BlockPage struct {
+	Blocks     []data.BasicHead `json:"blocks"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+// One page of pooled txs in pool order.
+type PoolPage struct {
+	Transactions []PoolEntry `json:"transactions"`
+	NextCursor   string      `json:"next_cursor"`
+}
+
+// Reads an optional integer query parameter.
+func queryInt(req *http.Request, name string, def int) (int, error) {
+	v := req.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, badRequest("invalid %s: %s", name, v)
+	}
+	return n, nil
+}
+
+// Client function
+func GetTxsByPk(host, pk string, from, to int, cursor string, limit int, consistency string) (page *TxPage, err error) {
+	q := url.Values{}
+	q.Set("pk", pk)
+	q.Set("from", strconv.Itoa(from))
+	q.Set("to", strconv.Itoa(to))
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &TxPage{}
+	err = getV1(consistency, host+"/v1/transactions?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func GetBlocksByTime(host string, from, to int, cursor string, limit int, consistency string) (page *BlockPage, err error) {
+	q := url.Values{}
+	q.Set("from", strconv.Itoa(from))
+	q.Set("to", strconv.Itoa(to))
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &BlockPage{}
+	err = getV1(consistency, host+"/v1/blocks/by_time?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Block heads with heights in [from, to], to <= 0 is the current height.
+func GetBlocks(host string, from, to int, cursor string, limit int, consistency string) (page *BlockPage, err error) {
+	q := url.Values{}
+	q.Set("from", strconv.Itoa(from))
+	q.Set("to", strconv.Itoa(to))
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &BlockPage{}
+	err = getV1(consistency, host+"/v1/blocks?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Every tx on the chain in chain order, within [from, to] (unix seconds,
+// 0 means unbounded).
+func GetTxs(host string, from, to int, cursor string, limit int, consistency string) (page *TxPage, err error) {
+	q := url.Values{}
+	q.Set("from", strconv.Itoa(from))
+	q.Set("to", strconv.Itoa(to))
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &TxPage{}
+	err = getV1(consistency, host+"/v1/transactions?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func GetPoolTxs(host, cursor string, limit int, consistency string) (page *PoolPage, err error) {
+	q := url.Values{}
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &PoolPage{}
+	err = getV1(consistency, host+"/v1/mempool/transactions?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func getJSON(u string, v interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(string(res))
+	}
+	return json.Unmarshal(res, v)
+}
+
+func Search(host, query, cursor string, limit int, consistency string) (page *TxPage, err error) {
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &TxPage{}
+	err = getV1(consistency, host+"/v1/search?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// txsByPk returns a page of the txs of the public key pk.
+func (s *Server) txsByPk(req *http.Request) (*TxPage, error) {
+	pk := req.URL.Query().Get("pk")
+	if pk == "" {
+		return nil, badRequest("pk required")
+	}
+	from, err := queryInt(req, "from", 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := queryInt(req, "to", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	refs, next, err := index.TxsByPk(s.store, []byte(pk), from, to, req.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		return nil, err
+	}
+	page := &TxPage{Transactions: []TxEntry{}, NextCursor: next}
+	var block *data.BasicBlock
+	for _, ref := range refs {
+		if block == nil || block.HeadB.Height != ref.Height {
+			block, err = s.store.GetBlock(ref.Height)
+			if err != nil {
+				return nil, err
+			}
+		}
+		page.Transactions = append(page.Transactions, TxEntry{TxRef: ref, Transaction: block.Transactions(ref.TxId)})
+	}
+	return page, nil
+}
+
+// blocksByHeight returns a page of the block heads with heights in
+// [from, to], to <= 0 is the current height. The cursor is the height of
+// the last head of the previous page: heads never change, a redaction
+// keeps the hash root.
+func (s *Server) blocksByHeight(req *http.Request) (*BlockPage, error) {
+	from, err := queryInt(req, "from", 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := queryInt(req, "to", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	limit = index.ClampLimit(limit)
+	if cursor := req.URL.Query().Get("cursor"); cursor != "" {
+		h, err := strconv.Atoi(cursor)
+		if err != nil || h < 0 {
+			return nil, badRequest("invalid cursor: %s", cursor)
+		}
+		if h >= from {
+			from = h + 1
+		}
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	if to <= 0 || to > top {
+		to = top
+	}
+	page := &BlockPage{Blocks: []data.BasicHead{}}
+	for h := from; h <= to; h++ {
+		if len(page.Blocks) == limit {
+			page.NextCursor = strconv.Itoa(h - 1)
+			break
+		}
+		block, err := s.store.GetBlock(h)
+		if err != nil {
+			return nil, err
+		}
+		page.Blocks = append(page.Blocks, block.HeadB)
+	}
+	return page, nil
+}
+
+func (s *Server) blocksByTime(req *http.Request) (*BlockPage, error) {
+	from, err := queryInt(req, "from", 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := queryInt(req, "to", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	refs, next, err := index.BlocksByTime(s.store, from, to, req.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		return nil, err
+	}
+	page := &BlockPage{Blocks: []data.BasicHead{}, NextCursor: next}
+	for _, ref := range refs {
+		block, err := s.store.GetBlock(ref.Height)
+		if err != nil {
+			return nil, err
+		}
+		page.Blocks = append(page.Blocks, block.HeadB)
+	}
+	return page, nil
+}
+
+// How many blocks a page of chainTxs reads at most, so that runs of empty
+// blocks do not make one request read the chain.
+const maxPageBlocks = index.MaxLimit
+
+// chainTxs returns a page of every tx on the chain in chain order, in
+// blocks sealed within [from, to] (unix seconds, 0 means unbounded). The
+// cursor is the position of the last tx of the previous page, which a
+// redaction does not move. A page which read maxPageBlocks blocks ends
+// early, with fewer txs than limit or none, and the cursor past the last
+// block it read.
+func (s *Server) chainTxs(req *http.Request) (*TxPage, error) {
+	from, err := queryInt(req, "from", 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := queryInt(req, "to", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	limit = index.ClampLimit(limit)
+	height, txId := 0, 0
+	if cursor := req.URL.Query().Get("cursor"); cursor != "" {
+		if height, txId, err = parseTxCursor(cursor); err != nil {
+			return nil, err
+		}
+		txId++
+	}
+	page := &TxPage{Transactions: []TxEntry{}}
+	if from > 0 {
+		refs, _, err := index.BlocksByTime(s.store, from, 0, "", 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) == 0 {
+			return page, nil
+		}
+		if refs[0].Height > height {
+			height, txId = refs[0].Height, 0
+		}
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	for read := 1; height <= top; height, txId, read = height+1, 0, read+1 {
+		block, err := s.store.GetBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		if to > 0 && block.HeadB.Timestamp > to {
+			break
+		}
+		for ; txId < block.HeadB.TxCount; txId++ {
+			if len(page.Transactions) == limit {
+				last := page.Transactions[limit-1]
+				page.NextCursor = txCursor(last.Height, last.TxId)
+				return page, nil
+			}
+			ref := index.TxRef{Height: height, TxId: txId, Timestamp: block.HeadB.Timestamp}
+			page.Transactions = append(page.Transactions, TxEntry{TxRef: ref, Transaction: block.Transactions(txId)})
+		}
+		if read == maxPageBlocks && height < top {
+			// txId is past the txs of the block
+			page.NextCursor = txCursor(height, txId)
+			return page, nil
+		}
+	}
+	return page, nil
+}
+
+func txCursor(height, txId int) string {
+	return fmt.Sprintf("%012d/%06d", height, txId)
+}
+
+// parseTxCursor reads the <height>/<txId> cursor of chainTxs.
+func parseTxCursor(cursor string) (height, txId int, err error) {
+	f := strings.Split(cursor, "/")
+	if len(f) == 2 {
+		height, err = strconv.Atoi(f[0])
+		if err == nil {
+			txId, err = strconv.Atoi(f[1])
+		}
+		if err == nil && height >= 0 && txId >= 0 {
+			return height, txId, nil
+		}
+	}
+	return 0, 0, badRequest("invalid cursor: %s", cursor)
+}
+
+// poolTxs returns a page of the pool in pool order.
+func (s *Server) poolTxs(req *http.Request) (*PoolPage, error) {
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	entries, next := s.pool.Page(req.URL.Query().Get("cursor"), index.ClampLimit(limit))
+	page := &PoolPage{Transactions: []PoolEntry{}, NextCursor: next}
+	for _, e := range entries {
+		page.Transactions = append(page.Transactions, PoolEntry{Entry: e, Transaction: e.Tx})
+	}
+	return page, nil
+}
+
+func (s *Server) search(req *http.Request) (*TxPage, error) {
+	query := req.URL.Query().Get("q")
+	if query == "" {
+		return nil, badRequest("q required")
+	}
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	refs, next, err := index.Search(s.store, query, req.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		return nil, err
+	}
+	page := &TxPage{Transactions: []TxEntry{}, NextCursor: next}
+	for _, ref := range refs {
+		block, err := s.store.GetBlock(ref.Height)
+		if err != nil {
+			return nil, err
+		}
+		tx := block.Transactions(ref.TxId)
+		if !index.Matches(tx.PayloadB, query) {
+			continue
+		}
+		ref.Timestamp = block.HeadB.Timestamp
+		page.Transactions = append(page.Transactions, TxEntry{TxRef: ref, Transaction: tx})
+	}
+	return page, nil
+}
+
+// writeJSON answers a request of the deprecated API with v.
+func writeJSON(w http.ResponseWriter, req *http.Request, v interface{}, err error) {
+	var resp []byte
+	if err == nil {
+		resp, err = json.Marshal(v)
+	}
+	if err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// Server handler
+func (s *Server) getTxsHandler(w http.ResponseWriter, req *http.Request) {
+	page, err := s.txsByPk(req)
+	writeJSON(w, req, page, err)
+}
+
+func (s *Server) getBlocksByTimeHandler(w http.ResponseWriter, req *http.Request) {
+	page, err := s.blocksByTime(req)
+	writeJSON(w, req, page, err)
+}
+
+func (s *Server) searchHandler(w http.ResponseWriter, req *http.Request) {
+	page, err := s.search(req)
+	writeJSON(w, req, page, err)
+}
+
+func (s *Server) mempoolHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, req, s.pool.Status(), nil)
+}
+
+func (s *Server) apiBlocks(req *http.Request) (interface{}, error) {
+	return s.blocksByHeight(req)
+}
+
+// The txs of a public key, or of the whole chain without pk.
+func (s *Server) apiTxs(req *http.Request) (interface{}, error) {
+	if req.URL.Query().Get("pk") == "" {
+		return s.chainTxs(req)
+	}
+	return s.txsByPk(req)
+}
+
+func (s *Server) apiBlocksByTime(req *http.Request) (interface{}, error) {
+	return s.blocksByTime(req)
+}
+
+func (s *Server) apiSearch(req *http.Request) (interface{}, error) {
+	return s.search(req)
+}
+
+func (s *Server) apiMempool(req *http.Request) (interface{}, error) {
+	return s.pool.Status(), nil
+}
+
+func (s *Server) apiPoolTxs(req *http.Request) (interface{}, error) {
+	return s.poolTxs(req)
+}
@@ -0,0 +1,135 @@
+package raft
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTxCursor(t *testing.T) {
+	for cursor, valid := range map[string]bool{
+		"000000000003/000002": true,
+		"3/2":                 true,
+		"3":                   false,
+		"3/2/1":               false,
+		"-1/0":                false,
+		"3/-1":                false,
+		"a/b":                 false,
+	} {
+		height, txId, err := parseTxCursor(cursor)
+		if (err == nil) != valid || (valid && (height != 3 || txId != 2)) {
+			t.Errorf("%q: %d/%d, %v", cursor, height, txId, err)
+		}
+	}
+	if c := txCursor(3, 2); c != "000000000003/000002" {
+		t.Fatalf("cursor %s", c)
+	}
+}
+
+func query(values ...string) string {
+	q := url.Values{}
+	for i := 0; i < len(values); i += 2 {
+		q.Set(values[i], values[i+1])
+	}
+	return q.Encode()
+}
+
+func TestBlocksByHeight(t *testing.T) {
+	s, para := newTestServer(t)
+	for _, p := range []string{"a", "b", "c"} {
+		addAndPack(t, s, para, p)
+	}
+	var heights []int
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err := s.blocksByHeight(httptest.NewRequest("GET", "/v1/blocks?"+query("from", "1", "limit", "2", "cursor", cursor), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range page.Blocks {
+			heights = append(heights, h.Height)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("paging does not end")
+		}
+	}
+	if len(heights) != 3 || heights[0] != 1 || heights[2] != 3 {
+		t.Fatalf("heights %v", heights)
+	}
+	if _, err := s.blocksByHeight(httptest.NewRequest("GET", "/v1/blocks?cursor=x", nil)); err == nil {
+		t.Fatal("invalid cursor accepted")
+	}
+}
+
+// chainTxs pages every tx once, also when a tx of a page already read is
+// redacted in between.
+func TestChainTxsAcrossRedaction(t *testing.T) {
+	s, para := newTestServer(t)
+	addAndPack(t, s, para, "a", "b")
+	addAndPack(t, s, para, "c")
+	page, err := s.chainTxs(httptest.NewRequest("GET", "/v1/transactions?limit=2", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page %+v", page)
+	}
+
+	tx, err := s.tx(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Modify([]byte("b redacted"), []byte("proof"), para.Tk, chainParameter(para)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.modifyTx(1, 1, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := s.chainTxs(httptest.NewRequest("GET", "/v1/transactions?"+query("limit", "2", "cursor", page.NextCursor), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Transactions) != 1 || string(next.Transactions[0].Transaction.PayloadB) != "c" || next.NextCursor != "" {
+		t.Fatalf("second page %+v", next)
+	}
+	again, err := s.chainTxs(httptest.NewRequest("GET", "/v1/transactions?limit=2", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.NextCursor != page.NextCursor || string(again.Transactions[1].Transaction.PayloadB) != "b redacted" {
+		t.Fatalf("first page after the redaction %+v", again)
+	}
+}
+
+// A page stops after maxPageBlocks blocks, however few txs they hold.
+func TestChainTxsEmptyBlocks(t *testing.T) {
+	s, para := newTestServer(t)
+	if _, err := s.engine.Propose(NewSetPolicyCommand(BlockPolicy{MaxTxs: 10, Interval: 1000, Heartbeat: 1000})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxPageBlocks+5; i++ {
+		if err := s.seal(nil, time.Unix(int64(1700000000+i), 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addAndPack(t, s, para, "late")
+	page, err := s.chainTxs(httptest.NewRequest("GET", "/v1/transactions", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 0 || page.NextCursor == "" {
+		t.Fatalf("first page %d txs, cursor %q", len(page.Transactions), page.NextCursor)
+	}
+	page, err = s.chainTxs(httptest.NewRequest("GET", "/v1/transactions?"+query("cursor", page.NextCursor), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 1 || string(page.Transactions[0].Transaction.PayloadB) != "late" || page.NextCursor != "" {
+		t.Fatalf("second page %+v", page)
+	}
+}
@@ -1,19 +1,23 @@
 package raft
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/RedactableBlockChain/consensus"
 	"github.com/RedactableBlockChain/data"
-	"github.com/RedactableBlockChain/path"
-	"github.com/goraft/raft"
+	"github.com/RedactableBlockChain/identity"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -21,33 +25,76 @@ import (
 	"time"
 )
 
-const(
-	MIN_BLOCK_TX_NUM = 1
-	MAX_BLOCK_TX_NUM =100
-)
+// Default block size of the block policy.
+const MAX_BLOCK_TX_NUM = 100
 
-// The raftd server is a combination of the Raft server and an HTTP
+// The raftd server is a combination of a consensus engine and an HTTP
 // server which acts as the transport.
 type Server struct {
-	name       string
-	host       string
-	port       int
-	path       string
-	epoch      int
-	router     *mux.Router
-	raftServer raft.Server
-	httpServer *http.Server
-	mutex      sync.RWMutex
+	name             string
+	host             string
+	port             int
+	path             string
+	policy           BlockPolicy
+	forward          ForwardConfig
+	delivery         DeliveryConfig
+	readMode         string
+	snapshotInterval uint64
+	router           *mux.Router
+	engine           consensus.Engine
+	sealers          Sealers
+	identity         *identity.Identity
+	trusted          NodeKeys
+	webhookKey       []byte
+	ballots          ballots
+	outbox           voteOutbox
+	tls              *tls.Config
+	peerAuth         bool
+	principals       Principals
+	authBootstrap    bool
+	peerRoutes       map[string]bool
+	audit            *auditLog
+	events           eventBus
+	httpServer       *http.Server
+	grpcPort         int
+	grpcServer       *grpc.Server
+	store            store.Store
+	pool             *mempool.Pool
+	mutex            sync.RWMutex
+	// Closed by Shutdown, and once the HTTP server is down.
+	stopped  chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
 }
 
-// Creates a new server.
-func New(path, host string, port, epoch int) *Server {
+// Creates a new server. The policy only seeds a new cluster, a node which
+// already holds a replicated policy keeps that one.
+func New(path, host string, port int, policy BlockPolicy, st store.Store, pool *mempool.Pool) *Server {
 	s := &Server{
-		host:   host,
-		port:   port,
-		path:   path,
-		epoch:  epoch,
-		router: mux.NewRouter(),
+		host:       host,
+		port:       port,
+		path:       path,
+		router:     mux.NewRouter(),
+		store:      st,
+		pool:       pool,
+		forward:    DefaultForwardConfig(),
+		delivery:   DefaultDeliveryConfig(),
+		readMode:   ReadLocal,
+		peerRoutes: make(map[string]bool),
+		outbox:     voteOutbox{wake: make(chan struct{}, 1)},
+		stopped:    make(chan struct{}),
+		finished:   make(chan struct{}),
+	}
+	p, err := loadPolicy(st, policy)
+	if err != nil {
+		panic(err)
+	}
+	s.policy = p
+	if s.principals, err = loadPrincipals(st); err != nil {
+		panic(err)
+	}
+	if s.audit, err = openAuditLog(filepath.Join(path, auditFile)); err != nil {
+		panic(err)
 	}
 
 	// Read existing name or generate a new one.
@@ -59,392 +106,433 @@ func New(path, host string, port, epoch int) *Server {
 			panic(err)
 		}
 	}
+	s.identity, err = identity.LoadOrCreate(filepath.Join(path, "identity"), s.name)
+	if err != nil {
+		panic(err)
+	}
+	s.engine = consensus.NewGoraft(s.name, path, s.connectionString(), s, s)
 
 	return s
 }
 
 // Returns the connection string.
 func (s *Server) connectionString() string {
-	return fmt.Sprintf("http://%s:%d", s.host, s.port)
+	return fmt.Sprintf("%s://%s:%d", s.scheme(), s.host, s.port)
+}
+
+// Returns the connection string.
+func (s *Server) ConnectionString() string {
+	return s.connectionString()
+}
+
+func (s *Server) Name() string {
+	return s.name
+}
+
+// Replaces the consensus engine, goraft by default. Must be called before
+// ListenAndServe.
+func (s *Server) SetEngine(e consensus.Engine) {
+	s.engine = e
 }
 
 // Starts the server.
 func (s *Server) ListenAndServe(leader string) error {
-	var err error
-
-	log.Printf("Initializing Raft Server: %s", s.path)
+	if len(s.Principals()) > 0 && !s.peerAuth {
+		// peers could not reach each other's consensus routes
+		return errAuthWithoutPeerAuth
+	}
+	if hooks, err := loadWebhooks(s.store); err != nil {
+		return err
+	} else if len(hooks) > 0 && len(s.webhookKey) == 0 {
+		// a leader could not sign the deliveries
+		return errNoWebhookKey
+	}
+	s.engine.Subscribe(s.finalize)
+	s.engine.Subscribe(s.events.publish)
+	if err := s.engine.Start(leader); err != nil {
+		logging.Fatal("start consensus engine failed", "leader", leader, "err", err)
+	}
 
-	// Initialize and start Raft server.
-	transporter := raft.NewHTTPTransporter("/raft", 200*time.Millisecond)
-	s.raftServer, err = raft.NewServer(s.name, s.path, transporter, nil, nil, "")
+	// A new cluster takes the block policy of the node which started it.
+	err := s.store.GetMeta(policyKey, &BlockPolicy{})
+	if err == store.ErrNotFound && leader == "" && s.engine.IsLeader() {
+		_, err = s.engine.Propose(NewSetPolicyCommand(s.Policy()))
+	}
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("initialize block policy failed", "err", err)
 	}
-	transporter.Install(s.raftServer, s)
-	s.raftServer.Start()
-
-	if leader != "" {
-		// Join to leader if specified.
-
-		log.Println("Attempting to join leader:", leader)
-
-		if !s.raftServer.IsLogEmpty() {
-			log.Fatal("Cannot join with an existing log")
-		}
-		if err := s.Join(leader); err != nil {
-			log.Fatal(err)
-		}
-
-	} else if s.raftServer.IsLogEmpty() {
-		// Initialize the server by joining itself.
-
-		log.Println("Initializing new cluster")
-
-		_, err := s.raftServer.Do(&raft.DefaultJoinCommand{
-			Name:             s.raftServer.Name(),
-			ConnectionString: s.connectionString(),
-		})
-		if err != nil {
-			log.Fatal(err)
+	// And its mempool config.
+	err = s.store.GetMeta(mempool.ConfigKey, &mempool.Config{})
+	if err == store.ErrNotFound && leader == "" && s.engine.IsLeader() {
+		_, err = s.engine.Propose(NewSetPoolConfigCommand(s.pool.Config()))
+	}
+	if err != nil {
+		logging.Fatal("initialize mempool config failed", "err", err)
+	}
+	if s.authBootstrap && leader == "" && s.engine.IsLeader() && len(s.Principals()) == 0 {
+		if err = s.bootstrapAuth(); err != nil {
+			logging.Fatal("initialize authentication failed", "err", err)
 		}
-
-	} else {
-		log.Println("Recovered from log")
 	}
 
-	log.Println("Initializing HTTP server")
+	logging.Info("initializing http server")
 
 	// Initialize and start HTTP server.
 	s.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: s.router,
+		Addr:      fmt.Sprintf(":%d", s.port),
+		Handler:   s.router,
+		TLSConfig: s.tls,
+	}
+
+	s.router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	s.router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	s.router.Use(s.authorize)
+
+	s.router.HandleFunc("/v1/openapi.json", s.apiSchemaHandler).Methods("GET")
+	s.router.HandleFunc("/v1/height", s.consistent(s.api(s.apiHeight))).Methods("GET")
+	s.router.HandleFunc("/v1/leader", s.consistent(s.api(s.apiLeader))).Methods("GET")
+	s.router.HandleFunc("/v1/blocks", s.consistent(s.api(s.apiBlocks))).Methods("GET")
+	s.router.HandleFunc("/v1/blocks", s.leaderOnly(s.api(s.apiAddBlock))).Methods("POST")
+	s.router.HandleFunc("/v1/blocks/by_time", s.consistent(s.api(s.apiBlocksByTime))).Methods("GET")
+	s.router.HandleFunc("/v1/blocks/{height:[0-9]+}", s.consistent(s.api(s.apiBlock))).Methods("GET")
+	s.router.HandleFunc("/v1/blocks/{height:[0-9]+}/certificate", s.consistent(s.api(s.apiCertifiedBlock))).Methods("GET")
+	s.router.HandleFunc("/v1/blocks/{height:[0-9]+}/transactions/{txId:[0-9]+}", s.consistent(s.api(s.apiTx))).Methods("GET")
+	s.router.HandleFunc("/v1/blocks/{height:[0-9]+}/transactions/{txId:[0-9]+}", s.leaderOnly(s.api(s.apiModifyTx))).Methods("PUT")
+	s.router.HandleFunc("/v1/transactions", s.consistent(s.api(s.apiTxs))).Methods("GET")
+	s.router.HandleFunc("/v1/transactions", s.leaderOnly(s.api(s.apiAddTx))).Methods("POST")
+	s.router.HandleFunc("/v1/transactions/{hash}", s.consistent(s.api(s.apiTxByHash))).Methods("GET")
+	s.router.HandleFunc("/v1/search", s.consistent(s.api(s.apiSearch))).Methods("GET")
+	s.router.HandleFunc("/v1/mempool", s.consistent(s.api(s.apiMempool))).Methods("GET")
+	s.router.HandleFunc("/v1/mempool/transactions", s.consistent(s.api(s.apiPoolTxs))).Methods("GET")
+	s.router.HandleFunc("/v1/mempool/config", s.consistent(s.api(s.apiPoolConfig))).Methods("GET")
+	s.router.HandleFunc("/v1/mempool/config", s.leaderOnly(s.api(s.apiSetPoolConfig))).Methods("PUT")
+	s.router.HandleFunc("/v1/policy", s.consistent(s.api(s.apiPolicy))).Methods("GET")
+	s.router.HandleFunc("/v1/policy", s.leaderOnly(s.api(s.apiSetPolicy))).Methods("PUT")
+	s.router.HandleFunc("/v1/cluster", s.consistent(s.api(s.apiCluster))).Methods("GET")
+	s.router.HandleFunc("/v1/cluster/members/{name}", s.leaderOnly(s.api(s.apiRemoveMember))).Methods("DELETE")
+	s.router.HandleFunc("/v1/leave", s.api(s.apiLeave)).Methods("POST")
+	s.router.HandleFunc("/v1/keys", s.consistent(s.api(s.apiKeys))).Methods("GET")
+	s.router.HandleFunc("/v1/events", s.eventsHandler).Methods("GET")
+	s.router.HandleFunc("/v1/events/ws", s.eventsWSHandler).Methods("GET")
+	s.router.HandleFunc("/v1/principals", s.consistent(s.api(s.apiPrincipals))).Methods("GET")
+	s.router.HandleFunc("/v1/principals/{name}", s.leaderOnly(s.api(s.apiSetPrincipal))).Methods("PUT")
+	s.router.HandleFunc("/v1/principals/{name}", s.leaderOnly(s.api(s.apiRevokePrincipal))).Methods("DELETE")
+	s.router.HandleFunc("/v1/webhooks", s.consistent(s.api(s.apiWebhooks))).Methods("GET")
+	s.router.HandleFunc("/v1/webhooks/outbox", s.consistent(s.api(s.apiOutbox))).Methods("GET")
+	s.router.HandleFunc("/v1/webhooks/dead_letters", s.consistent(s.api(s.apiDeadLetters))).Methods("GET")
+	s.router.HandleFunc("/v1/webhooks/dead_letters/{key}/retry", s.leaderOnly(s.api(s.apiRetryDeadLetter))).Methods("POST")
+	s.router.HandleFunc("/v1/webhooks/{name}", s.leaderOnly(s.api(s.apiSetWebhook))).Methods("PUT")
+	s.router.HandleFunc("/v1/webhooks/{name}", s.leaderOnly(s.api(s.apiRemoveWebhook))).Methods("DELETE")
+
+	// Deprecated aliases of the v1 routes.
+	s.router.HandleFunc("/get_transaction_by_hash/{hash}/{startHeight}", deprecated("/v1/transactions/{hash}", s.consistent(s.getTxByHashHandler))).Methods("GET")
+	s.router.HandleFunc("/get_transaction_by_index/{height}/{txId}", deprecated("/v1/blocks/{height}/transactions/{txId}", s.consistent(s.getTxByIndexHandler))).Methods("GET")
+	s.router.HandleFunc("/get_block_by_height/{height}", deprecated("/v1/blocks/{height}", s.consistent(s.getBlockByHeightHandler))).Methods("GET")
+	s.router.HandleFunc("/get_current_height", deprecated("/v1/height", s.consistent(s.getCurrentHeightHandler))).Methods("GET")
+	s.router.HandleFunc("/get_current_leader", deprecated("/v1/leader", s.consistent(s.getCurrentLeaderHandler))).Methods("GET")
+	s.router.HandleFunc("/transactions", deprecated("/v1/transactions", s.consistent(s.getTxsHandler))).Methods("GET")
+	s.router.HandleFunc("/blocks_by_time", deprecated("/v1/blocks/by_time", s.consistent(s.getBlocksByTimeHandler))).Methods("GET")
+	s.router.HandleFunc("/search", deprecated("/v1/search", s.consistent(s.searchHandler))).Methods("GET")
+	s.router.HandleFunc("/mempool", deprecated("/v1/mempool", s.consistent(s.mempoolHandler))).Methods("GET")
+	s.router.HandleFunc("/policy", deprecated("/v1/policy", s.consistent(s.getPolicyHandler))).Methods("GET")
+	s.router.HandleFunc("/cluster", deprecated("/v1/cluster", s.consistent(s.clusterHandler))).Methods("GET")
+	s.router.HandleFunc("/keys", deprecated("/v1/keys", s.consistent(s.getKeysHandler))).Methods("GET")
+	s.router.HandleFunc("/certified_block/{height}", deprecated("/v1/blocks/{height}/certificate", s.consistent(s.certifiedBlockHandler))).Methods("GET")
+	s.router.HandleFunc("/principals", deprecated("/v1/principals", s.consistent(s.getPrincipalsHandler))).Methods("GET")
+	s.router.HandleFunc("/policy", deprecated("/v1/policy", s.leaderOnly(s.setPolicyHandler))).Methods("POST")
+	s.router.HandleFunc("/modify/{height}/{txId}", deprecated("/v1/blocks/{height}/transactions/{txId}", s.leaderOnly(s.modifyHandler))).Methods("POST")
+	s.router.HandleFunc("/new_block", deprecated("/v1/blocks", s.leaderOnly(s.newBlockHandler))).Methods("POST")
+	s.router.HandleFunc("/new_transaction", deprecated("/v1/transactions", s.leaderOnly(s.newTxHandler))).Methods("POST")
+	s.router.HandleFunc("/remove/{name}", deprecated("/v1/cluster/members/{name}", s.leaderOnly(s.removeHandler))).Methods("POST")
+	s.router.HandleFunc("/leave", deprecated("/v1/leave", s.leaveHandler)).Methods("POST")
+	s.router.HandleFunc("/principals/{name}", deprecated("/v1/principals/{name}", s.leaderOnly(s.setPrincipalHandler))).Methods("POST")
+	s.router.HandleFunc("/principals/{name}/revoke", deprecated("/v1/principals/{name}", s.leaderOnly(s.revokePrincipalHandler))).Methods("POST")
+
+	// Traffic between nodes.
+	s.router.HandleFunc("/read_index", s.readIndexHandler).Methods("GET")
+	s.router.HandleFunc("/status", s.statusHandler).Methods("GET")
+	s.router.HandleFunc("/genesis", s.consistent(s.genesisHandler)).Methods("GET")
+	s.router.HandleFunc("/sync/blocks/{height:[0-9]+}", s.peerOnly(s.syncBlockHandler)).Methods("GET")
+	s.router.HandleFunc("/join", s.peerJoin(s.leaderOnly(s.joinHandler))).Methods("POST")
+	s.router.HandleFunc("/keys", s.peerKey(s.leaderOnly(s.registerKeyHandler))).Methods("POST")
+	s.router.HandleFunc("/vote", s.peerOnly(s.voteHandler)).Methods("POST")
+
+	logging.Info("listening", "addr", s.connectionString())
+
+	go s.registerKey()
+	go s.activateSeals()
+	go s.Mint()
+	go s.voteLoop()
+	go s.deliverLoop()
+	if s.snapshotInterval > 0 {
+		go s.snapshotLoop()
+	}
+	if s.grpcPort != 0 {
+		if err := s.serveGRPC(); err != nil {
+			return err
+		}
 	}
 
-	s.router.HandleFunc("/get_transaction_by_hash/{hash}/{startHeight}", s.getTxByHashHandler).Methods("GET")
-	s.router.HandleFunc("/get_transaction_by_index/{height}/{txId}", s.getTxByIndexHandler).Methods("GET")
-	s.router.HandleFunc("/get_block_by_height/{height}", s.getBlockByHeightHandler).Methods("GET")
-	s.router.HandleFunc("/get_current_height", s.getCurrentHeightHandler).Methods("GET")
-	s.router.HandleFunc("/get_current_leader", s.getCurrentLeaderHandler).Methods("GET")
-	s.router.HandleFunc("/modify/{height}/{txId}", s.modifyHandler).Methods("POST")
-	s.router.HandleFunc("/new_block", s.newBlockHandler).Methods("POST")
-	s.router.HandleFunc("/new_transaction", s.newTxHandler).Methods("POST")
-	s.router.HandleFunc("/join", s.joinHandler).Methods("POST")
-
-	log.Println("Listening at:", s.connectionString())
+	if s.tls != nil {
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		<-s.finished
+		logging.Info("server stopped")
+		return nil
+	}
+	return err
+}
 
-	go s.Mint()
+// How long Shutdown lets requests in flight finish.
+const shutdownTimeout = 5 * time.Second
+
+// Shutdown stops the engine, the background loops and the APIs, e.g. once
+// the node left its cluster. Requests in flight finish first, then
+// ListenAndServe returns.
+func (s *Server) Shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+		s.engine.Stop()
+		if s.grpcServer != nil {
+			s.grpcServer.Stop()
+		}
+		go func() {
+			defer close(s.finished)
+			if s.httpServer == nil {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := s.httpServer.Shutdown(ctx); err != nil {
+				// event streams never finish on their own
+				s.httpServer.Close()
+			}
+		}()
+	})
+}
 
-	return s.httpServer.ListenAndServe()
+// sleep waits d, it returns false at once when the server shuts down.
+func (s *Server) sleep(d time.Duration) bool {
+	select {
+	case <-s.stopped:
+		return false
+	case <-time.After(d):
+		return true
+	}
 }
 
+// Mint seals blocks on the leader as the block policy demands. Under
+// proof-of-authority the sealer in turn mints instead.
 func (s *Server) Mint() {
-	for {
-		time.Sleep(time.Duration(s.epoch) * time.Millisecond)
-		if s.raftServer.State() == raft.Leader {
-			minTxCount,maxTxCount := MIN_BLOCK_TX_NUM,MAX_BLOCK_TX_NUM
-			para,_,_,err := data.GetGolbalChameleonParameter()
-			if err != nil {
-				log.Fatal(err)
-				continue
-			}
-			block := data.NewBasicBlock(para)
-			count := 0
-			filepath.Walk(path.GetTxPoolPath(), func (path string, info os.FileInfo, e error) error {
-				if count > maxTxCount {
-					return nil
-				}
-				if info.IsDir() {
-					return nil
-				}
-				t := &data.BasicTx{}
-				er := data.Load(&t, path)
-				if er != nil {
-					return er
-				}
-				er = block.AppendTx(*t)
-				if er != nil {
-					return er
-				}
-				count += 1
-				return nil
-			})
-			if count < minTxCount {
-				log.Println("Skip one block mint:no transaction in pool")
-				continue
-			}
-			top,err := data.GetCurrentBlockHeight()
-			if err != nil {
-				log.Fatal(err)
-				continue
-			}
-			prvBlock := &data.BasicBlock{}
-			err = data.Load(&prvBlock, path.GetBlockPath(top))
-			if err != nil {
-				log.Fatal(err)
-				continue
-			}
-			err = block.Finalize(int(time.Now().Unix()), top+1, prvBlock.HeadB.HashRoot)
-			if err != nil {
-				log.Fatal(err)
-				continue
-			}
-			_,err = s.raftServer.Do(NewPackCommand(*block))
-			if err != nil {
-				log.Fatal(err)
-				continue
-			}
+	var last, pending time.Time
+	for s.sleep(mintTick) {
+		now := time.Now()
+		if !s.mayMint() {
+			// a new leader starts its timers when it takes over
+			last, pending = time.Time{}, time.Time{}
+			continue
+		}
+		if last.IsZero() {
+			last = now
 		}
+		policy := s.Policy()
+		txs, full := s.pool.Select(policy.MaxTxs, policy.MaxBytes, now.Unix())
+		if len(txs) == 0 {
+			pending = time.Time{}
+		} else if pending.IsZero() {
+			pending = now
+		}
+		if !policy.due(len(txs), full, last, pending, now) {
+			continue
+		}
+		if err := s.seal(txs, now); err != nil {
+			logging.Warn("mint failed", "err", err)
+			continue
+		}
+		last = now
+		pending = time.Time{}
 	}
 }
 
-// This is a hack around Gorilla mux not providing the correct net/http
-// HandleFunc() interface.
-func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
-	s.router.HandleFunc(pattern, handler)
+func (s *Server) mayMint() bool {
+	if !s.sealing() {
+		return false
+	}
+	if s.sealers == nil {
+		return s.engine.IsLeader()
+	}
+	top, err := s.store.Height()
+	return err == nil && s.inTurn(top+1) && s.engine.IsLeader()
 }
 
-// Joins to the leader of an existing cluster.
-func (s *Server) Join(leader string) error {
-	command := &raft.DefaultJoinCommand{
-		Name:             s.raftServer.Name(),
-		ConnectionString: s.connectionString(),
+// seal proposes a block of txs, dropping txs which fail verification.
+func (s *Server) seal(txs []data.BasicTx, now time.Time) error {
+	para, _, _, err := store.ChameleonParameter(s.store)
+	if err != nil {
+		return err
 	}
-
-	var b bytes.Buffer
-	json.NewEncoder(&b).Encode(command)
-	resp, err := http.Post(fmt.Sprintf("http://%s/join", leader), "application/json", &b)
+	block := data.NewBasicBlock(para)
+	for _, t := range txs {
+		if err := block.AppendTx(t); err != nil {
+			logging.Warn("skip invalid pool transaction", "hash", fmt.Sprintf("%x", t.HashVal()), "err", err)
+		}
+	}
+	if len(txs) != 0 && block.HeadB.TxCount == 0 {
+		return errors.New("no valid transaction in pool")
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		return err
+	}
+	prvBlock, err := s.store.GetBlock(top)
+	if err != nil {
+		return err
+	}
+	err = block.Finalize(int(now.Unix()), top+1, prvBlock.HeadB.HashRoot)
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	block.Seal(s.identity.Name, s.identity.PublicKey, s.identity.Sign)
+	_, err = s.engine.Propose(NewPackCommand(*block))
+	return err
+}
 
-	return nil
+// This is a hack around Gorilla mux not providing the correct net/http
+// HandleFunc() interface. Routes installed this way carry consensus
+// traffic between nodes.
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.peerRoutes[pattern] = true
+	s.router.HandleFunc(pattern, s.peerOnly(handler))
 }
 
+// Adds a node which joins the cluster, see consensus.Goraft.
 func (s *Server) joinHandler(w http.ResponseWriter, req *http.Request) {
-	command := &raft.DefaultJoinCommand{}
+	m := consensus.Member{}
 
-	if err := json.NewDecoder(req.Body).Decode(&command); err != nil {
+	if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if _, err := s.raftServer.Do(command); err != nil {
+	if err := s.engine.AddMember(m); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-
 // Client function
-func SendNewTxReq(host string, payload,proof,hk []byte) (returnData []byte, err error) {
-	para,_,_,err := data.GetGolbalChameleonParameter()
+func SendNewTxReq(host string, para [][]byte, payload, proof, hk []byte) (returnData []byte, err error) {
+	tx, err := data.NewBasicTx(payload, proof, hk, para)
 	if err != nil {
-		return nil,err
+		return nil, err
 	}
-	tx,err := data.NewBasicTx(payload,proof,hk,para)
-	if err != nil {
-		return nil,err
-	}
-	content,err := json.Marshal(tx)
-	_data := bytes.NewReader(content)
-	resp,err := http.Post(host+"/new_transaction","application/json",_data)
-	if err != nil {
-		return nil,err
-	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil,err
-	}
-	return res,nil
+	return sendV1(http.MethodPost, host+"/v1/transactions", tx)
 }
 
-func SendNewBlockReq(host string, minTxCount,maxTxCount int) (returnData []byte, err error) {
-	para,_,_,err := data.GetGolbalChameleonParameter()
+func SendNewBlockReq(host string, st store.Store, minTxCount, maxTxCount int) (returnData []byte, err error) {
+	para, _, _, err := store.ChameleonParameter(st)
 	if err != nil {
-		return nil,err
+		return nil, err
 	}
 	block := data.NewBasicBlock(para)
 	count := 0
-	filepath.Walk(path.GetTxPoolPath(), func (path string, info os.FileInfo, e error) error {
-		if count > maxTxCount {
-			return nil
-		}
-		if info.IsDir() {
-			return nil
-		}
-		t := &data.BasicTx{}
-		er := data.Load(&t, path)
-		if er != nil {
-			return er
+	txs, err := st.PoolTxs()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range txs {
+		if count >= maxTxCount {
+			break
 		}
-		er = block.AppendTx(*t)
-		if er != nil {
-			return er
+		err = block.AppendTx(*t)
+		if err != nil {
+			return nil, err
 		}
 		count += 1
-		return nil
-	})
+	}
 	if count < minTxCount {
-		return nil,errors.New("no enough transactions in pool")
+		return nil, errors.New("no enough transactions in pool")
 	}
-	top,err := data.GetCurrentBlockHeight()
+	top, err := st.Height()
 	if err != nil {
-		return nil,err
+		return nil, err
 	}
-	prvBlock := &data.BasicBlock{}
-	err = data.Load(&prvBlock, path.GetBlockPath(top))
+	prvBlock, err := st.GetBlock(top)
 	if err != nil {
-		return nil,err
+		return nil, err
 	}
 	err = block.Finalize(int(time.Now().Unix()), top+1, prvBlock.HeadB.HashRoot)
 	if err != nil {
-		return nil,err
-	}
-	content,err := json.Marshal(block)
-	_data := bytes.NewReader(content)
-	resp,err := http.Post(host+"/new_block","application/json",_data)
-	if err != nil {
-		return nil,err
-	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil,err
+		return nil, err
 	}
-	return res,nil
+	return sendV1(http.MethodPost, host+"/v1/blocks", block)
 }
 
-func SendModifyReq(host string, payloadNew, proofNew,tk []byte, height,txId int) (returnData []byte, err error) {
-	para,_,_,err := data.GetGolbalChameleonParameter()
-	if err != nil {
-		return nil,err
-	}
-	tx,err := GetTxByIndex(host,height,txId)
+func SendModifyReq(host string, para [][]byte, payloadNew, proofNew, tk []byte, height, txId int) (returnData []byte, err error) {
+	tx, err := GetTxByIndex(host, height, txId, ReadLeader)
 	if err != nil {
-		return nil,err
+		return nil, err
 	}
 	err = tx.Modify(payloadNew, proofNew, tk, para)
 	if err != nil {
-		return nil,err
-	}
-	content,err := json.Marshal(tx)
-	_data := bytes.NewReader(content)
-	resp,err := http.Post(fmt.Sprintf("%s/modify/%d/%d", host, height, txId),"application/json",_data)
-	if err != nil {
-		return nil,err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil,err
-	}
-	return res,nil
+	return sendV1(http.MethodPut, fmt.Sprintf("%s/v1/blocks/%d/transactions/%d", host, height, txId), tx)
 }
 
-func GetCurrentHeight(host string) (height int, err error) {
-	resp,err := http.Get(host+"/get_current_height")
-	if err != nil {
-		return 0,err
-	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0,err
+func GetCurrentHeight(host, consistency string) (height int, err error) {
+	h := HeightResponse{}
+	if err = getV1(consistency, host+"/v1/height", &h); err != nil {
+		return 0, err
 	}
-	height,err = strconv.Atoi(string((res)))
-	if err != nil {
-		return 0,err
-	}
-	return height,nil
+	return h.Height, nil
 }
 
-func GetBlockByHeight(host string, height int) (block *data.BasicBlock, err error) {
-	resp,err := http.Get(host+"/get_block_by_height/"+strconv.Itoa(height))
-	if err != nil {
-		return nil,err
-	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil,err
-	}
+func GetBlockByHeight(host string, height int, consistency string) (block *data.BasicBlock, err error) {
 	block = &data.BasicBlock{}
-	err = json.Unmarshal(res, &block)
-	if err != nil {
-		return nil,err
+	if err = getV1(consistency, host+"/v1/blocks/"+strconv.Itoa(height), block); err != nil {
+		return nil, err
 	}
-	return block,nil
+	return block, nil
 }
 
-func GetTxByIndex(host string, height,txId int) (tx *data.BasicTx, err error) {
-	resp,err := http.Get(fmt.Sprintf("%s/get_transaction_by_index/%d/%d",host,height,txId))
-	if err != nil {
-		return nil,err
-	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil,err
-	}
+func GetTxByIndex(host string, height, txId int, consistency string) (tx *data.BasicTx, err error) {
 	tx = &data.BasicTx{}
-	err = json.Unmarshal(res, &tx)
-	if err != nil {
-		return nil,err
+	if err = getV1(consistency, fmt.Sprintf("%s/v1/blocks/%d/transactions/%d", host, height, txId), tx); err != nil {
+		return nil, err
 	}
-	return tx,nil
+	return tx, nil
 }
 
-func GetTxByHash(host,hash string, startHeight int) (height,txId int, tx *data.BasicTx, err error) {
-	resp,err := http.Get(fmt.Sprintf("%s/get_transaction_by_hash/%s/%d",host,hash,startHeight))
-	if err != nil {
-		return 0,0,nil,err
-	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0,0,nil,err
-	}
-	index := strings.Split(string(res),"-")
-	height,err = strconv.Atoi(index[0])
-	if err != nil {
-		return height,txId,nil,err
-	}
-	txId,err = strconv.Atoi(index[1])
+func GetTxByHash(host, hash string, startHeight int, consistency string) (height, txId int, tx *data.BasicTx, err error) {
+	loc := LocatedTx{}
+	err = getV1(consistency, fmt.Sprintf("%s/v1/transactions/%s?start_height=%d", host, hash, startHeight), &loc)
 	if err != nil {
-		return height,txId,nil,err
+		return 0, 0, nil, err
 	}
-	tx,err = GetTxByIndex(host, height, txId)
-	if err != nil {
-		return height,txId,nil,err
-	}
-	return height,txId,tx,nil
+	return loc.Height, loc.TxId, &loc.Transaction, nil
 }
 
-func GetCurrentLeader(host string) (leader string, err error) {
-	resp,err := http.Get(host+"/get_current_leader")
-	if err != nil {
-		return "",err
+func GetCurrentLeader(host, consistency string) (leader string, err error) {
+	l := LeaderResponse{}
+	if err = getV1(consistency, host+"/v1/leader", &l); err != nil {
+		return "", err
 	}
-	defer resp.Body.Close()
-	res,err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "",err
-	}
-	return string(res),nil
+	return l.ConnectionString, nil
 }
 
-
 // Server handler
 func (s *Server) newTxHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
-	content,err := ioutil.ReadAll(req.Body)
+	content, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		return
 	}
@@ -453,27 +541,34 @@ func (s *Server) newTxHandler(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		return
 	}
-	para,_,_,err := data.GetGolbalChameleonParameter()
+	priority, err := queryInt(req, "priority", 0)
 	if err != nil {
 		return
 	}
-	_,err = s.raftServer.Do(NewAddTxCommand(*tx, para))
+	para, _, _, err := store.ChameleonParameter(s.store)
 	if err != nil {
 		return
 	}
-	h,_ := data.GetCurrentBlockHeight()
-	w.Write([]byte("Success:Trancasion "+fmt.Sprintf("%x",tx.HashVal())+" is waitting for packing.Temporary block height: "+strconv.Itoa(h)))
+	_, err = s.engine.Propose(NewAddTxCommand(*tx, para, time.Now().Unix(), priority))
+	if txApplied(req, err) {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	h, _ := s.store.Height()
+	w.Write([]byte("Success:Trancasion " + fmt.Sprintf("%x", tx.HashVal()) + " is waitting for packing.Temporary block height: " + strconv.Itoa(h)))
 }
 
 func (s *Server) newBlockHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
-	content,err := ioutil.ReadAll(req.Body)
+	content, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		return
 	}
@@ -482,31 +577,35 @@ func (s *Server) newBlockHandler(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		return
 	}
-	_,err = s.raftServer.Do(NewPackCommand(*block))
-	if err != nil {
-		return
+	if !s.blockApplied(req, block) {
+		// the leader vouches for the block it proposes
+		block.Seal(s.identity.Name, s.identity.PublicKey, s.identity.Sign)
+		_, err = s.engine.Propose(NewPackCommand(*block))
+		if err != nil {
+			return
+		}
 	}
-	w.Write([]byte("Success:Block height: "+strconv.Itoa(block.HeadB.Height)))
+	w.Write([]byte("Success:Block height: " + strconv.Itoa(block.HeadB.Height)))
 }
 
 func (s *Server) modifyHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
 	vars := mux.Vars(req)
-	height,err := strconv.Atoi(vars["height"])
+	height, err := strconv.Atoi(vars["height"])
 	if err != nil {
 		return
 	}
-	txId,err := strconv.Atoi(vars["txId"])
+	txId, err := strconv.Atoi(vars["txId"])
 	if err != nil {
 		return
 	}
-	content,err := ioutil.ReadAll(req.Body)
+	content, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		return
 	}
@@ -515,26 +614,22 @@ func (s *Server) modifyHandler(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		return
 	}
-	para,_,_,err := data.GetGolbalChameleonParameter()
-	if err != nil {
-		return
-	}
-	_,err = s.raftServer.Do(NewModifyCommand(height, txId, *tx, para))
+	_, err = s.modifyTx(height, txId, tx)
 	if err != nil {
 		return
 	}
-	w.Write([]byte("Success:Trancasion "+fmt.Sprintf("%x",tx.HashValB)+" has been modified"))
+	w.Write([]byte("Success:Trancasion " + fmt.Sprintf("%x", tx.HashValB) + " has been modified"))
 }
 
 func (s *Server) getCurrentHeightHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
-	height,err := data.GetCurrentBlockHeight()
+	height, err := s.store.Height()
 	if err != nil {
 		return
 	}
@@ -543,23 +638,22 @@ func (s *Server) getCurrentHeightHandler(w http.ResponseWriter, req *http.Reques
 
 func (s *Server) getBlockByHeightHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
 	vars := mux.Vars(req)
-	height,err := strconv.Atoi(vars["height"])
+	height, err := strconv.Atoi(vars["height"])
 	if err != nil {
 		return
 	}
-	var block = &data.BasicBlock{}
-	err = data.Load(&block, path.GetBlockPath(height))
+	block, err := s.store.GetBlock(height)
 	if err != nil {
 		return
 	}
-	resp,err := json.Marshal(block)
+	resp, err := json.Marshal(block)
 	if err != nil {
 		return
 	}
@@ -568,23 +662,22 @@ func (s *Server) getBlockByHeightHandler(w http.ResponseWriter, req *http.Reques
 
 func (s *Server) getTxByIndexHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
 	vars := mux.Vars(req)
-	height,err := strconv.Atoi(vars["height"])
+	height, err := strconv.Atoi(vars["height"])
 	if err != nil {
 		return
 	}
-	txId,err := strconv.Atoi(vars["txId"])
+	txId, err := strconv.Atoi(vars["txId"])
 	if err != nil {
 		return
 	}
-	var block = &data.BasicBlock{}
-	err = data.Load(&block, path.GetBlockPath(height))
+	block, err := s.store.GetBlock(height)
 	if err != nil {
 		return
 	}
@@ -593,7 +686,7 @@ func (s *Server) getTxByIndexHandler(w http.ResponseWriter, req *http.Request) {
 		err = errors.New("transaction index overflow")
 		return
 	}
-	resp,err := json.Marshal(tx)
+	resp, err := json.Marshal(tx)
 	if err != nil {
 		return
 	}
@@ -602,55 +695,39 @@ func (s *Server) getTxByIndexHandler(w http.ResponseWriter, req *http.Request) {
 
 func (s *Server) getTxByHashHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
-	defer func(){
+	defer func() {
 		if err != nil {
-			log.Println(err)
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}()
 	vars := mux.Vars(req)
 	hash := vars["hash"]
-	startHeight,err := strconv.Atoi(vars["startHeight"])
+	startHeight, err := strconv.Atoi(vars["startHeight"])
 	if err != nil {
 		return
 	}
-	currentHeight,err := data.GetCurrentBlockHeight()
-	if err != nil {
+	loc, err := index.LookupTx(s.store, strings.ToLower(hash))
+	if err == store.ErrNotFound || (err == nil && (loc.InPool || loc.Height < startHeight)) {
+		err = nil
+		logging.Debug("transaction not found", "hash", hash)
+		http.Error(w, errors.New("transaction not found").Error(), http.StatusNotFound)
 		return
 	}
-	for i:=startHeight;i<=currentHeight;i++ {
-		var block = &data.BasicBlock{}
-		err = data.Load(block, path.GetBlockPath(i))
-		if err != nil {
-			return
-		}
-		flag,index := block.GetTxIndexByHash(hash)
-		if flag {
-			resp := strings.Join([]string{strconv.Itoa(i) ,strconv.Itoa(index)},"-")
-			if err != nil {
-				return
-			}
-			w.Write([]byte(resp))
-			return
-		}
+	if err != nil {
+		return
 	}
-	log.Printf("not found %s",hash)
-	http.Error(w, errors.New("transaction not found").Error(), http.StatusNotFound)
+	resp := strings.Join([]string{strconv.Itoa(loc.Height), strconv.Itoa(loc.TxId)}, "-")
+	w.Write([]byte(resp))
 }
 
 func (s *Server) getCurrentLeaderHandler(w http.ResponseWriter, req *http.Request) {
-	var err error
-	defer func(){
-		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-	}()
-	if s.raftServer.State() == raft.Leader {
-		w.Write([]byte(s.connectionString()))
-	} else {
-		log.Printf("leader now:%s\n",s.raftServer.Peers()[s.raftServer.Leader()].ConnectionString)
-		w.Write([]byte(s.raftServer.Peers()[s.raftServer.Leader()].ConnectionString))
+	leader := s.leaderURL()
+	if leader == "" {
+		// no leader elected yet, or it is not among the known peers
+		writeNotLeader(w, req, http.StatusServiceUnavailable, "no leader available", "")
+		return
 	}
+	logging.Debug("current leader", "leader", leader)
+	w.Write([]byte(leader))
 }
-
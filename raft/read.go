@@ -0,0 +1,138 @@
+package raft
+
+import (
+	"errors"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/logging"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Read consistency modes, chosen per request with the consistency query
+// parameter.
+const (
+	// Serve from the local store, which may lag behind the cluster.
+	ReadLocal = "local"
+	// Serve from the node which believes it is leader. Cheap, but a deposed
+	// leader may still answer until it notices.
+	ReadLeader = "leader"
+	// Serve only after a read barrier: the leader commits a no-op through a
+	// quorum and the serving node has applied the log up to that entry. The
+	// answer reflects every write acknowledged before the read started, so
+	// once a modify request returned no such read returns the old payload.
+	// Engines without an agreed order, like poa, reject it.
+	ReadLinearizable = "linearizable"
+)
+
+// How long a follower waits to catch up with the leader's applied index.
+const readBarrierTimeout = 5 * time.Second
+
+var errNoLinearizable = badRequest("linearizable reads are not supported by this consensus engine")
+
+func ValidReadConsistency(mode string) error {
+	if mode != ReadLocal && mode != ReadLeader && mode != ReadLinearizable {
+		return errors.New("unknown read consistency: " + mode)
+	}
+	return nil
+}
+
+func (s *Server) SetReadConsistency(mode string) {
+	s.readMode = mode
+}
+
+// readBarrier returns once the local state machine includes every entry
+// committed before it was called.
+func (s *Server) readBarrier() error {
+	if s.engine.IsLeader() {
+		return s.engine.Barrier()
+	}
+	leader := s.leaderURL()
+	if leader == "" {
+		return errors.New("no leader available")
+	}
+	var index uint64
+	if err := getJSON(leader+"/read_index", &index); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(readBarrierTimeout)
+	for s.engine.Status().AppliedIndex < index {
+		if time.Now().After(deadline) {
+			return errors.New("timed out catching up to applied index " + strconv.FormatUint(index, 10))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// consistent wraps a read handler with the requested consistency mode.
+func (s *Server) consistent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		mode := req.URL.Query().Get("consistency")
+		if mode == "" {
+			mode = s.readMode
+		}
+		if err := ValidReadConsistency(mode); err != nil {
+			writeError(w, req, badRequest("%v", err))
+			return
+		}
+		if mode == ReadLeader && !s.engine.IsLeader() {
+			leader := s.leaderURL()
+			if leader == "" || req.Header.Get(forwardedHeader) != "" {
+				writeNotLeader(w, req, http.StatusServiceUnavailable, "no leader available", leader)
+				return
+			}
+			if err := s.proxy(w, req, nil, leader); err != nil {
+				logging.Warn("forward to leader failed", "path", req.URL.Path, "leader", leader, "err", err)
+				writeNotLeader(w, req, http.StatusServiceUnavailable, err.Error(), leader)
+			}
+			return
+		}
+		if mode == ReadLinearizable {
+			err := s.readBarrier()
+			if errors.Is(err, consensus.ErrUnsupported) {
+				writeError(w, req, errNoLinearizable)
+				return
+			}
+			if err != nil {
+				logging.Warn("read barrier failed", "path", req.URL.Path, "err", err)
+				writeNotLeader(w, req, http.StatusServiceUnavailable, err.Error(), s.leaderURL())
+				return
+			}
+		}
+		h(w, req)
+	}
+}
+
+// Client function
+// readURL adds a read consistency to a query URL, "" leaves the server
+// default.
+func readURL(u, consistency string) string {
+	if consistency == "" {
+		return u
+	}
+	sep := "?"
+	if parsed, err := url.Parse(u); err == nil && parsed.RawQuery != "" {
+		sep = "&"
+	}
+	return u + sep + "consistency=" + url.QueryEscape(consistency)
+}
+
+// Server handler
+// readIndexHandler is the leader side of a follower's read barrier: it
+// confirms leadership through a quorum and returns the index the follower
+// has to apply, the one of the barrier entry.
+func (s *Server) readIndexHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.engine.IsLeader() {
+		writeNotLeader(w, req, http.StatusServiceUnavailable, "not leader", s.leaderURL())
+		return
+	}
+	if err := s.engine.Barrier(); err != nil {
+		logging.Warn("request failed", "path", req.URL.Path, "err", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(strconv.FormatUint(s.engine.Status().AppliedIndex, 10)))
+}
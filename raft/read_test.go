@@ -0,0 +1,42 @@
+package raft
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RedactableBlockChain/consensus"
+)
+
+// An engine which, like poa, cannot order reads.
+type unorderedEngine struct {
+	consensus.Engine
+}
+
+func (e unorderedEngine) Barrier() error {
+	return consensus.ErrUnsupported
+}
+
+func TestLinearizableUnsupported(t *testing.T) {
+	s, _ := newTestServer(t)
+	h := s.consistent(s.api(s.apiHeight))
+	for mode, want := range map[string]int{ReadLocal: http.StatusOK, ReadLinearizable: http.StatusOK} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, readURL("/v1/height", mode), nil))
+		if w.Code != want {
+			t.Fatalf("%s read on local engine: %d %s", mode, w.Code, w.Body)
+		}
+	}
+
+	s.SetEngine(unorderedEngine{s.engine})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, readURL("/v1/height", ReadLinearizable), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("linearizable read without barrier: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, readURL("/v1/height", ""), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("default read without barrier: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,135 @@
+package raft
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+)
+
+// Meta key of the height from which packed blocks must be sealed, see
+// ActivateSealsCommand.
+const sealHeightKey = "seal_height"
+
+// Sealers decides which authority seals each height, see consensus/poa.
+type Sealers interface {
+	Sealer(height int) (name string, key ed25519.PublicKey)
+}
+
+// Switches block production to proof-of-authority: the node only mints
+// when it is in turn, and every packed block must be sealed by the sealer
+// in turn. Must be called before ListenAndServe.
+func (s *Server) SetSealers(sealers Sealers) {
+	s.sealers = sealers
+}
+
+// Height returns the height of the local chain, which tells a
+// proof-of-authority engine the signer in turn.
+func (s *Server) Height() (int, error) {
+	return s.store.Height()
+}
+
+// inTurn reports whether this node seals height.
+func (s *Server) inTurn(height int) bool {
+	name, _ := s.sealers.Sealer(height)
+	return name == s.identity.Name
+}
+
+// loadSealHeight returns the height from which blocks are sealed, 0 while
+// seals are not checked yet.
+func loadSealHeight(st store.Store) (int, error) {
+	height := 0
+	err := st.GetMeta(sealHeightKey, &height)
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	return height, err
+}
+
+// checkSeal rejects blocks which are not sealed by a member with its
+// registered key, or under proof-of-authority by the sealer in turn.
+// Blocks below the seal height were packed before seals were checked, a
+// log replayed from before it must apply them as it did then.
+func (s *Server) checkSeal(block *data.BasicBlock) error {
+	from, err := loadSealHeight(s.store)
+	if err != nil {
+		return err
+	}
+	if from == 0 || block.HeadB.Height < from {
+		return nil
+	}
+	keys, err := loadKeys(s.store)
+	if err != nil {
+		return err
+	}
+	if err = keys.Verify(block); err != nil {
+		return err
+	}
+	if s.sealers == nil {
+		return nil
+	}
+	name, key := s.sealers.Sealer(block.HeadB.Height)
+	if block.HeadB.Sealer != name || !key.Equal(ed25519.PublicKey(block.HeadB.SealerKey)) {
+		return fmt.Errorf("block %d sealed out of turn by %q, expected %s", block.HeadB.Height, block.HeadB.Sealer, name)
+	}
+	return nil
+}
+
+// sealing reports whether the key of this node and the seal height are
+// committed, so that the blocks it seals pass checkSeal everywhere.
+func (s *Server) sealing() bool {
+	keys, err := loadKeys(s.store)
+	if err != nil || !keys[s.identity.Name].Equal(s.identity.PublicKey) {
+		return false
+	}
+	from, err := loadSealHeight(s.store)
+	return err == nil && from > 0
+}
+
+// activateSeals makes the leader propose the seal height once, retrying
+// until it is committed.
+func (s *Server) activateSeals() {
+	for {
+		from, err := loadSealHeight(s.store)
+		if err == nil && from > 0 {
+			return
+		}
+		if err == nil && s.engine.IsLeader() {
+			_, err = s.engine.Propose(&ActivateSealsCommand{})
+		}
+		if err != nil {
+			logging.Debug("seal activation pending", "err", err)
+		}
+		if !s.sleep(registerRetry) {
+			return
+		}
+	}
+}
+
+// This command starts checking the seals of packed blocks from the next
+// height on. Being in the log, it activates at the same point on every
+// node, also when an older log is replayed.
+type ActivateSealsCommand struct{}
+
+// The name of the command in the log.
+func (c *ActivateSealsCommand) CommandName() string {
+	return "Activate Seals"
+}
+
+func (c *ActivateSealsCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	from, err := loadSealHeight(st)
+	if err != nil || from > 0 {
+		return nil, err
+	}
+	top, err := st.Height()
+	if err != nil {
+		return nil, err
+	}
+	if err = st.PutMeta(sealHeightKey, top+1); err != nil {
+		return nil, err
+	}
+	logging.Info("block seals checked", "from_height", top+1)
+	return nil, nil
+}
@@ -0,0 +1,73 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/identity"
+)
+
+// Blocks packed before the seal height are applied unchecked, as a log
+// from before seals were checked must replay; later ones must be sealed by
+// a registered key.
+func TestSealActivation(t *testing.T) {
+	s, para := newTestServer(t)
+	if s.sealing() {
+		t.Fatal("minting before seals are activated")
+	}
+	owner := s.identity
+	stranger, err := identity.Generate("stranger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetIdentity(stranger)
+	addAndPack(t, s, para, "old")
+
+	s.SetIdentity(owner)
+	if _, err = s.engine.Propose(&ActivateSealsCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.engine.Propose(&ActivateSealsCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	if from, _ := loadSealHeight(s.store); from != 2 {
+		t.Fatalf("seal height %d", from)
+	}
+	if !s.sealing() {
+		t.Fatal("not minting with a registered key and active seals")
+	}
+	addAndPack(t, s, para, "sealed")
+
+	s.SetIdentity(stranger)
+	if err = s.seal(nil, time.Unix(1800000000, 0)); err == nil {
+		t.Fatal("block sealed by an unregistered key packed")
+	}
+	if s.sealing() {
+		t.Fatal("minting with an unregistered key")
+	}
+}
+
+// Only members register keys.
+func TestRegisterKeyMembersOnly(t *testing.T) {
+	s, _ := newTestServer(t)
+	stranger, err := identity.Generate("stranger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(NewRegisterKeyCommand(stranger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.registerKeyHandler(w, httptest.NewRequest("POST", "/keys", bytes.NewReader(body)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if keys, _ := loadKeys(s.store); keys["stranger"] != nil {
+		t.Fatal("key of a non-member registered")
+	}
+}
@@ -0,0 +1,75 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
+)
+
+// newTestServer returns a server on the chain of test/node1 with an
+// in-memory store and the local engine, running but not serving HTTP.
+// Its node key is registered, so it can seal blocks.
+func newTestServer(t *testing.T) (*Server, *data.GolbalParameter) {
+	t.Helper()
+	para, err := store.LoadParameter("../test/node1/storage/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	para.CurHeight = 0
+	st := store.NewMemStore()
+	if err = st.PutParameter(para); err != nil {
+		t.Fatal(err)
+	}
+	genesis := data.NewBasicBlock([][]byte{para.P, para.Q, para.G})
+	if err = genesis.Finalize(0, 0, []byte("")); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.PutBlock(genesis); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := mempool.New(st, mempool.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(t.TempDir(), "localhost", 0, BlockPolicy{MaxTxs: 10, Interval: 1000}, st, pool)
+	s.SetEngine(consensus.NewLocal(s.Name(), s.ConnectionString(), s))
+	if err = s.engine.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.engine.Stop)
+	if _, err = s.engine.Propose(NewRegisterKeyCommand(s.identity)); err != nil {
+		t.Fatal(err)
+	}
+	return s, para
+}
+
+func chainParameter(para *data.GolbalParameter) [][]byte {
+	return [][]byte{para.P, para.Q, para.G}
+}
+
+// addAndPack pools txs with payloads and seals them into the next block.
+func addAndPack(t *testing.T, s *Server, para *data.GolbalParameter, payloads ...string) {
+	t.Helper()
+	var txs []data.BasicTx
+	for _, p := range payloads {
+		tx, err := data.NewBasicTx([]byte(p), []byte("p"), para.Hk, chainParameter(para))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.addTx(tx, 0); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, *tx)
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.seal(txs, time.Unix(int64(1700000000+top), 0)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,486 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/store"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How often the snapshot loop checks the commit index.
+const snapshotCheck = 10 * time.Second
+
+// Index of the heights with a redacted transaction, see markRedacted.
+const redactedIndex = "redacted_blocks"
+
+// How long a node waits for a peer to send a block it syncs.
+const syncTimeout = 10 * time.Second
+
+// The replicated state as goraft stores it in a snapshot and sends it to
+// followers which fell behind the compacted log. Blocks are not part of it:
+// the snapshot names the head of the chain, and a follower fetches the
+// blocks it lacks from its peers, each with its finality certificate.
+// Indexes are rebuilt from the chain, after the chain was verified. The
+// webhook outbox and dead letters are part of it, as they are not derived
+// from it.
+type Snapshot struct {
+	Parameter   data.GolbalParameter `json:"parameter"`
+	Height      int                  `json:"height"`
+	HashRoot    []byte               `json:"hash_root"`
+	Redacted    []int                `json:"redacted,omitempty"`
+	Pool        []PoolEntry          `json:"pool"`
+	PoolSeq     uint64               `json:"pool_seq"`
+	Policy      BlockPolicy          `json:"policy"`
+	PoolConfig  mempool.Config       `json:"pool_config"`
+	Keys        NodeKeys             `json:"keys,omitempty"`
+	SealHeight  int                  `json:"seal_height,omitempty"`
+	Principals  Principals           `json:"principals,omitempty"`
+	Webhooks    Webhooks             `json:"webhooks,omitempty"`
+	Outbox      []Delivery           `json:"outbox,omitempty"`
+	DeadLetters []Delivery           `json:"dead_letters,omitempty"`
+}
+
+type PoolEntry struct {
+	mempool.Entry
+	Transaction data.BasicTx `json:"transaction"`
+}
+
+// Takes a snapshot whenever interval entries were committed since the last
+// one, 0 disables snapshots.
+func (s *Server) SetSnapshotInterval(interval uint64) {
+	s.snapshotInterval = interval
+}
+
+func (s *Server) snapshotLoop() {
+	var last uint64
+	for s.sleep(snapshotCheck) {
+		commit := s.engine.Status().CommitIndex
+		if commit < last+s.snapshotInterval {
+			continue
+		}
+		if err := s.engine.Snapshot(); err != nil {
+			logging.Warn("snapshot failed", "err", err)
+			continue
+		}
+		logging.Info("snapshot taken", "commit_index", commit)
+		last = commit
+	}
+}
+
+// Save is the consensus.StateMachine side of a snapshot.
+func (s *Server) Save() ([]byte, error) {
+	para, err := s.store.Parameter()
+	if err != nil {
+		return nil, err
+	}
+	top, err := s.store.Height()
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.store.GetBlock(top)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := loadKeys(s.store)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{Parameter: PublicParameter(para), Height: top, HashRoot: head.HeadB.HashRoot, Policy: s.Policy(), PoolConfig: s.pool.Config(), Keys: keys, Principals: s.Principals()}
+	if snap.Redacted, err = redactedHeights(s.store); err != nil {
+		return nil, err
+	}
+	if snap.SealHeight, err = loadSealHeight(s.store); err != nil {
+		return nil, err
+	}
+	if snap.Webhooks, err = loadWebhooks(s.store); err != nil {
+		return nil, err
+	}
+	if snap.Outbox, err = scanDeliveries(s.store, outboxIndex, "", 0); err != nil {
+		return nil, err
+	}
+	if snap.DeadLetters, err = scanDeliveries(s.store, deadLetterIndex, "", 0); err != nil {
+		return nil, err
+	}
+	entries, seq := s.pool.Snapshot()
+	for _, e := range entries {
+		snap.Pool = append(snap.Pool, PoolEntry{Entry: e, Transaction: e.Tx})
+	}
+	snap.PoolSeq = seq
+	return json.Marshal(snap)
+}
+
+// markRedacted records that a block at height had a transaction replaced.
+// Its hash root stays the same, so a follower would otherwise keep its
+// copy from before the redaction.
+func markRedacted(st store.Store, height int) error {
+	return st.IndexPut(redactedIndex, fmt.Sprintf("%012d", height), nil)
+}
+
+func redactedHeights(st store.Store) ([]int, error) {
+	entries, err := st.IndexScan(redactedIndex, "", "", 0)
+	if err != nil {
+		return nil, err
+	}
+	heights := make([]int, 0, len(entries))
+	for _, e := range entries {
+		h, err := strconv.Atoi(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		heights = append(heights, h)
+	}
+	return heights, nil
+}
+
+// VerifyLink checks that block follows prev on the chain of genesis, with
+// valid txs and hash root, sealed by a member with its key in keys. Nil
+// keys skip the seal, for blocks packed before seals were checked.
+func VerifyLink(genesis, prev, block *data.BasicBlock, keys NodeKeys) error {
+	head := block.HeadB
+	h := prev.HeadB.Height + 1
+	if head.Height != h {
+		return fmt.Errorf("block %d: unexpected height %d", h, head.Height)
+	}
+	if !bytes.Equal(head.PreviousRoot, prev.HeadB.HashRoot) {
+		return fmt.Errorf("block %d: unmatched previous block hash root", h)
+	}
+	if !bytes.Equal(bytes.Join(head.ChameleonParameter, nil), bytes.Join(genesis.HeadB.ChameleonParameter, nil)) {
+		return fmt.Errorf("block %d: chameleon parameter differs from genesis", h)
+	}
+	if !block.Verify() {
+		return fmt.Errorf("block %d: invalid block", h)
+	}
+	if keys == nil {
+		return nil
+	}
+	return keys.Verify(block)
+}
+
+// Keys this node trusts to seal blocks it did not apply itself: the keys
+// set with SetTrustedKeys, the keys it replicated and its own. The key map
+// of a snapshot comes from the sender and does not count.
+func (s *Server) trustedKeys() (NodeKeys, error) {
+	keys, err := loadKeys(s.store)
+	if err != nil {
+		return nil, err
+	}
+	for name, key := range s.trusted {
+		if known, ok := keys[name]; ok && !known.Equal(key) {
+			return nil, fmt.Errorf("replicated key of %s differs from the trusted one", name)
+		}
+		keys[name] = key
+	}
+	keys[s.identity.Name] = s.identity.PublicKey
+	return keys, nil
+}
+
+// Sets the keys a node trusts to seal the blocks it syncs after it fell
+// behind a snapshot, usually the key map of the cluster as served by
+// /v1/keys. Must be called before ListenAndServe.
+func (s *Server) SetTrustedKeys(keys NodeKeys) {
+	s.trusted = keys
+}
+
+// Peers to sync blocks from, the leader first.
+func (s *Server) syncPeers() []string {
+	var peers []string
+	if leader := s.leaderURL(); leader != "" {
+		peers = append(peers, leader)
+	}
+	for _, m := range s.engine.Members() {
+		if m.Name != s.engine.Name() && m.ConnectionString != "" && m.ConnectionString != s.leaderURL() {
+			peers = append(peers, m.ConnectionString)
+		}
+	}
+	return peers
+}
+
+// fetchBlock gets the block at height with its certificate from the first
+// peer which has it.
+func (s *Server) fetchBlock(height int) (*CertifiedBlock, error) {
+	err := errors.New("no peer to sync from")
+	for _, peer := range s.syncPeers() {
+		var cb *CertifiedBlock
+		if cb, err = GetSyncBlock(peer, height); err == nil {
+			return cb, nil
+		}
+		logging.Debug("block sync failed", "peer", peer, "height", height, "err", err)
+	}
+	return nil, fmt.Errorf("sync block %d: %v", height, err)
+}
+
+// What a node syncs the chain of a snapshot against.
+type chainSync struct {
+	para     *data.GolbalParameter
+	genesis  *data.BasicBlock
+	redacted map[int]bool
+	// Keys trusted to seal blocks, and the key map of the snapshot
+	// restricted to them, which certificates are checked against.
+	keys     NodeKeys
+	certKeys NodeKeys
+	// Blocks from this height on are sealed, 0 if none is.
+	sealHeight int
+}
+
+// syncBlock makes the block at height the one of the cluster, fetching it
+// unless the store already holds it unchanged and certified. It returns
+// the block the chain continues from.
+func (s *Server) syncBlock(c *chainSync, prev *data.BasicBlock, height int) (*data.BasicBlock, error) {
+	local, err := s.store.GetBlock(height)
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	if err == nil && height == 0 && VerifyGenesis(&Genesis{Parameter: *c.para, Block: *local}) == nil {
+		return local, nil
+	}
+	if err == nil && height > 0 && !c.redacted[height] && bytes.Equal(local.HeadB.PreviousRoot, prev.HeadB.HashRoot) {
+		// Blocks the node applied itself were checked then.
+		_, err = s.Certificate(height)
+		if err == nil {
+			return local, nil
+		}
+		if err != store.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	cb, err := s.fetchBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	block := &cb.Block
+	if height == 0 {
+		err = VerifyGenesis(&Genesis{Parameter: *c.para, Block: *block})
+	} else {
+		keys := c.keys
+		if c.sealHeight == 0 || height < c.sealHeight {
+			keys = nil
+		}
+		err = VerifyLink(c.genesis, prev, block, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = s.store.PutBlock(block); err != nil {
+		return nil, err
+	}
+	if cb.Certificate == nil {
+		return block, nil
+	}
+	if err = cb.Certificate.Verify(block, c.certKeys); err != nil {
+		logging.Warn("dropping certificate of synced block", "height", height, "err", err)
+		return block, nil
+	}
+	return block, s.store.PutMeta(certificateKey(height), cb.Certificate)
+}
+
+// Recovery is the consensus.StateMachine side of a snapshot. It runs when
+// the node starts from its own snapshot, before the engine runs, and when
+// the leader sends one. Blocks up to the head of the snapshot which the
+// node lacks are fetched one by one from its peers and verified against
+// the keys it trusts before they are written, so a node never serves
+// blocks it did not check.
+func (s *Server) Recovery(b []byte) error {
+	snap := &Snapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		return err
+	}
+	para := PublicParameter(&snap.Parameter)
+	local, err := s.store.Parameter()
+	if err == nil && !sameParameter(local, &para) {
+		err = fmt.Errorf("snapshot chain parameter differs from local")
+	}
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+	keys, err := s.trustedKeys()
+	if err != nil {
+		return err
+	}
+	c := &chainSync{para: &para, redacted: make(map[int]bool), keys: keys, certKeys: NodeKeys{}, sealHeight: snap.SealHeight}
+	// Certificates count the votes of the current members, all keys while
+	// the engine knows none.
+	members := make(map[string]bool)
+	for _, m := range s.engine.Members() {
+		members[m.Name] = true
+	}
+	for name, key := range snap.Keys {
+		known, ok := keys[name]
+		if ok && !known.Equal(key) {
+			return fmt.Errorf("snapshot key of %s differs from the trusted one", name)
+		}
+		if ok && (len(members) == 0 || members[name]) {
+			c.certKeys[name] = key
+		}
+	}
+	chain := [][]byte{para.P, para.Q, para.G}
+	for _, e := range snap.Pool {
+		if !e.Transaction.Verify(chain) {
+			return fmt.Errorf("snapshot pool transaction %x invalid", e.Transaction.HashVal())
+		}
+	}
+
+	top, err := s.store.Height()
+	if err != nil {
+		return err
+	}
+	if s.engine.Status().State == consensus.Stopped && top >= snap.Height {
+		// Starting from the own snapshot: the store is persistent and already
+		// holds at least this state, an older snapshot must not roll back
+		// redactions applied after it.
+		logging.Info("store is ahead of snapshot, keeping it", "height", top, "snapshot_height", snap.Height)
+		return nil
+	}
+
+	logging.Info("installing snapshot", "height", snap.Height, "pool", len(snap.Pool))
+	if local == nil {
+		if err = s.store.PutParameter(&para); err != nil {
+			return err
+		}
+	}
+	for _, h := range snap.Redacted {
+		c.redacted[h] = true
+	}
+	if c.genesis, err = s.syncBlock(c, nil, 0); err != nil {
+		return err
+	}
+	prev := c.genesis
+	for h := 1; h <= snap.Height; h++ {
+		if prev, err = s.syncBlock(c, prev, h); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(prev.HeadB.HashRoot, snap.HashRoot) {
+		return fmt.Errorf("synced chain ends at hash root %x, the snapshot at %x", prev.HeadB.HashRoot, snap.HashRoot)
+	}
+	if err = s.store.SetHeight(snap.Height); err != nil {
+		return err
+	}
+	if err = s.store.DropIndex(redactedIndex); err != nil {
+		return err
+	}
+	for _, h := range snap.Redacted {
+		if err = markRedacted(s.store, h); err != nil {
+			return err
+		}
+	}
+	entries := make([]mempool.Entry, 0, len(snap.Pool))
+	for _, e := range snap.Pool {
+		e.Entry.Tx = e.Transaction
+		entries = append(entries, e.Entry)
+	}
+	if err = s.pool.Restore(entries, snap.PoolSeq); err != nil {
+		return err
+	}
+	if snap.Keys != nil {
+		if err = s.store.PutMeta(keysKey, snap.Keys); err != nil {
+			return err
+		}
+	}
+	if snap.SealHeight > 0 {
+		if err = s.store.PutMeta(sealHeightKey, snap.SealHeight); err != nil {
+			return err
+		}
+	}
+	if snap.Principals != nil {
+		if err = s.store.PutMeta(principalsKey, snap.Principals); err != nil {
+			return err
+		}
+		s.setPrincipals(snap.Principals)
+	}
+	if snap.Webhooks != nil {
+		if err = s.store.PutMeta(webhooksKey, snap.Webhooks.withoutSecrets()); err != nil {
+			return err
+		}
+	}
+	if err = restoreDeliveries(s.store, outboxIndex, snap.Outbox); err != nil {
+		return err
+	}
+	if err = restoreDeliveries(s.store, deadLetterIndex, snap.DeadLetters); err != nil {
+		return err
+	}
+	if snap.PoolConfig.Validate() == nil {
+		if err = s.pool.SetConfig(snap.PoolConfig); err != nil {
+			return err
+		}
+	}
+	if snap.Policy.Validate() == nil {
+		if err = s.store.PutMeta(policyKey, snap.Policy); err != nil {
+			return err
+		}
+		s.setPolicy(snap.Policy)
+	}
+	return index.Rebuild(s.store)
+}
+
+func restoreDeliveries(st store.Store, idx string, list []Delivery) error {
+	if err := st.DropIndex(idx); err != nil {
+		return err
+	}
+	for i := range list {
+		if err := putDelivery(st, idx, &list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Client function
+// Gets a block with its certificate from a peer, for a node which syncs
+// the chain after a snapshot.
+func GetSyncBlock(host string, height int) (cb *CertifiedBlock, err error) {
+	cb = &CertifiedBlock{}
+	client := &http.Client{Timeout: syncTimeout}
+	resp, err := client.Get(host + "/sync/blocks/" + strconv.Itoa(height))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(res))
+	}
+	if err = json.Unmarshal(res, cb); err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// Server handler
+func (s *Server) syncBlockHandler(w http.ResponseWriter, req *http.Request) {
+	var err error
+	defer func() {
+		if err != nil {
+			logging.Warn("request failed", "path", req.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	}()
+	height, err := strconv.Atoi(mux.Vars(req)["height"])
+	if err != nil {
+		return
+	}
+	cb, err := s.certifiedBlock(height)
+	if err != nil {
+		return
+	}
+	resp, err := json.Marshal(cb)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,100 @@
+package raft
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/gorilla/mux"
+)
+
+// An engine whose leader is another node.
+type followerEngine struct {
+	consensus.Engine
+	leader string
+}
+
+func (e followerEngine) Leader() consensus.Member {
+	return consensus.Member{Name: "leader", ConnectionString: e.leader}
+}
+
+func (e followerEngine) Members() []consensus.Member {
+	return nil
+}
+
+// A follower which falls behind a snapshot syncs the blocks it lacks, with
+// their certificates, from its leader, and only if trusted keys sealed
+// them.
+func TestRecoverySyncsBlocks(t *testing.T) {
+	leader, para := newTestServer(t)
+	if _, err := leader.engine.Propose(&ActivateSealsCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{"a", "b", "c"} {
+		addAndPack(t, leader, para, payload)
+	}
+	for h := 1; h <= 3; h++ {
+		block, err := leader.store.GetBlock(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = leader.addVote(leader.newVote(leader.identity, block)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := markRedacted(leader.store, 2); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := leader.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := &Snapshot{}
+	if err = json.Unmarshal(snapshot, snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Height != 3 || snap.SealHeight != 1 || len(snap.Redacted) != 1 || snap.Redacted[0] != 2 {
+		t.Fatalf("snapshot %+v", snap)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/sync/blocks/{height:[0-9]+}", leader.syncBlockHandler)
+	peer := httptest.NewServer(router)
+	defer peer.Close()
+
+	follower, _ := newTestServer(t)
+	follower.SetEngine(followerEngine{follower.engine, peer.URL})
+	if err = follower.Recovery(snapshot); err == nil {
+		t.Fatal("blocks sealed by an untrusted key installed")
+	}
+	if top, _ := follower.store.Height(); top != 0 {
+		t.Fatalf("height %d after failed recovery", top)
+	}
+
+	forged := *snap
+	forged.HashRoot = []byte("forged")
+	raw, err := json.Marshal(&forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.SetTrustedKeys(NodeKeys{leader.identity.Name: leader.identity.PublicKey})
+	if err = follower.Recovery(raw); err == nil {
+		t.Fatal("chain with another head installed")
+	}
+
+	if err = follower.Recovery(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if top, _ := follower.store.Height(); top != 3 {
+		t.Fatalf("height %d after recovery", top)
+	}
+	for h := 1; h <= 3; h++ {
+		if _, err = follower.Certificate(h); err != nil {
+			t.Fatalf("certificate %d: %v", h, err)
+		}
+	}
+	if redacted, _ := redactedHeights(follower.store); len(redacted) != 1 || redacted[0] != 2 {
+		t.Fatalf("redacted %v", redacted)
+	}
+}
@@ -0,0 +1,111 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/pki"
+	"io/ioutil"
+	"net/http"
+)
+
+// Serves the API and the consensus traffic over TLS. The default goraft
+// engine peers with https and client, see pki.Config.Load; with peerAuth
+// consensus routes only take requests with a client certificate of the
+// cluster CA. Must be called before SetEngine and ListenAndServe.
+func (s *Server) SetTLS(server, client *tls.Config, peerAuth bool) {
+	s.tls = server
+	s.peerAuth = peerAuth
+	goraft := consensus.NewGoraft(s.name, s.path, s.connectionString(), s, s)
+	goraft.SetTLS(client)
+	s.engine = goraft
+}
+
+func (s *Server) scheme() string {
+	if s.tls != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// peerOnly restricts a route to the nodes of the cluster when peer
+// authentication is on.
+func (s *Server) peerOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if s.peerAuth && pki.PeerName(req) == "" {
+			logging.Warn("peer request without client certificate", "path", req.URL.Path, "remote", req.RemoteAddr)
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return
+		}
+		h(w, req)
+	}
+}
+
+// forwardedByMember reports whether req was forwarded by the member its
+// client certificate names.
+func (s *Server) forwardedByMember(req *http.Request) bool {
+	by := req.Header.Get(forwardedHeader)
+	return s.peerAuth && by != "" && pki.PeerName(req) == by && s.isMember(by)
+}
+
+// peerJoin checks that a joining node holds the certificate of the name
+// it joins with.
+func (s *Server) peerJoin(h http.HandlerFunc) http.HandlerFunc {
+	return s.peerNamed("join", func(body []byte) (string, error) {
+		m := consensus.Member{}
+		err := json.Unmarshal(body, &m)
+		return m.Name, err
+	}, h)
+}
+
+// peerKey checks that a node registering a key holds the certificate of
+// the name it registers the key for.
+func (s *Server) peerKey(h http.HandlerFunc) http.HandlerFunc {
+	return s.peerNamed("key registration", func(body []byte) (string, error) {
+		cmd := &RegisterKeyCommand{}
+		err := json.Unmarshal(body, cmd)
+		return cmd.Name, err
+	}, h)
+}
+
+// peerNamed checks that the client certificate of a peer request names
+// the node the body, decoded by nameOf, is about. A request forwarded by
+// another node was checked there; it is taken when the certificate names
+// the member in the forwarded header.
+func (s *Server) peerNamed(what string, nameOf func(body []byte) (string, error), h http.HandlerFunc) http.HandlerFunc {
+	return s.peerOnly(func(w http.ResponseWriter, req *http.Request) {
+		if !s.peerAuth {
+			h(w, req)
+			return
+		}
+		peer := pki.PeerName(req)
+		if by := req.Header.Get(forwardedHeader); by != "" {
+			if !s.forwardedByMember(req) {
+				logging.Warn(what+" rejected", "forwarded_by", by, "certificate", peer)
+				http.Error(w, "only members forward a "+what, http.StatusForbidden)
+				return
+			}
+			h(w, req)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name, err := nameOf(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if peer != name {
+			logging.Warn(what+" rejected", "name", name, "certificate", peer)
+			http.Error(w, "certificate is not issued to "+name, http.StatusForbidden)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h(w, req)
+	})
+}
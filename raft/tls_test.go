@@ -0,0 +1,69 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RedactableBlockChain/consensus"
+)
+
+func certified(name string) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: name}}}}}
+}
+
+// Joins and key registrations name the node of the certificate, or come
+// forwarded by a member which checked them.
+func TestPeerNamed(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.peerAuth = true
+	s.SetEngine(membersEngine{s.engine, []consensus.Member{{Name: s.Name()}, {Name: "node2"}}})
+	handled := false
+	ok := func(w http.ResponseWriter, req *http.Request) {
+		handled = true
+	}
+	for _, c := range []struct {
+		name      string
+		cert      string
+		forwarded string
+		body      string
+		status    int
+	}{
+		{"own name", "node2", "", "node2", http.StatusOK},
+		{"anonymous", "", "", "node2", http.StatusForbidden},
+		{"other name", "node2", "", "node3", http.StatusForbidden},
+		{"forwarded by a member", "node2", "node2", "node3", http.StatusOK},
+		{"forwarded by a non member", "node3", "node3", "node3", http.StatusForbidden},
+		{"forwarded in the name of a member", "node3", "node2", "node3", http.StatusForbidden},
+		{"forwarded in the name of another member", s.Name(), "node2", "node3", http.StatusForbidden},
+	} {
+		for what, h := range map[string]http.HandlerFunc{"join": s.peerJoin(ok), "key": s.peerKey(ok)} {
+			var body interface{} = consensus.Member{Name: c.body}
+			if what == "key" {
+				body = RegisterKeyCommand{Name: c.body}
+			}
+			b, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/"+what, bytes.NewReader(b))
+			if c.cert != "" {
+				req.TLS = certified(c.cert)
+			}
+			if c.forwarded != "" {
+				req.Header.Set(forwardedHeader, c.forwarded)
+			}
+			handled = false
+			w := httptest.NewRecorder()
+			h(w, req)
+			if w.Code != c.status || handled != (c.status == http.StatusOK) {
+				t.Errorf("%s %s: status %d, handled %v", what, c.name, w.Code, handled)
+			}
+		}
+	}
+}
@@ -0,0 +1,869 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/store"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Meta key of the replicated webhooks, and the indexes of their pending
+// and failed deliveries.
+const (
+	webhooksKey     = "webhooks"
+	outboxIndex     = "webhook_outbox"
+	deadLetterIndex = "webhook_dead_letters"
+)
+
+// Shortest webhook key, see LoadWebhookKey.
+const minWebhookKey = 16
+
+// The events webhooks subscribe to.
+const (
+	// The leader accepted a redaction and proposes it.
+	HookRedactionProposed = "redaction.proposed"
+	// A redaction was applied, the tx holds its new content.
+	HookTxModified = "tx.modified"
+	// A proposed redaction failed to apply, the tx is unchanged.
+	HookRedactionRejected = "redaction.rejected"
+)
+
+// In the order the events of one redaction happen.
+var hookEvents = []string{HookRedactionProposed, HookTxModified, HookRedactionRejected}
+
+// Headers of a webhook request.
+const (
+	HookEventHeader     = "X-Webhook-Event"
+	HookTimestampHeader = "X-Webhook-Timestamp"
+	HookSignatureHeader = "X-Webhook-Signature"
+	IdempotencyHeader   = "Idempotency-Key"
+)
+
+// How often the leader looks for due deliveries, and how many it reads
+// from the outbox at a time.
+const (
+	deliveryTick  = time.Second
+	deliveryBatch = 100
+)
+
+var hookName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// An HTTP endpoint which is sent the events it subscribed to. The secret
+// keys the signature of every request. It is not replicated: every node
+// derives it from the webhook key, which the operator gives all nodes,
+// and the replicated nonce, so that any leader signs alike. It is only
+// shown when it is created.
+type Webhook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Nonce  string   `json:"nonce,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+func (h *Webhook) Validate() error {
+	if !hookName.MatchString(h.Name) {
+		return errors.New("webhook name may only hold letters, digits, - and _")
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook needs an http or https url")
+	}
+	if len(h.Events) == 0 {
+		return errors.New("webhook needs an event")
+	}
+	for _, e := range h.Events {
+		if err := ValidHookEvent(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidHookEvent(e string) error {
+	for _, known := range hookEvents {
+		if e == known {
+			return nil
+		}
+	}
+	return errors.New("unknown webhook event: " + e)
+}
+
+func hookRank(event string) int {
+	for i, e := range hookEvents {
+		if e == event {
+			return i
+		}
+	}
+	return len(hookEvents)
+}
+
+func (h *Webhook) subscribed(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// The webhooks of the cluster by name.
+type Webhooks map[string]Webhook
+
+func loadWebhooks(st store.Store) (Webhooks, error) {
+	hs := Webhooks{}
+	err := st.GetMeta(webhooksKey, &hs)
+	if err == store.ErrNotFound {
+		return Webhooks{}, nil
+	}
+	return hs.withoutSecrets(), err
+}
+
+// withoutSecrets drops the secrets earlier versions replicated.
+func (hs Webhooks) withoutSecrets() Webhooks {
+	for name, h := range hs {
+		h.Secret = ""
+		hs[name] = h
+	}
+	return hs
+}
+
+// The body of a webhook request. The ID is the hash of the rest and of
+// the new content of the tx, so that every node queues a notification
+// under the same ID, also when the log is replayed, while two redactions
+// of a tx within a second differ: they keep its hash. It is sent as
+// Idempotency-Key: delivery is at least once, receivers drop IDs they have
+// seen. It names the tx by hash and position only: the outbox and dead
+// letters outlive redactions, receivers read the tx through the API.
+type Notification struct {
+	ID     string `json:"id"`
+	Event  string `json:"event"`
+	Time   int64  `json:"time"`
+	Height int    `json:"height"`
+	TxId   int    `json:"tx_id"`
+	Hash   string `json:"hash"`
+}
+
+func newNotification(event string, t int64, height, txId int, tx *data.BasicTx) (Notification, error) {
+	n := Notification{
+		Event:  event,
+		Time:   t,
+		Height: height,
+		TxId:   txId,
+		Hash:   fmt.Sprintf("%x", tx.HashVal()),
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return n, err
+	}
+	content, err := json.Marshal(tx)
+	if err != nil {
+		return n, err
+	}
+	digest := sha256.Sum256(content)
+	sum := sha256.Sum256(append(b, digest[:]...))
+	n.ID = hex.EncodeToString(sum[:])
+	return n, nil
+}
+
+// A notification queued for one webhook. Keys group the outbox by webhook
+// and order each queue by the time of the event, then by event, so that
+// the proposal of a redaction goes out before its outcome. Attempts and
+// LastError are set on dead letters.
+type Delivery struct {
+	Key          string       `json:"key"`
+	Webhook      string       `json:"webhook"`
+	Notification Notification `json:"notification"`
+	Attempts     int          `json:"attempts,omitempty"`
+	LastError    string       `json:"last_error,omitempty"`
+}
+
+// One page of deliveries.
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+// enqueue puts n into the outbox of every webhook subscribed to its event.
+func enqueue(st store.Store, n Notification) error {
+	hooks, err := loadWebhooks(st)
+	if err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		if !h.subscribed(n.Event) {
+			continue
+		}
+		d := Delivery{Key: fmt.Sprintf("%s.%012d.%d.%s", h.Name, n.Time, hookRank(n.Event), n.ID), Webhook: h.Name, Notification: n}
+		if err = putDelivery(st, outboxIndex, &d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putDelivery(st store.Store, idx string, d *Delivery) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return st.IndexPut(idx, d.Key, b)
+}
+
+func getDelivery(st store.Store, idx, key string) (*Delivery, error) {
+	b, err := st.IndexGet(idx, key)
+	if err != nil {
+		return nil, err
+	}
+	d := &Delivery{}
+	return d, json.Unmarshal(b, d)
+}
+
+// scanDeliveries reads up to limit deliveries after the key cursor, all
+// of them with limit 0.
+func scanDeliveries(st store.Store, idx, cursor string, limit int) ([]Delivery, error) {
+	return scanQueue(st, idx, "", cursor, limit)
+}
+
+// queuePrefix is the key prefix of the deliveries of the webhook name.
+func queuePrefix(name string) string {
+	return name + "."
+}
+
+// scanQueue is scanDeliveries over the keys with prefix.
+func scanQueue(st store.Store, idx, prefix, cursor string, limit int) ([]Delivery, error) {
+	entries, err := st.IndexScan(idx, prefix, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Delivery, 0, len(entries))
+	for _, e := range entries {
+		d := Delivery{}
+		if err = json.Unmarshal(e.Value, &d); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 which webhook requests carry as
+// sha256=<signature>, computed with the secret of the webhook over the
+// timestamp header, a dot and the body.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature of a webhook request for receivers
+// written in Go. Requests signed longer than maxAge ago are rejected,
+// 0 accepts any age.
+func VerifyWebhook(secret string, header http.Header, body []byte, maxAge time.Duration) error {
+	ts := header.Get(HookTimestampHeader)
+	sent, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("invalid webhook timestamp")
+	}
+	if maxAge > 0 && time.Since(time.Unix(sent, 0)) > maxAge {
+		return errors.New("webhook timestamp too old")
+	}
+	want := "sha256=" + SignWebhook(secret, ts, body)
+	if !hmac.Equal([]byte(want), []byte(header.Get(HookSignatureHeader))) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
+
+// How the leader delivers the outbox. Each delivery is attempted up to
+// MaxAttempts times before it becomes a dead letter, with Backoff (ms)
+// doubling between attempts up to MaxBackoff (ms). Timeout (ms) bounds
+// one request.
+type DeliveryConfig struct {
+	MaxAttempts int
+	Backoff     int
+	MaxBackoff  int
+	Timeout     int
+}
+
+func DefaultDeliveryConfig() DeliveryConfig {
+	return DeliveryConfig{MaxAttempts: 10, Backoff: 1000, MaxBackoff: 3600000, Timeout: 10000}
+}
+
+func (c DeliveryConfig) Validate() error {
+	if c.MaxAttempts < 1 {
+		return errors.New("webhook deliveries need an attempt")
+	}
+	if c.Backoff < 0 || c.MaxBackoff < c.Backoff {
+		return errors.New("webhook backoff must not be negative nor above its maximum")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("webhook timeout must be positive")
+	}
+	return nil
+}
+
+func (s *Server) SetDelivery(c DeliveryConfig) {
+	s.delivery = c
+}
+
+// backoff returns the wait after the nth failed attempt.
+func (c DeliveryConfig) backoff(n int) time.Duration {
+	d := time.Duration(c.Backoff) * time.Millisecond
+	max := time.Duration(c.MaxBackoff) * time.Millisecond
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// The failures of a delivery, counted by the leader.
+type attempt struct {
+	count int
+	next  time.Time
+	err   string
+}
+
+// webhookTransport is the transport of webhook requests. Receivers are
+// outside the cluster: they are checked against the system roots, and
+// not shown the node certificate which pki.UseForDefaultClient gives the
+// default transport.
+func webhookTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return t
+}
+
+// deliverLoop sends the outbox while this node leads. The deliveries of a
+// webhook go out in order: a failed one holds back the later ones until
+// it succeeds or becomes a dead letter. Attempts are only counted in the
+// memory of the leader, a new leader starts over, and may repeat a
+// delivery its predecessor made just before the change. Without a webhook
+// key the outbox waits.
+func (s *Server) deliverLoop() {
+	client := &http.Client{Transport: webhookTransport(), Timeout: time.Duration(s.delivery.Timeout) * time.Millisecond}
+	attempts := map[string]*attempt{}
+	for s.sleep(deliveryTick) {
+		if !s.engine.IsLeader() || len(s.webhookKey) == 0 {
+			attempts = map[string]*attempt{}
+			continue
+		}
+		if err := s.deliverDue(client, attempts); err != nil {
+			logging.Warn("webhook delivery failed", "err", err)
+		}
+	}
+}
+
+// deliverDue reads the head of the queue of every webhook, so that one
+// which fails holds back only its own deliveries.
+func (s *Server) deliverDue(client *http.Client, attempts map[string]*attempt) error {
+	hooks, err := loadWebhooks(s.store)
+	if err != nil {
+		return err
+	}
+	queues := map[string][]Delivery{}
+	seen := map[string]bool{}
+	for name := range hooks {
+		queue, err := scanQueue(s.store, outboxIndex, queuePrefix(name), "", deliveryBatch)
+		if err != nil {
+			return err
+		}
+		for _, d := range queue {
+			seen[d.Key] = true
+		}
+		queues[name] = queue
+	}
+	// forget deliveries settled meanwhile
+	for key := range attempts {
+		if !seen[key] {
+			delete(attempts, key)
+		}
+	}
+
+	cmd := &SettleDeliveriesCommand{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, queue := range queues {
+		hook, ok := hooks[name]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(hook Webhook, queue []Delivery) {
+			defer wg.Done()
+			for _, d := range queue {
+				mutex.Lock()
+				a := attempts[d.Key]
+				if a == nil {
+					a = &attempt{}
+					attempts[d.Key] = a
+				}
+				mutex.Unlock()
+				if time.Now().Before(a.next) {
+					return
+				}
+				err := s.deliver(client, &hook, &d)
+				mutex.Lock()
+				if err == nil {
+					cmd.Delivered = append(cmd.Delivered, d.Key)
+					mutex.Unlock()
+					continue
+				}
+				a.count++
+				a.err = err.Error()
+				if a.count >= s.delivery.MaxAttempts {
+					cmd.Failed = append(cmd.Failed, DeadLetter{Key: d.Key, Attempts: a.count, LastError: a.err})
+					mutex.Unlock()
+					logging.Warn("webhook delivery dead", "webhook", hook.Name, "id", d.Notification.ID, "attempts", a.count, "err", err)
+					continue
+				}
+				a.next = time.Now().Add(s.delivery.backoff(a.count))
+				mutex.Unlock()
+				logging.Info("webhook delivery failed, retrying", "webhook", hook.Name, "id", d.Notification.ID, "attempt", a.count, "next", a.next, "err", err)
+				return
+			}
+		}(hook, queue)
+	}
+	wg.Wait()
+
+	if len(cmd.Delivered)+len(cmd.Failed) == 0 {
+		return nil
+	}
+	_, err = s.engine.Propose(cmd)
+	return err
+}
+
+// Sets the key every node derives the webhook secrets from. All nodes of
+// a cluster need the same key, or receivers reject the deliveries of the
+// next leader. Without one, webhooks cannot be set and the outbox is not
+// delivered. Must be called before ListenAndServe.
+func (s *Server) SetWebhookKey(key []byte) {
+	s.webhookKey = key
+}
+
+// LoadWebhookKey reads a webhook key file, which the operator creates and
+// copies to all nodes.
+func LoadWebhookKey(path string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(raw)
+	if len(key) < minWebhookKey {
+		return nil, fmt.Errorf("webhook key in %s is shorter than %d bytes", path, minWebhookKey)
+	}
+	return key, nil
+}
+
+var errNoWebhookKey = errors.New("no webhook key, start all nodes with the same -webhook-key")
+
+// hookSecret derives the secret of hook from the webhook key and its
+// nonce.
+func (s *Server) hookSecret(hook *Webhook) (string, error) {
+	if len(s.webhookKey) == 0 {
+		return "", errNoWebhookKey
+	}
+	if hook.Nonce == "" {
+		return "", errors.New("webhook " + hook.Name + " has no secret, rotate it")
+	}
+	mac := hmac.New(sha256.New, s.webhookKey)
+	mac.Write([]byte("webhook secret:" + hook.Name + ":" + hook.Nonce))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// deliver posts the notification of d to hook, signed with its secret.
+func (s *Server) deliver(client *http.Client, hook *Webhook, d *Delivery) error {
+	secret, err := s.hookSecret(hook)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(d.Notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HookEventHeader, d.Notification.Event)
+	req.Header.Set(HookTimestampHeader, ts)
+	req.Header.Set(HookSignatureHeader, "sha256="+SignWebhook(secret, ts, body))
+	req.Header.Set(IdempotencyHeader, d.Notification.ID)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// This command creates or updates a webhook. An empty nonce keeps the
+// secret of an existing webhook. Secrets are never replicated, a secret
+// in the command is dropped.
+type SetWebhookCommand struct {
+	Webhook
+}
+
+// The name of the command in the log.
+func (c *SetWebhookCommand) CommandName() string {
+	return "Set Webhook"
+}
+
+func (c *SetWebhookCommand) Execute(state interface{}) (interface{}, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	st := storeOf(state)
+	hs, err := loadWebhooks(st)
+	if err != nil {
+		return nil, err
+	}
+	h := c.Webhook
+	h.Secret = ""
+	if h.Nonce == "" {
+		old, ok := hs[h.Name]
+		if !ok {
+			return nil, errors.New("new webhook " + h.Name + " needs a nonce")
+		}
+		h.Nonce = old.Nonce
+	}
+	next := Webhooks{}
+	for name, q := range hs {
+		next[name] = q
+	}
+	next[h.Name] = h
+	if err = st.PutMeta(webhooksKey, next); err != nil {
+		return nil, err
+	}
+	logging.Info("webhook set", "name", h.Name, "url", h.URL, "events", h.Events)
+	return nil, nil
+}
+
+// This command removes a webhook along with its pending deliveries. Its
+// dead letters are kept.
+type RemoveWebhookCommand struct {
+	Name string `json:"name"`
+}
+
+// The name of the command in the log.
+func (c *RemoveWebhookCommand) CommandName() string {
+	return "Remove Webhook"
+}
+
+func (c *RemoveWebhookCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	hs, err := loadWebhooks(st)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := hs[c.Name]; !ok {
+		return nil, nil
+	}
+	next := Webhooks{}
+	for name, h := range hs {
+		if name != c.Name {
+			next[name] = h
+		}
+	}
+	if err = st.PutMeta(webhooksKey, next); err != nil {
+		return nil, err
+	}
+	pending, err := scanQueue(st, outboxIndex, queuePrefix(c.Name), "", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range pending {
+		if err = st.IndexDelete(outboxIndex, d.Key); err != nil {
+			return nil, err
+		}
+	}
+	logging.Info("webhook removed", "name", c.Name)
+	return nil, nil
+}
+
+// This command queues a notification which no other command implies, the
+// proposal of a redaction. The leader replicates it ahead of the
+// redaction, whose outcome is queued by the ModifyCommand.
+type NotifyCommand struct {
+	Notification Notification `json:"notification"`
+}
+
+// The name of the command in the log.
+func (c *NotifyCommand) CommandName() string {
+	return "Notify"
+}
+
+func (c *NotifyCommand) Execute(state interface{}) (interface{}, error) {
+	if err := ValidHookEvent(c.Notification.Event); err != nil {
+		return nil, err
+	}
+	return nil, enqueue(storeOf(state), c.Notification)
+}
+
+// A delivery the leader gave up on.
+type DeadLetter struct {
+	Key       string `json:"key"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error"`
+}
+
+// This command removes delivered notifications from the outbox and moves
+// failed ones to the dead letters. Deliveries no longer in the outbox
+// are skipped, so a repeated settlement changes nothing.
+type SettleDeliveriesCommand struct {
+	Delivered []string     `json:"delivered,omitempty"`
+	Failed    []DeadLetter `json:"failed,omitempty"`
+}
+
+// The name of the command in the log.
+func (c *SettleDeliveriesCommand) CommandName() string {
+	return "Settle Deliveries"
+}
+
+func (c *SettleDeliveriesCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	for _, key := range c.Delivered {
+		if err := st.IndexDelete(outboxIndex, key); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range c.Failed {
+		d, err := getDelivery(st, outboxIndex, f.Key)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.Attempts = f.Attempts
+		d.LastError = f.LastError
+		if err = putDelivery(st, deadLetterIndex, d); err != nil {
+			return nil, err
+		}
+		if err = st.IndexDelete(outboxIndex, f.Key); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// This command moves a dead letter back into the outbox, for another
+// round of attempts.
+type RedriveCommand struct {
+	Key string `json:"key"`
+}
+
+// The name of the command in the log.
+func (c *RedriveCommand) CommandName() string {
+	return "Redrive Delivery"
+}
+
+func (c *RedriveCommand) Execute(state interface{}) (interface{}, error) {
+	st := storeOf(state)
+	d, err := getDelivery(st, deadLetterIndex, c.Key)
+	if err == store.ErrNotFound {
+		return nil, notFound("no dead letter %s", c.Key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.Attempts = 0
+	d.LastError = ""
+	if err = putDelivery(st, outboxIndex, d); err != nil {
+		return nil, err
+	}
+	if err = st.IndexDelete(deadLetterIndex, c.Key); err != nil {
+		return nil, err
+	}
+	logging.Info("dead letter redriven", "key", c.Key, "webhook", d.Webhook)
+	return nil, nil
+}
+
+// Client function
+func GetWebhooks(host, consistency string) (list []Webhook, err error) {
+	err = getV1(consistency, host+"/v1/webhooks", &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Creates or updates a webhook. A new webhook, or one with rotate set,
+// gets a new secret, which is returned.
+func SetWebhook(host, name, u string, events []string, rotate bool) (h *Webhook, err error) {
+	content, err := json.Marshal(webhookRequest{URL: u, Events: events, Rotate: rotate})
+	if err != nil {
+		return nil, err
+	}
+	h = &Webhook{}
+	if err = call(http.MethodPut, host+"/v1/webhooks/"+url.PathEscape(name), content, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func RemoveWebhook(host, name string) (returnData []byte, err error) {
+	return sendV1(http.MethodDelete, host+"/v1/webhooks/"+url.PathEscape(name), nil)
+}
+
+func GetOutbox(host, cursor string, limit int, consistency string) (page *DeliveryPage, err error) {
+	return getDeliveries(host+"/v1/webhooks/outbox", cursor, limit, consistency)
+}
+
+func GetDeadLetters(host, cursor string, limit int, consistency string) (page *DeliveryPage, err error) {
+	return getDeliveries(host+"/v1/webhooks/dead_letters", cursor, limit, consistency)
+}
+
+func getDeliveries(u, cursor string, limit int, consistency string) (page *DeliveryPage, err error) {
+	q := url.Values{}
+	q.Set("cursor", cursor)
+	q.Set("limit", strconv.Itoa(limit))
+	page = &DeliveryPage{}
+	err = getV1(consistency, u+"?"+q.Encode(), page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Queues a dead letter for delivery again.
+func RetryDeadLetter(host, key string) (returnData []byte, err error) {
+	return sendV1(http.MethodPost, host+"/v1/webhooks/dead_letters/"+url.PathEscape(key)+"/retry", nil)
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Rotate bool     `json:"rotate"`
+}
+
+func (s *Server) webhookList() ([]Webhook, error) {
+	hooks, err := loadWebhooks(s.store)
+	if err != nil {
+		return nil, err
+	}
+	list := []Webhook{}
+	for _, h := range hooks {
+		h.Nonce, h.Secret = "", ""
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// setWebhook proposes r for name. The secret is only created, and
+// returned, for a new webhook or on rotation.
+func (s *Server) setWebhook(name string, r webhookRequest) (*Webhook, error) {
+	cmd := &SetWebhookCommand{Webhook{Name: name, URL: r.URL, Events: r.Events}}
+	if err := cmd.Validate(); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if len(s.webhookKey) == 0 {
+		return nil, &APIError{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: errNoWebhookKey.Error()}
+	}
+	hooks, err := loadWebhooks(s.store)
+	if err != nil {
+		return nil, err
+	}
+	var secret string
+	if _, ok := hooks[name]; !ok || r.Rotate {
+		if cmd.Nonce, err = newToken(); err != nil {
+			return nil, err
+		}
+		if secret, err = s.hookSecret(&cmd.Webhook); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = s.engine.Propose(cmd); err != nil {
+		return nil, err
+	}
+	h := cmd.Webhook
+	h.Nonce, h.Secret = "", secret
+	return &h, nil
+}
+
+func (s *Server) deliveryPage(req *http.Request, idx string) (*DeliveryPage, error) {
+	limit, err := queryInt(req, "limit", index.DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > index.MaxLimit {
+		limit = index.MaxLimit
+	}
+	list, err := scanDeliveries(s.store, idx, req.URL.Query().Get("cursor"), limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &DeliveryPage{Deliveries: list}
+	if len(list) > limit {
+		page.Deliveries = list[:limit]
+		page.NextCursor = list[limit-1].Key
+	}
+	return page, nil
+}
+
+// Server handler
+func (s *Server) apiWebhooks(req *http.Request) (interface{}, error) {
+	return s.webhookList()
+}
+
+func (s *Server) apiSetWebhook(req *http.Request) (interface{}, error) {
+	r := webhookRequest{}
+	if err := decodeBody(req, &r); err != nil {
+		return nil, err
+	}
+	return s.setWebhook(mux.Vars(req)["name"], r)
+}
+
+func (s *Server) apiRemoveWebhook(req *http.Request) (interface{}, error) {
+	name := mux.Vars(req)["name"]
+	if _, err := s.engine.Propose(&RemoveWebhookCommand{Name: name}); err != nil {
+		return nil, err
+	}
+	return map[string]string{"removed": name}, nil
+}
+
+func (s *Server) apiOutbox(req *http.Request) (interface{}, error) {
+	return s.deliveryPage(req, outboxIndex)
+}
+
+func (s *Server) apiDeadLetters(req *http.Request) (interface{}, error) {
+	return s.deliveryPage(req, deadLetterIndex)
+}
+
+func (s *Server) apiRetryDeadLetter(req *http.Request) (interface{}, error) {
+	key := mux.Vars(req)["key"]
+	if _, err := s.engine.Propose(&RedriveCommand{Key: key}); err != nil {
+		return nil, err
+	}
+	return map[string]string{"retried": key}, nil
+}
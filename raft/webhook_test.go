@@ -0,0 +1,219 @@
+package raft
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/pki"
+)
+
+var testWebhookKey = []byte("0123456789abcdef0123456789abcdef")
+
+// newHookServer returns a test server with a webhook key and the webhook
+// audit on url.
+func newHookServer(t *testing.T, url string) (*Server, *data.GolbalParameter) {
+	t.Helper()
+	s, para := newTestServer(t)
+	if _, err := s.setWebhook("audit", webhookRequest{URL: url, Events: hookEvents}); err == nil {
+		t.Fatal("webhook set without a webhook key")
+	}
+	s.SetWebhookKey(testWebhookKey)
+	if _, err := s.setWebhook("audit", webhookRequest{URL: url, Events: hookEvents}); err != nil {
+		t.Fatal(err)
+	}
+	return s, para
+}
+
+func events(t *testing.T, s *Server) []string {
+	t.Helper()
+	pending, err := scanDeliveries(s.store, outboxIndex, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []string{}
+	for _, d := range pending {
+		list = append(list, d.Notification.Event)
+	}
+	return list
+}
+
+// Proposals are announced when the leader accepts them, their outcome
+// when they apply or fail. Notifications name the tx without carrying it.
+func TestRedactionNotifications(t *testing.T) {
+	s, para := newHookServer(t, "http://example.com/hook")
+	addAndPack(t, s, para, "secret-before", "other")
+	other, err := s.tx(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tx 1 in place of tx 0 fails the hash check of the command
+	if _, err = s.engine.Propose(NewModifyCommand(1, 0, *other, chainParameter(para), 1)); err == nil {
+		t.Fatal("redaction with another hash applied")
+	}
+	if got := events(t, s); len(got) != 1 || got[0] != HookRedactionRejected {
+		t.Fatalf("outbox after a rejected redaction %v", got)
+	}
+
+	tx, err := s.tx(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{"first", "second"} {
+		if err = tx.Modify([]byte(payload), []byte("proof"), para.Tk, chainParameter(para)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.modifyTx(1, 0, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// redactions of a tx within a second keep their notifications apart
+	got := events(t, s)
+	count := map[string]int{}
+	for _, e := range got {
+		count[e]++
+	}
+	if got[0] != HookRedactionRejected || count[HookRedactionProposed] != 2 || count[HookTxModified] != 2 || len(got) != 5 {
+		t.Fatalf("outbox %v", got)
+	}
+	pending, err := scanDeliveries(s.store, outboxIndex, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "transaction") || strings.Contains(string(b), "payload") {
+		t.Fatalf("outbox keeps the tx: %s", b)
+	}
+}
+
+// Nodes sharing the webhook key sign with the same secret, which is not
+// replicated.
+func TestWebhookSecret(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetWebhookKey(testWebhookKey)
+	hook, err := s.setWebhook("audit", webhookRequest{URL: "http://example.com/hook", Events: hookEvents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.Secret == "" || hook.Nonce != "" {
+		t.Fatalf("created webhook %+v", hook)
+	}
+	var raw json.RawMessage
+	if err = s.store.GetMeta(webhooksKey, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), hook.Secret) || strings.Contains(string(raw), "secret") {
+		t.Fatalf("secret replicated: %s", raw)
+	}
+
+	// another node of the cluster, with the key of the first
+	other, _ := newTestServer(t)
+	other.SetWebhookKey(testWebhookKey)
+	hooks, err := loadWebhooks(s.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicated := hooks["audit"]
+	var got http.Header
+	var body []byte
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header
+		body, _ = ioutil.ReadAll(req.Body)
+	}))
+	defer target.Close()
+	replicated.URL = target.URL
+	n := Notification{ID: "1", Event: HookTxModified, Time: 1, Height: 1, Hash: "ab"}
+	if err = other.deliver(target.Client(), &replicated, &Delivery{Notification: n}); err != nil {
+		t.Fatal(err)
+	}
+	want := "sha256=" + SignWebhook(hook.Secret, got.Get(HookTimestampHeader), body)
+	if sig := got.Get(HookSignatureHeader); sig != want {
+		t.Fatalf("signature %s, want %s", sig, want)
+	}
+
+	other.SetWebhookKey([]byte("another key of 16 bytes"))
+	if secret, err := other.hookSecret(&replicated); err != nil || secret == hook.Secret {
+		t.Fatalf("secret %q under another key: %v", secret, err)
+	}
+}
+
+func TestLoadWebhookKey(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadWebhookKey(dir + "/missing"); err == nil {
+		t.Fatal("missing key loaded")
+	}
+	for content, valid := range map[string]bool{"short\n": false, string(testWebhookKey) + "\n": true} {
+		path := dir + "/key"
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := LoadWebhookKey(path)
+		if (err == nil) != valid || (valid && string(key) != string(testWebhookKey)) {
+			t.Errorf("key %q: %q, %v", content, key, err)
+		}
+	}
+}
+
+// A webhook which fails holds back its own deliveries only, however many
+// it has queued.
+func TestFailingWebhookQueue(t *testing.T) {
+	var mutex sync.Mutex
+	received := 0
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		received++
+		mutex.Unlock()
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	s, _ := newHookServer(t, down.URL)
+	// earlier than anything the working webhook is sent
+	for i := 0; i < deliveryBatch+10; i++ {
+		n := Notification{ID: fmt.Sprint(i), Event: HookTxModified, Time: int64(i)}
+		if err := enqueue(s.store, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.setWebhook("billing", webhookRequest{URL: up.URL, Events: []string{HookTxModified}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueue(s.store, Notification{ID: "late", Event: HookTxModified, Time: 1 << 40}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.deliverDue(&http.Client{Timeout: time.Second}, map[string]*attempt{}); err != nil {
+		t.Fatal(err)
+	}
+	if received != 1 {
+		t.Fatalf("working webhook received %d deliveries", received)
+	}
+	if pending, err := scanQueue(s.store, outboxIndex, queuePrefix("billing"), "", 0); err != nil || len(pending) != 0 {
+		t.Fatalf("%d deliveries of the working webhook pending: %v", len(pending), err)
+	}
+}
+
+// Receivers outside the cluster are not checked against the cluster CA,
+// nor shown the node certificate.
+func TestWebhookTransport(t *testing.T) {
+	saved := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	defer pki.UseForDefaultClient(saved)
+	pki.UseForDefaultClient(&tls.Config{Certificates: []tls.Certificate{{}}})
+	config := webhookTransport().TLSClientConfig
+	if config == nil || config.RootCAs != nil || len(config.Certificates) != 0 || config.GetClientCertificate != nil {
+		t.Fatalf("webhook tls config %+v", config)
+	}
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/RedactableBlockChain/consensus"
+	"github.com/RedactableBlockChain/consensus/pbft"
+	"github.com/RedactableBlockChain/consensus/poa"
 	"github.com/RedactableBlockChain/data"
-	"github.com/RedactableBlockChain/path"
+	"github.com/RedactableBlockChain/identity"
+	"github.com/RedactableBlockChain/index"
+	"github.com/RedactableBlockChain/logging"
+	"github.com/RedactableBlockChain/mempool"
+	"github.com/RedactableBlockChain/pki"
 	raftc "github.com/RedactableBlockChain/raft"
+	"github.com/RedactableBlockChain/store"
 	"github.com/goraft/raft"
-	"log"
+	"log/slog"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -18,11 +30,46 @@ var trace bool
 var debug bool
 var host string
 var port int
+var grpcPort int
 var interval int
+var blockMaxTxs int
+var blockMaxBytes int
+var blockMaxWait int
+var heartbeat int
+var forwardMode string
+var forwardRetries int
+var webhookAttempts int
+var webhookBackoff int
+var webhookTimeout int
+var webhookKeyPath string
+var readConsistency string
+var snapshotInterval uint64
+var trustedKeysPath string
+var engine string
+var validatorsPath string
+var identityPath string
+var indexKeyPath string
+var viewTimeout int
+var tlsCert string
+var tlsKey string
+var tlsCA string
+var tlsPeerAuth bool
+var auth bool
 var join string
 var configPath string
 var txPoolPath string
 var blockPath string
+var storeType string
+var dbPath string
+var reindex bool
+var poolMaxTxs int
+var poolMaxBytes int
+var poolTTL int
+var poolOrder string
+var logLevel string
+var logFormat string
+var logPayload string
+var debugPayload bool
 
 func init() {
 	flag.BoolVar(&verbose, "v", false, "verbose logging")
@@ -32,9 +79,44 @@ func init() {
 	flag.StringVar(&configPath, "config", "./storage/config", "Config file path")
 	flag.StringVar(&txPoolPath, "pool", "./storage/pool/", "Transaction pool dir")
 	flag.StringVar(&blockPath, "blockdir", "./storage/block/", "Block storage dir")
+	flag.StringVar(&storeType, "store", "file", "storage backend: file, bolt or mem")
+	flag.StringVar(&dbPath, "db", "./storage/chain.db", "database file of the bolt storage backend")
+	flag.BoolVar(&reindex, "reindex", false, "rebuild all indexes from the block store on start")
+	flag.StringVar(&indexKeyPath, "index-key", "", "key file search terms are hashed with, created on first start. default: index_key in the data path")
+	flag.IntVar(&poolMaxTxs, "pool-max-txs", 10000, "max transactions in mempool, 0 for unlimited, seeds a new cluster")
+	flag.IntVar(&poolMaxBytes, "pool-max-bytes", 64<<20, "max bytes in mempool, 0 for unlimited, seeds a new cluster")
+	flag.IntVar(&poolTTL, "pool-ttl", 0, "seconds a transaction may wait in mempool, 0 for no expiry, seeds a new cluster")
+	flag.StringVar(&poolOrder, "pool-order", "fifo", "mempool ordering: fifo or priority, seeds a new cluster")
 	flag.IntVar(&port, "p", 6666, "port")
-	flag.IntVar(&interval, "t", 10000, "block interval (uint ms)")
-	flag.StringVar(&join, "join", "", "host:port of leader to join")
+	flag.IntVar(&grpcPort, "grpc-port", 0, "port of the gRPC API, 0 to disable")
+	flag.IntVar(&interval, "t", 10000, "block interval (uint ms), 0 to seal on -block-max-wait only")
+	flag.IntVar(&blockMaxTxs, "block-max-txs", raftc.MAX_BLOCK_TX_NUM, "max transactions per block")
+	flag.IntVar(&blockMaxBytes, "block-max-bytes", 0, "max transaction bytes per block, 0 for unlimited")
+	flag.IntVar(&blockMaxWait, "block-max-wait", 0, "seal a partial block once a transaction waited this long (uint ms), 0 to disable")
+	flag.IntVar(&heartbeat, "heartbeat", 0, "seal an empty block after this long without blocks (uint ms), 0 to disable")
+	flag.StringVar(&forwardMode, "forward", raftc.ForwardProxy, "how followers handle writes: proxy to the leader or redirect the client")
+	flag.IntVar(&forwardRetries, "forward-retries", 5, "times a write is retried while no leader is known")
+	flag.IntVar(&webhookAttempts, "webhook-attempts", 10, "times a webhook delivery is attempted before it becomes a dead letter")
+	flag.IntVar(&webhookBackoff, "webhook-backoff", 1000, "wait after the first failed webhook delivery, doubling up to an hour (uint ms)")
+	flag.IntVar(&webhookTimeout, "webhook-timeout", 10000, "timeout of a webhook request (uint ms)")
+	flag.StringVar(&webhookKeyPath, "webhook-key", "", "file of the key webhook secrets are derived from, at least 16 bytes and the same on all nodes; webhooks need one")
+	flag.StringVar(&readConsistency, "read-consistency", raftc.ReadLocal, "default consistency of reads: local, leader or linearizable")
+	flag.Uint64Var(&snapshotInterval, "snapshot-interval", 1000, "take a snapshot every this many committed raft entries, 0 to disable")
+	flag.StringVar(&trustedKeysPath, "trusted-keys", "", "key map of the cluster as served by /v1/keys, trusted to seal the blocks a node syncs after a snapshot")
+	flag.StringVar(&engine, "engine", "raft", "consensus engine: raft, pbft, poa, or local for a single development node")
+	flag.StringVar(&validatorsPath, "validators", "./storage/validators.json", "validators of the pbft engine or signers of the poa engine, a JSON list of name, address and public_key")
+	flag.StringVar(&identityPath, "identity", "", "node key file, created on first start. default: identity in the data path")
+	flag.IntVar(&viewTimeout, "view-timeout", 5000, "how long a pbft request may stay pending before the primary is replaced (uint ms)")
+	flag.StringVar(&tlsCert, "tls-cert", "", "certificate of the node, issued to its name by the ca tool, enables TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "key of -tls-cert")
+	flag.StringVar(&tlsCA, "tls-ca", "", "certificate of the cluster CA")
+	flag.BoolVar(&tlsPeerAuth, "tls-peer-auth", false, "require a client certificate of the CA on consensus traffic and joins")
+	flag.BoolVar(&auth, "auth", false, "require API tokens on a new cluster, with -tls-peer-auth: its first leader writes an admin token to admin_token in the data path")
+	flag.StringVar(&join, "join", "", "host:port of leader to join, the chain parameter and genesis block are fetched from it")
+	flag.StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn, error")
+	flag.StringVar(&logFormat, "log-format", "text", "log format: text or json")
+	flag.StringVar(&logPayload, "log-payload", "hash", "how tx payloads appear in logs: hash, truncate, omit or full")
+	flag.BoolVar(&debugPayload, "debug-payload", false, "allow plaintext tx payloads in logs (needed by -log-payload=truncate and full)")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [arguments] <data-path> \n", os.Args[0])
 		flag.PrintDefaults()
@@ -42,68 +124,308 @@ func init() {
 }
 
 func main() {
-	log.SetFlags(0)
 	flag.Parse()
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		logging.Fatal("invalid log level", "err", err)
+	}
 	if verbose {
-		log.Print("Verbose logging enabled.")
+		level = slog.LevelDebug
+	}
+	mode, err := logging.ParseMode(logPayload)
+	if err != nil {
+		logging.Fatal("invalid payload log mode", "err", err)
+	}
+	logging.Setup(logging.Config{
+		Level:         level,
+		Format:        logFormat,
+		PayloadMode:   mode,
+		DebugPayloads: debugPayload,
+	})
+	if verbose {
+		logging.Info("verbose logging enabled")
 	}
 	if trace {
 		raft.SetLogLevel(raft.Trace)
-		log.Print("Raft trace debugging enabled.")
+		logging.Info("raft trace debugging enabled")
 	} else if debug {
 		raft.SetLogLevel(raft.Debug)
-		log.Print("Raft debugging enabled.")
+		logging.Info("raft debugging enabled")
 	}
 
 	rand.Seed(time.Now().UnixNano())
 
 	// Setup commands.
-	raft.RegisterCommand(&raftc.ModifyCommand{})
-	raft.RegisterCommand(&raftc.AddTxCommand{})
-	raft.RegisterCommand(&raftc.PackCommand{})
+	consensus.RegisterCommand(&raftc.ModifyCommand{})
+	consensus.RegisterCommand(&raftc.AddTxCommand{})
+	consensus.RegisterCommand(&raftc.PackCommand{})
+	consensus.RegisterCommand(&raftc.SetPolicyCommand{})
+	consensus.RegisterCommand(&raftc.SetPoolConfigCommand{})
+	consensus.RegisterCommand(&raftc.RegisterKeyCommand{})
+	consensus.RegisterCommand(&raftc.ActivateSealsCommand{})
+	consensus.RegisterCommand(&raftc.SetPrincipalCommand{})
+	consensus.RegisterCommand(&raftc.RevokePrincipalCommand{})
+	consensus.RegisterCommand(&raftc.SetWebhookCommand{})
+	consensus.RegisterCommand(&raftc.RemoveWebhookCommand{})
+	consensus.RegisterCommand(&raftc.NotifyCommand{})
+	consensus.RegisterCommand(&raftc.SettleDeliveriesCommand{})
+	consensus.RegisterCommand(&raftc.RedriveCommand{})
 
-	// Set up blockchain related dirs
-	path.SetBlockDirPath(blockPath)
-	path.SetConfigPath(configPath)
-	path.SetTxPoolPath(txPoolPath)
-	if !PathExists(path.GetBlockDirPath()) {
-		os.Mkdir(path.GetBlockDirPath(), os.ModePerm)
+	// Consensus traffic carries full tx payloads, which may have to be
+	// erased later, so it is encrypted along with the API.
+	tlsConfig := pki.Config{CertFile: tlsCert, KeyFile: tlsKey, CAFile: tlsCA, PeerAuth: tlsPeerAuth}
+	if err := tlsConfig.Validate(); err != nil {
+		logging.Fatal("invalid tls", "err", err)
 	}
-	if !PathExists(path.GetTxPoolPath()) {
-		os.Mkdir(path.GetTxPoolPath(), os.ModePerm)
+	scheme := "http"
+	var serverTLS, clientTLS *tls.Config
+	if tlsConfig.Enabled() {
+		if serverTLS, clientTLS, err = tlsConfig.Load(); err != nil {
+			logging.Fatal("unable to load tls", "err", err)
+		}
+		pki.UseForDefaultClient(clientTLS)
+		scheme = "https"
 	}
-	if !PathExists(path.GetConfigPath()) {
-		log.Fatalf("Cannot find config file!")
+
+	// Set the data directory.
+	if flag.NArg() == 0 {
+		flag.Usage()
+		logging.Fatal("data path argument required")
+	}
+	path := flag.Arg(0)
+	if err := os.MkdirAll(path, 0744); err != nil {
+		logging.Fatal("unable to create path", "err", err)
+	}
+
+	// Set up blockchain storage
+	if join == "" && !PathExists(configPath) {
+		logging.Fatal("cannot find config file", "path", configPath)
+	}
+	st, err := OpenStore()
+	if err != nil {
+		logging.Fatal("unable to open storage", "store", storeType, "err", err)
+	}
+	defer st.Close()
+	if join != "" {
+		// A joining node takes parameter and genesis from the cluster, so it
+		// cannot start from a diverging config.
+		if err := raftc.Bootstrap(st, fmt.Sprintf("%s://%s", scheme, join)); err != nil {
+			logging.Fatal("unable to bootstrap from leader", "leader", join, "err", err)
+		}
 	}
-	if !PathExists(path.GetBlockPath(0)) {
-		para, _, _, err := data.GetGolbalChameleonParameter()
+	if _, err := st.GetBlock(0); err == store.ErrNotFound {
+		para, _, _, err := store.ChameleonParameter(st)
 		if err != nil {
-			log.Fatalf("Error while create genesis block: %v", err)
+			logging.Fatal("error while create genesis block", "err", err)
 		}
 		block := data.NewBasicBlock(para)
 		err = block.Finalize(0, 0, []byte(""))
 		if err != nil {
-			log.Fatalf("Error while create genesis block: %v", err)
+			logging.Fatal("error while create genesis block", "err", err)
 		}
-		err = data.Write(&block, path.GetBlockPath(0))
+		err = st.PutBlock(block)
 		if err != nil {
-			log.Fatalf("Error while create genesis block: %v", err)
+			logging.Fatal("error while create genesis block", "err", err)
 		}
+	} else if err != nil {
+		logging.Fatal("unable to read genesis block", "err", err)
+	}
+	if err := store.Reconcile(st); err != nil {
+		logging.Fatal("unable to recover storage", "err", err)
+	}
+	if indexKeyPath == "" {
+		indexKeyPath = filepath.Join(path, "index_key")
+	}
+	termKey, err := index.LoadTermKey(indexKeyPath)
+	if err != nil {
+		logging.Fatal("unable to load the index key", "path", indexKeyPath, "err", err)
+	}
+	index.SetTermKey(termKey)
+	if reindex {
+		err = index.Rebuild(st)
+	} else {
+		err = index.CatchUp(st)
+	}
+	if err != nil {
+		logging.Fatal("unable to build indexes", "err", err)
+	}
+	// Like the block policy flags, the mempool flags only seed a new
+	// cluster, change the config of a running one through its endpoint.
+	pool, err := mempool.New(st, mempool.Config{
+		MaxTxs:   poolMaxTxs,
+		MaxBytes: poolMaxBytes,
+		TTL:      poolTTL,
+		Ordering: poolOrder,
+	})
+	if err != nil {
+		logging.Fatal("unable to load mempool", "err", err)
 	}
 
-	// Set the data directory.
-	if flag.NArg() == 0 {
-		flag.Usage()
-		log.Fatal("Data path argument required")
+	// The block policy flags only seed a new cluster, change the policy of a
+	// running one through the policy endpoint.
+	policy := raftc.BlockPolicy{
+		MaxTxs:    blockMaxTxs,
+		MaxBytes:  blockMaxBytes,
+		Interval:  interval,
+		MaxWait:   blockMaxWait,
+		Heartbeat: heartbeat,
 	}
-	path := flag.Arg(0)
-	if err := os.MkdirAll(path, 0744); err != nil {
-		log.Fatalf("Unable to create path: %v", err)
+	if err := policy.Validate(); err != nil {
+		logging.Fatal("invalid block policy", "err", err)
+	}
+
+	forward := raftc.DefaultForwardConfig()
+	forward.Mode = forwardMode
+	forward.Retries = forwardRetries
+	if err := forward.Validate(); err != nil {
+		logging.Fatal("invalid forwarding", "err", err)
+	}
+
+	delivery := raftc.DefaultDeliveryConfig()
+	delivery.MaxAttempts = webhookAttempts
+	delivery.Backoff = webhookBackoff
+	delivery.Timeout = webhookTimeout
+	if err := delivery.Validate(); err != nil {
+		logging.Fatal("invalid webhook delivery", "err", err)
+	}
+
+	s := raftc.New(path, host, port, policy, st, pool)
+	if serverTLS != nil {
+		s.SetTLS(serverTLS, clientTLS, tlsPeerAuth)
 	}
+	s.SetForwarding(forward)
+	s.SetDelivery(delivery)
+	if webhookKeyPath != "" {
+		key, err := raftc.LoadWebhookKey(webhookKeyPath)
+		if err != nil {
+			logging.Fatal("unable to read the webhook key", "err", err)
+		}
+		s.SetWebhookKey(key)
+	}
+	s.SetGRPC(grpcPort)
+	if auth {
+		if err := s.EnableAuth(); err != nil {
+			logging.Fatal("unable to enable authentication", "err", err)
+		}
+	}
+	if err := raftc.ValidReadConsistency(readConsistency); err != nil {
+		logging.Fatal("invalid read consistency", "err", err)
+	}
+	if engine == "poa" && readConsistency == raftc.ReadLinearizable {
+		logging.Fatal("invalid read consistency", "err", "the poa engine does not support linearizable reads")
+	}
+	s.SetReadConsistency(readConsistency)
+	s.SetSnapshotInterval(snapshotInterval)
+	trusted := raftc.NodeKeys{}
+	if trustedKeysPath != "" {
+		keys, err := raftc.ReadKeysFile(trustedKeysPath)
+		if err != nil {
+			logging.Fatal("unable to load trusted keys", "path", trustedKeysPath, "err", err)
+		}
+		trusted = keys
+	}
+	id := loadIdentity(s)
+	switch engine {
+	case "raft":
+	case "local":
+		s.SetEngine(consensus.NewLocal(s.Name(), s.ConnectionString(), s))
+	case "pbft":
+		validators, err := pbft.LoadValidators(validatorsPath)
+		if err != nil {
+			logging.Fatal("unable to load validators", "path", validatorsPath, "err", err)
+		}
+		e, err := pbft.New(pbft.Config{
+			Identity:    id,
+			Validators:  validators,
+			Transport:   pbft.NewHTTPTransport(validators),
+			ViewTimeout: time.Duration(viewTimeout) * time.Millisecond,
+			Path:        filepath.Join(path, "pbft"),
+		}, s)
+		if err != nil {
+			logging.Fatal("unable to create pbft engine", "err", err)
+		}
+		s.HandleFunc("/pbft", pbft.Handler(e))
+		s.SetEngine(e)
+	case "poa":
+		signers, err := poa.LoadSigners(validatorsPath)
+		if err != nil {
+			logging.Fatal("unable to load signers", "path", validatorsPath, "err", err)
+		}
+		e, err := poa.New(id, signers, filepath.Join(path, "poa"), s)
+		if err != nil {
+			logging.Fatal("unable to create poa engine", "err", err)
+		}
+		// a signer far behind syncs the blocks of the others
+		for _, signer := range signers {
+			if key, ok := trusted[signer.Name]; ok && !key.Equal(signer.PublicKey) {
+				logging.Fatal("trusted key differs from the signer key", "signer", signer.Name)
+			}
+			trusted[signer.Name] = signer.PublicKey
+		}
+		s.HandleFunc("/poa", poa.Handler(e))
+		s.SetEngine(e)
+		s.SetSealers(e)
+	default:
+		logging.Fatal("unknown consensus engine", "engine", engine)
+	}
+	s.SetTrustedKeys(trusted)
+	if err := s.ListenAndServe(join); err != nil {
+		logging.Fatal("server stopped", "err", err)
+	}
+}
+
+// Loads the node key from -identity, creating it on first start. Its public
+// key seals the blocks of the node and goes into the validator or signer
+// set of the other nodes.
+func loadIdentity(s *raftc.Server) *identity.Identity {
+	if identityPath != "" {
+		id, err := identity.LoadOrCreate(identityPath, s.Name())
+		if err != nil {
+			logging.Fatal("unable to load identity", "path", identityPath, "err", err)
+		}
+		s.SetIdentity(id)
+	}
+	id := s.Identity()
+	logging.Info("node identity", "name", id.Name, "public_key", base64.StdEncoding.EncodeToString(id.PublicKey))
+	return id
+}
 
-	log.SetFlags(log.LstdFlags)
-	s := raftc.New(path, host, port, interval)
-	log.Fatal(s.ListenAndServe(join))
+// Opens the storage backend chosen by -store. Backends other than file
+// take the global parameter from the config file on first start, if there
+// is one. Joining nodes may start without it.
+func OpenStore() (store.Store, error) {
+	var st store.Store
+	var err error
+	switch storeType {
+	case "file":
+		return store.NewFileStore(configPath, txPoolPath, blockPath)
+	case "bolt":
+		st, err = store.NewBoltStore(dbPath)
+	case "mem":
+		st = store.NewMemStore()
+	default:
+		return nil, errors.New("unknown storage backend: " + storeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = st.Parameter(); err == store.ErrNotFound {
+		var para *data.GolbalParameter
+		para, err = store.LoadParameter(configPath)
+		if err == nil {
+			// a fresh store starts from the genesis block
+			para.CurHeight = 0
+			err = st.PutParameter(para)
+		} else if err == store.ErrNotFound && join != "" {
+			// bootstrapped from the leader
+			err = nil
+		}
+	}
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	return st, nil
 }
 
 func PathExists(path string) bool {
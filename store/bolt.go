@@ -0,0 +1,281 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	blockBucket = []byte("blocks")
+	poolBucket  = []byte("pool")
+	metaBucket  = []byte("meta")
+	indexBucket = []byte("indexes")
+
+	heightKey    = []byte("height")
+	parameterKey = []byte("parameter")
+)
+
+// BoltStore keeps the whole chain in one bbolt file.
+// Blocks are keyed by big endian height, so they stay ordered on disk,
+// every index is a nested bucket of the "indexes" bucket.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{blockBucket, poolBucket, metaBucket, indexBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func heightBytes(height int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(height))
+	return b
+}
+
+func (s *BoltStore) get(bucket, key []byte, v interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucket).Get(key)
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, v)
+	})
+}
+
+func (s *BoltStore) put(bucket, key []byte, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, raw)
+	})
+}
+
+func (s *BoltStore) GetBlock(height int) (*data.BasicBlock, error) {
+	block := &data.BasicBlock{}
+	if err := s.get(blockBucket, heightBytes(height), block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (s *BoltStore) PutBlock(block *data.BasicBlock) error {
+	return s.put(blockBucket, heightBytes(block.HeadB.Height), block)
+}
+
+func (s *BoltStore) Height() (int, error) {
+	var height int
+	err := s.get(metaBucket, heightKey, &height)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	return height, err
+}
+
+func (s *BoltStore) SetHeight(height int) error {
+	return s.put(metaBucket, heightKey, height)
+}
+
+// One bolt transaction covers block, height and pool.
+func (s *BoltStore) CommitBlock(block *data.BasicBlock) error {
+	raw, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	height, err := json.Marshal(block.HeadB.Height)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(blockBucket).Put(heightBytes(block.HeadB.Height), raw); err != nil {
+			return err
+		}
+		if err := tx.Bucket(metaBucket).Put(heightKey, height); err != nil {
+			return err
+		}
+		pool := tx.Bucket(poolBucket)
+		for i := 0; i < block.HeadB.TxCount; i++ {
+			if err := pool.Delete(block.TransactionsB[i].HashVal()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) GetPoolTx(hash []byte) (*data.BasicTx, error) {
+	t := &data.BasicTx{}
+	if err := s.get(poolBucket, hash, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *BoltStore) PutPoolTx(t *data.BasicTx) error {
+	return s.put(poolBucket, t.HashVal(), t)
+}
+
+func (s *BoltStore) DeletePoolTx(hash []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(poolBucket).Delete(hash)
+	})
+}
+
+func (s *BoltStore) HasPoolTx(hash []byte) (bool, error) {
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(poolBucket).Get(hash) != nil
+		return nil
+	})
+	return found, err
+}
+
+func (s *BoltStore) PoolTxs() ([]*data.BasicTx, error) {
+	var txs []*data.BasicTx
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(poolBucket).ForEach(func(k, v []byte) error {
+			t := &data.BasicTx{}
+			if err := json.Unmarshal(v, t); err != nil {
+				logging.Warn("skip unreadable pool transaction", "hash", fmt.Sprintf("%x", k), "err", err)
+				return nil
+			}
+			txs = append(txs, t)
+			return nil
+		})
+	})
+	return txs, err
+}
+
+func (s *BoltStore) Parameter() (*data.GolbalParameter, error) {
+	para := &data.GolbalParameter{}
+	if err := s.get(metaBucket, parameterKey, para); err != nil {
+		return nil, err
+	}
+	height, err := s.Height()
+	if err != nil {
+		return nil, err
+	}
+	para.CurHeight = height
+	return para, nil
+}
+
+func (s *BoltStore) PutParameter(para *data.GolbalParameter) error {
+	if err := s.put(metaBucket, parameterKey, para); err != nil {
+		return err
+	}
+	return s.SetHeight(para.CurHeight)
+}
+
+func (s *BoltStore) GetMeta(key string, v interface{}) error {
+	return s.get(metaBucket, []byte("user/"+key), v)
+}
+
+func (s *BoltStore) PutMeta(key string, v interface{}) error {
+	return s.put(metaBucket, []byte("user/"+key), v)
+}
+
+func (s *BoltStore) IndexGet(index, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(indexBucket).Bucket([]byte(index))
+		if b == nil {
+			return ErrNotFound
+		}
+		raw := b.Get([]byte(key))
+		if raw == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), raw...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *BoltStore) IndexPut(index, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(indexBucket).CreateBucketIfNotExists([]byte(index))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) IndexDelete(index, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(indexBucket).Bucket([]byte(index))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) IndexScan(index, prefix, after string, limit int) ([]Entry, error) {
+	var entries []Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(indexBucket).Bucket([]byte(index))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		start := []byte(prefix)
+		if after >= prefix {
+			start = []byte(after)
+		}
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			if string(k) <= after {
+				continue
+			}
+			entries = append(entries, Entry{Key: string(k), Value: append([]byte(nil), v...)})
+			if limit > 0 && len(entries) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (s *BoltStore) DropIndex(index string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(indexBucket).DeleteBucket([]byte(index))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// Bolt reuses the pages of deleted keys but cannot rewrite a live
+// database, the file only shrinks with an offline bolt compact.
+func (s *BoltStore) CompactIndex(index string) error {
+	return nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
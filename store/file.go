@@ -0,0 +1,366 @@
+package store
+
+import (
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileStore is the original layout: the config file holds the parameter
+// and current height, every block and every pool tx is one JSON file.
+// Metadata and indexes live in "meta" and "index" dirs beside the config,
+// each index being an append-only log.
+// Every file is replaced atomically, and the multi file update of
+// CommitBlock is written ahead to a journal which is replayed on open.
+type FileStore struct {
+	configPath  string
+	poolDir     string
+	blockDir    string
+	metaDir     string
+	indexDir    string
+	journalPath string
+
+	mutex   sync.Mutex
+	indexes map[string]*indexLog
+}
+
+func NewFileStore(configPath, poolDir, blockDir string) (*FileStore, error) {
+	root := filepath.Dir(configPath)
+	s := &FileStore{
+		configPath:  configPath,
+		poolDir:     poolDir,
+		blockDir:    blockDir,
+		metaDir:     filepath.Join(root, "meta"),
+		indexDir:    filepath.Join(root, "index"),
+		journalPath: filepath.Join(root, "journal"),
+		indexes:     make(map[string]*indexLog),
+	}
+	for _, dir := range []string{root, s.poolDir, s.blockDir, s.metaDir, s.indexDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		if err := removeTempFiles(dir); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.replayJournal(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Leftovers of writes interrupted before their rename.
+func removeTempFiles(dir string) error {
+	tmps, err := filepath.Glob(filepath.Join(dir, ".*.tmp*"))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range tmps {
+		if err := os.Remove(tmp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write-ahead record of a CommitBlock.
+type journalRecord struct {
+	Block *data.BasicBlock `json:"block"`
+}
+
+// Every step of CommitBlock is idempotent, so an unfinished record is
+// simply applied again.
+func (s *FileStore) replayJournal() error {
+	record := &journalRecord{}
+	err := data.Load(record, s.journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logging.Warn("replaying unfinished block commit", "height", record.Block.HeadB.Height)
+	return s.applyJournal(record)
+}
+
+func (s *FileStore) applyJournal(record *journalRecord) error {
+	block := record.Block
+	if err := s.PutBlock(block); err != nil {
+		return err
+	}
+	if err := s.SetHeight(block.HeadB.Height); err != nil {
+		return err
+	}
+	for i := 0; i < block.HeadB.TxCount; i++ {
+		err := os.Remove(s.poolTxPath(block.TransactionsB[i].HashVal()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := data.SyncDir(s.poolDir); err != nil {
+		return err
+	}
+	if err := os.Remove(s.journalPath); err != nil {
+		return err
+	}
+	return data.SyncDir(filepath.Dir(s.journalPath))
+}
+
+// Reads a config file without opening a whole store.
+func LoadParameter(configPath string) (*data.GolbalParameter, error) {
+	para := &data.GolbalParameter{}
+	err := data.Load(para, configPath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return para, nil
+}
+
+func (s *FileStore) blockPath(height int) string {
+	return filepath.Join(s.blockDir, strconv.Itoa(height))
+}
+
+func (s *FileStore) poolTxPath(hash []byte) string {
+	return filepath.Join(s.poolDir, fmt.Sprintf("%x", hash))
+}
+
+func (s *FileStore) load(t interface{}, path string) error {
+	err := data.Load(t, path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *FileStore) GetBlock(height int) (*data.BasicBlock, error) {
+	block := &data.BasicBlock{}
+	if err := s.load(block, s.blockPath(height)); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (s *FileStore) PutBlock(block *data.BasicBlock) error {
+	return data.Write(block, s.blockPath(block.HeadB.Height))
+}
+
+func (s *FileStore) Height() (int, error) {
+	para, err := s.Parameter()
+	if err != nil {
+		return 0, err
+	}
+	return para.CurHeight, nil
+}
+
+func (s *FileStore) SetHeight(height int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	para := &data.GolbalParameter{}
+	if err := s.load(para, s.configPath); err != nil {
+		return err
+	}
+	para.CurHeight = height
+	return data.Write(para, s.configPath)
+}
+
+func (s *FileStore) CommitBlock(block *data.BasicBlock) error {
+	record := &journalRecord{Block: block}
+	if err := data.Write(record, s.journalPath); err != nil {
+		return err
+	}
+	return s.applyJournal(record)
+}
+
+func (s *FileStore) GetPoolTx(hash []byte) (*data.BasicTx, error) {
+	tx := &data.BasicTx{}
+	if err := s.load(tx, s.poolTxPath(hash)); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *FileStore) PutPoolTx(tx *data.BasicTx) error {
+	return data.Write(tx, s.poolTxPath(tx.HashVal()))
+}
+
+func (s *FileStore) DeletePoolTx(hash []byte) error {
+	err := os.Remove(s.poolTxPath(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return data.SyncDir(s.poolDir)
+}
+
+func (s *FileStore) HasPoolTx(hash []byte) (bool, error) {
+	_, err := os.Stat(s.poolTxPath(hash))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *FileStore) PoolTxs() ([]*data.BasicTx, error) {
+	infos, err := ioutil.ReadDir(s.poolDir)
+	if err != nil {
+		return nil, err
+	}
+	var txs []*data.BasicTx
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		tx := &data.BasicTx{}
+		if err := data.Load(tx, filepath.Join(s.poolDir, info.Name())); err != nil {
+			logging.Warn("skip unreadable pool transaction", "file", info.Name(), "err", err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func (s *FileStore) Parameter() (*data.GolbalParameter, error) {
+	return LoadParameter(s.configPath)
+}
+
+func (s *FileStore) PutParameter(para *data.GolbalParameter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return data.Write(para, s.configPath)
+}
+
+func (s *FileStore) GetMeta(key string, v interface{}) error {
+	return s.load(v, filepath.Join(s.metaDir, key))
+}
+
+func (s *FileStore) PutMeta(key string, v interface{}) error {
+	return data.Write(v, filepath.Join(s.metaDir, key))
+}
+
+// Each index is opened on first access and its entries kept in memory.
+func (s *FileStore) index(name string) (*indexLog, error) {
+	if idx, ok := s.indexes[name]; ok {
+		return idx, nil
+	}
+	idx, err := openIndexLog(s.indexDir, name)
+	if err != nil {
+		return nil, err
+	}
+	s.indexes[name] = idx
+	return idx, nil
+}
+
+func (s *FileStore) IndexGet(index, key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx, err := s.index(index)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := idx.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *FileStore) IndexPut(index, key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx, err := s.index(index)
+	if err != nil {
+		return err
+	}
+	return idx.put(key, value)
+}
+
+func (s *FileStore) IndexDelete(index, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx, err := s.index(index)
+	if err != nil {
+		return err
+	}
+	return idx.delete(key)
+}
+
+func (s *FileStore) IndexScan(index, prefix, after string, limit int) ([]Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx, err := s.index(index)
+	if err != nil {
+		return nil, err
+	}
+	return scanMap(idx.entries, prefix, after, limit), nil
+}
+
+func (s *FileStore) DropIndex(index string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if idx, ok := s.indexes[index]; ok {
+		idx.close()
+		delete(s.indexes, index)
+	}
+	return removeIndexLog(s.indexDir, index)
+}
+
+func (s *FileStore) CompactIndex(index string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx, err := s.index(index)
+	if err != nil {
+		return err
+	}
+	if idx.records == len(idx.entries) {
+		return nil
+	}
+	return idx.compact()
+}
+
+func (s *FileStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var err error
+	for name, idx := range s.indexes {
+		if cerr := idx.close(); err == nil {
+			err = cerr
+		}
+		delete(s.indexes, name)
+	}
+	return err
+}
+
+// Shared by the map backed indexes of FileStore and MemStore.
+func scanMap(idx map[string][]byte, prefix, after string, limit int) []Entry {
+	var keys []string
+	for k := range idx {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	entries := make([]Entry, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, Entry{Key: k, Value: idx[k]})
+	}
+	return entries
+}
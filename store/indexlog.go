@@ -0,0 +1,205 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// A log is compacted once it holds this many records more than twice its
+// live keys, which keeps every put and delete O(1) amortized.
+const compactSlack = 1024
+
+// One line of an index log. Later lines override earlier ones.
+type indexRecord struct {
+	Key     string `json:"k"`
+	Value   []byte `json:"v"`
+	Deleted bool   `json:"d,omitempty"`
+}
+
+// indexLog is an append-only file of indexRecords with the live entries
+// cached in memory. Every put or delete appends and fsyncs one line.
+type indexLog struct {
+	path    string
+	file    *os.File
+	entries map[string][]byte
+	records int
+}
+
+// Opens the log of an index in dir. An index in the old single JSON file
+// layout is converted on first access.
+func openIndexLog(dir, name string) (*indexLog, error) {
+	l := &indexLog{
+		path:    filepath.Join(dir, name+".log"),
+		entries: make(map[string][]byte),
+	}
+	legacy := filepath.Join(dir, name)
+	err := data.Load(&l.entries, legacy)
+	if err == nil {
+		if err := l.compact(); err != nil {
+			return nil, err
+		}
+		if err := os.Remove(legacy); err != nil {
+			return nil, err
+		}
+		return l, data.SyncDir(dir)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := l.replay(); err != nil {
+		return nil, err
+	}
+	l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reads the log back. A torn last line, left by a crash in the middle of
+// an append, is cut off.
+func (l *indexLog) replay() error {
+	fr, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+	reader := bufio.NewReader(fr)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		record := indexRecord{}
+		if err == io.EOF || json.Unmarshal(line, &record) != nil {
+			logging.Warn("truncate torn index log", "file", l.path, "offset", offset)
+			return os.Truncate(l.path, offset)
+		}
+		offset += int64(len(line))
+		l.apply(record)
+	}
+}
+
+func (l *indexLog) apply(record indexRecord) {
+	if record.Deleted {
+		delete(l.entries, record.Key)
+	} else {
+		l.entries[record.Key] = record.Value
+	}
+	l.records++
+}
+
+func (l *indexLog) append(record indexRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.apply(record)
+	if l.records > 2*len(l.entries)+compactSlack {
+		return l.compact()
+	}
+	return nil
+}
+
+func (l *indexLog) put(key string, value []byte) error {
+	return l.append(indexRecord{Key: key, Value: value})
+}
+
+func (l *indexLog) delete(key string) error {
+	if _, ok := l.entries[key]; !ok {
+		return nil
+	}
+	return l.append(indexRecord{Key: key, Deleted: true})
+}
+
+// Rewrites the log with one record per live key, atomically like
+// data.Write.
+func (l *indexLog) compact() error {
+	dir, name := filepath.Split(l.path)
+	fw, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := fw.Name()
+	defer os.Remove(tmp)
+
+	keys := make([]string, 0, len(l.entries))
+	for k := range l.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writer := bufio.NewWriter(fw)
+	encoder := json.NewEncoder(writer)
+	for _, k := range keys {
+		if err = encoder.Encode(indexRecord{Key: k, Value: l.entries[k]}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = fw.Chmod(0644)
+	}
+	if err == nil {
+		err = fw.Sync()
+	}
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	if err := data.SyncDir(dir); err != nil {
+		return err
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.records = len(l.entries)
+	return nil
+}
+
+func (l *indexLog) close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Removes the log of an index and any leftover of the old layout.
+func removeIndexLog(dir, name string) error {
+	for _, path := range []string{filepath.Join(dir, name+".log"), filepath.Join(dir, name)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return data.SyncDir(dir)
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"sort"
+	"sync"
+)
+
+// MemStore keeps everything in memory, for tests and throwaway nodes.
+// Values are stored JSON encoded so callers never share state with it.
+type MemStore struct {
+	mutex     sync.RWMutex
+	height    int
+	parameter []byte
+	blocks    map[int][]byte
+	pool      map[string][]byte
+	meta      map[string][]byte
+	indexes   map[string]map[string][]byte
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		blocks:  make(map[int][]byte),
+		pool:    make(map[string][]byte),
+		meta:    make(map[string][]byte),
+		indexes: make(map[string]map[string][]byte),
+	}
+}
+
+func (s *MemStore) GetBlock(height int) (*data.BasicBlock, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	raw, ok := s.blocks[height]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	block := &data.BasicBlock{}
+	if err := json.Unmarshal(raw, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (s *MemStore) PutBlock(block *data.BasicBlock) error {
+	raw, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blocks[block.HeadB.Height] = raw
+	return nil
+}
+
+func (s *MemStore) Height() (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.height, nil
+}
+
+func (s *MemStore) SetHeight(height int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.height = height
+	return nil
+}
+
+func (s *MemStore) CommitBlock(block *data.BasicBlock) error {
+	raw, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blocks[block.HeadB.Height] = raw
+	s.height = block.HeadB.Height
+	for i := 0; i < block.HeadB.TxCount; i++ {
+		delete(s.pool, fmt.Sprintf("%x", block.TransactionsB[i].HashVal()))
+	}
+	return nil
+}
+
+func (s *MemStore) GetPoolTx(hash []byte) (*data.BasicTx, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	raw, ok := s.pool[fmt.Sprintf("%x", hash)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	tx := &data.BasicTx{}
+	if err := json.Unmarshal(raw, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *MemStore) PutPoolTx(tx *data.BasicTx) error {
+	raw, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pool[fmt.Sprintf("%x", tx.HashVal())] = raw
+	return nil
+}
+
+func (s *MemStore) DeletePoolTx(hash []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pool, fmt.Sprintf("%x", hash))
+	return nil
+}
+
+func (s *MemStore) HasPoolTx(hash []byte) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.pool[fmt.Sprintf("%x", hash)]
+	return ok, nil
+}
+
+func (s *MemStore) PoolTxs() ([]*data.BasicTx, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var keys []string
+	for k := range s.pool {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var txs []*data.BasicTx
+	for _, k := range keys {
+		tx := &data.BasicTx{}
+		if err := json.Unmarshal(s.pool[k], tx); err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func (s *MemStore) Parameter() (*data.GolbalParameter, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.parameter == nil {
+		return nil, ErrNotFound
+	}
+	para := &data.GolbalParameter{}
+	if err := json.Unmarshal(s.parameter, para); err != nil {
+		return nil, err
+	}
+	para.CurHeight = s.height
+	return para, nil
+}
+
+func (s *MemStore) PutParameter(para *data.GolbalParameter) error {
+	raw, err := json.Marshal(para)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.parameter = raw
+	s.height = para.CurHeight
+	return nil
+}
+
+func (s *MemStore) GetMeta(key string, v interface{}) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	raw, ok := s.meta[key]
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (s *MemStore) PutMeta(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.meta[key] = raw
+	return nil
+}
+
+func (s *MemStore) IndexGet(index, key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.indexes[index][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *MemStore) IndexPut(index, key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	idx, ok := s.indexes[index]
+	if !ok {
+		idx = make(map[string][]byte)
+		s.indexes[index] = idx
+	}
+	idx[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *MemStore) IndexDelete(index, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.indexes[index], key)
+	return nil
+}
+
+func (s *MemStore) IndexScan(index, prefix, after string, limit int) ([]Entry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return scanMap(s.indexes[index], prefix, after, limit), nil
+}
+
+func (s *MemStore) DropIndex(index string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.indexes, index)
+	return nil
+}
+
+func (s *MemStore) CompactIndex(index string) error {
+	return nil
+}
+
+func (s *MemStore) Close() error {
+	return nil
+}
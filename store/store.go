@@ -0,0 +1,151 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	"github.com/RedactableBlockChain/logging"
+)
+
+var ErrNotFound = errors.New("store: not found")
+
+// Entry is one key/value pair of an index.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// Store keeps everything a node persists: blocks, the tx pool,
+// chain metadata and named indexes.
+type Store interface {
+	// Blocks are addressed by height, Height is the current top.
+	GetBlock(height int) (*data.BasicBlock, error)
+	PutBlock(block *data.BasicBlock) error
+	Height() (int, error)
+	SetHeight(height int) error
+	// CommitBlock stores a new top block, moves the height to it and drops
+	// its txs from the pool as one crash safe update.
+	CommitBlock(block *data.BasicBlock) error
+
+	// Pool holds txs waiting for packing, addressed by hash value.
+	GetPoolTx(hash []byte) (*data.BasicTx, error)
+	PutPoolTx(tx *data.BasicTx) error
+	DeletePoolTx(hash []byte) error
+	HasPoolTx(hash []byte) (bool, error)
+	// PoolTxs lists the whole pool ordered by hash value.
+	PoolTxs() ([]*data.BasicTx, error)
+
+	// Metadata: the global chameleon parameter plus free form JSON values.
+	Parameter() (*data.GolbalParameter, error)
+	PutParameter(para *data.GolbalParameter) error
+	GetMeta(key string, v interface{}) error
+	PutMeta(key string, v interface{}) error
+
+	// Indexes are ordered string keyed namespaces.
+	IndexGet(index, key string) ([]byte, error)
+	IndexPut(index, key string, value []byte) error
+	IndexDelete(index, key string) error
+	// IndexScan returns up to limit entries whose key has the prefix and is
+	// strictly greater than after, in key order. limit <= 0 means no limit.
+	IndexScan(index, prefix, after string, limit int) ([]Entry, error)
+	DropIndex(index string) error
+	// CompactIndex rewrites an index without the records of its deleted
+	// keys, so that they do not linger on disk.
+	CompactIndex(index string) error
+
+	Close() error
+}
+
+// Returns [p,q,g], hk and tk of the global parameter.
+func ChameleonParameter(s Store) ([][]byte, []byte, []byte, error) {
+	para, err := s.Parameter()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return [][]byte{para.P, para.Q, para.G}, para.Hk, para.Tk, nil
+}
+
+// Checks [p,q,g] against the parameter in store.
+func CompareChameleonParameter(s Store, para [][]byte) (bool, error) {
+	local, err := s.Parameter()
+	if err != nil {
+		return false, err
+	}
+	if len(para) != 3 {
+		return false, nil
+	}
+	return bytes.Equal(local.P, para[0]) && bytes.Equal(local.Q, para[1]) && bytes.Equal(local.G, para[2]), nil
+}
+
+// Returns the block on top of the chain.
+func TopBlock(s Store) (*data.BasicBlock, error) {
+	top, err := s.Height()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBlock(top)
+}
+
+// Reconcile repairs what a crash of a node without the commit journal can
+// leave behind: a height pointing at a missing block, valid blocks above the
+// height, and pool txs that were already packed into the top block.
+func Reconcile(s Store) error {
+	height, err := s.Height()
+	if err != nil {
+		return err
+	}
+	top := height
+	for top > 0 {
+		_, err := s.GetBlock(top)
+		if err == nil {
+			break
+		}
+		if err != ErrNotFound {
+			return err
+		}
+		top--
+	}
+	for {
+		cur, err := s.GetBlock(top)
+		if err != nil {
+			return err
+		}
+		next, err := s.GetBlock(top + 1)
+		if err == ErrNotFound {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(next.HeadB.PreviousRoot, cur.HeadB.HashRoot) || !next.Verify() {
+			break
+		}
+		top++
+	}
+	if top != height {
+		logging.Warn("chain height repaired", "from", height, "to", top)
+		if err = s.SetHeight(top); err != nil {
+			return err
+		}
+	}
+
+	block, err := s.GetBlock(top)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < block.HeadB.TxCount; i++ {
+		hash := block.TransactionsB[i].HashVal()
+		inPool, err := s.HasPoolTx(hash)
+		if err != nil {
+			return err
+		}
+		if inPool {
+			logging.Warn("packed transaction removed from pool", "hash", fmt.Sprintf("%x", hash))
+			if err = s.DeletePoolTx(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/RedactableBlockChain/data"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newFile(t *testing.T, root string) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(filepath.Join(root, "config"), filepath.Join(root, "pool"), filepath.Join(root, "block"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newBolt(t *testing.T, path string) *BoltStore {
+	t.Helper()
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Runs f against a fresh store of every backend.
+func eachBackend(t *testing.T, f func(t *testing.T, s Store)) {
+	backends := map[string]func(t *testing.T) Store{
+		"mem":  func(t *testing.T) Store { return NewMemStore() },
+		"file": func(t *testing.T) Store { return newFile(t, t.TempDir()) },
+		"bolt": func(t *testing.T) Store { return newBolt(t, filepath.Join(t.TempDir(), "db")) },
+	}
+	for _, name := range []string{"mem", "file", "bolt"} {
+		open := backends[name]
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			if err := s.PutParameter(&data.GolbalParameter{Bits: 128}); err != nil {
+				t.Fatal(err)
+			}
+			f(t, s)
+		})
+	}
+}
+
+func testTx(payload string) *data.BasicTx {
+	return &data.BasicTx{PayloadB: []byte(payload), HashValB: []byte("hash-" + payload)}
+}
+
+func testBlock(height int, txs ...*data.BasicTx) *data.BasicBlock {
+	block := &data.BasicBlock{}
+	block.HeadB.Height = height
+	for _, tx := range txs {
+		block.TransactionsB = append(block.TransactionsB, *tx)
+	}
+	block.HeadB.TxCount = len(txs)
+	return block
+}
+
+func TestCommitBlock(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		packed, waiting := testTx("a"), testTx("b")
+		for _, tx := range []*data.BasicTx{packed, waiting} {
+			if err := s.PutPoolTx(tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.CommitBlock(testBlock(1, packed)); err != nil {
+			t.Fatal(err)
+		}
+		if height, err := s.Height(); err != nil || height != 1 {
+			t.Fatalf("height %d, %v", height, err)
+		}
+		block, err := s.GetBlock(1)
+		if err != nil || block.HeadB.TxCount != 1 {
+			t.Fatalf("block %+v, %v", block, err)
+		}
+		if in, _ := s.HasPoolTx(packed.HashVal()); in {
+			t.Fatal("packed tx still in pool")
+		}
+		txs, err := s.PoolTxs()
+		if err != nil || len(txs) != 1 || !bytes.Equal(txs[0].PayloadB, waiting.PayloadB) {
+			t.Fatalf("pool %v, %v", txs, err)
+		}
+		if _, err := s.GetBlock(2); err != ErrNotFound {
+			t.Fatalf("missing block: %v", err)
+		}
+		para, err := s.Parameter()
+		if err != nil || para.Bits != 128 || para.CurHeight != 1 {
+			t.Fatalf("parameter %+v, %v", para, err)
+		}
+	})
+}
+
+func TestMeta(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		var got map[string]int
+		if err := s.GetMeta("k", &got); err != ErrNotFound {
+			t.Fatalf("missing meta: %v", err)
+		}
+		if err := s.PutMeta("k", map[string]int{"x": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.GetMeta("k", &got); err != nil || got["x"] != 1 {
+			t.Fatalf("meta %v, %v", got, err)
+		}
+	})
+}
+
+func TestIndex(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		for i := 0; i < 10; i++ {
+			if err := s.IndexPut("idx", fmt.Sprintf("a/%02d", i), []byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.IndexPut("idx", "b/00", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.IndexDelete("idx", "a/03"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.IndexDelete("idx", "a/missing"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.IndexGet("idx", "a/03"); err != ErrNotFound {
+			t.Fatalf("deleted key: %v", err)
+		}
+		if v, err := s.IndexGet("idx", "a/05"); err != nil || !bytes.Equal(v, []byte{5}) {
+			t.Fatalf("get %v, %v", v, err)
+		}
+		entries, err := s.IndexScan("idx", "a/", "a/01", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+		}
+		if fmt.Sprint(keys) != "[a/02 a/04 a/05]" {
+			t.Fatalf("scan %v", keys)
+		}
+		if all, _ := s.IndexScan("idx", "", "", 0); len(all) != 10 {
+			t.Fatalf("scan all: %d entries", len(all))
+		}
+		if err := s.CompactIndex("idx"); err != nil {
+			t.Fatal(err)
+		}
+		if all, _ := s.IndexScan("idx", "", "", 0); len(all) != 10 {
+			t.Fatalf("scan after compaction: %d entries", len(all))
+		}
+		if err := s.DropIndex("idx"); err != nil {
+			t.Fatal(err)
+		}
+		if all, _ := s.IndexScan("idx", "", "", 0); len(all) != 0 {
+			t.Fatalf("dropped index has %d entries", len(all))
+		}
+	})
+}
+
+func TestFileIndexReopen(t *testing.T) {
+	root := t.TempDir()
+	s := newFile(t, root)
+	for i := 0; i < 3*compactSlack; i++ {
+		if err := s.IndexPut("idx", "key", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.IndexPut("idx", "other", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.IndexDelete("idx", "other"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	log := filepath.Join(root, "index", "idx.log")
+	info, err := os.Stat(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 100*compactSlack {
+		t.Fatalf("log not compacted: %d bytes", info.Size())
+	}
+
+	// a crash in the middle of an append leaves a torn line
+	f, err := os.OpenFile(log, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"k":"torn","v":`)
+	f.Close()
+
+	s = newFile(t, root)
+	defer s.Close()
+	if v, err := s.IndexGet("idx", "key"); err != nil || string(v) != fmt.Sprint(3*compactSlack-1) {
+		t.Fatalf("reopened %q, %v", v, err)
+	}
+	if _, err := s.IndexGet("idx", "other"); err != ErrNotFound {
+		t.Fatalf("deleted key after reopen: %v", err)
+	}
+	if err := s.IndexPut("idx", "after", []byte("y")); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := s.IndexScan("idx", "", "", 0); len(all) != 2 {
+		t.Fatalf("%d entries after torn line", len(all))
+	}
+}
+
+func TestFileIndexLegacy(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "index")
+	os.MkdirAll(dir, os.ModePerm)
+	if err := data.Write(map[string][]byte{"k": []byte("v")}, filepath.Join(dir, "idx")); err != nil {
+		t.Fatal(err)
+	}
+	s := newFile(t, root)
+	defer s.Close()
+	if v, err := s.IndexGet("idx", "k"); err != nil || string(v) != "v" {
+		t.Fatalf("legacy %q, %v", v, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "idx")); !os.IsNotExist(err) {
+		t.Fatalf("legacy file kept: %v", err)
+	}
+}
+
+// Deleted keys are gone from the file once the index is compacted, not
+// only shadowed by a later record.
+func TestFileIndexCompact(t *testing.T) {
+	root := t.TempDir()
+	s := newFile(t, root)
+	defer s.Close()
+	for _, key := range []string{"kept", "removed"} {
+		if err := s.IndexPut("idx", key, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.IndexDelete("idx", "removed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompactIndex("idx"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(root, "index", "idx.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("removed")) || !bytes.Contains(raw, []byte("kept")) {
+		t.Fatalf("compacted log %s", raw)
+	}
+	if err := s.IndexPut("idx", "after", nil); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := s.IndexScan("idx", "", "", 0); len(all) != 2 {
+		t.Fatalf("%d entries after compaction", len(all))
+	}
+}
+
+// A corrupt pool record is skipped by every backend that can hold one.
+func TestPoolTxsSkipsBadRecord(t *testing.T) {
+	root := t.TempDir()
+	fs := newFile(t, root)
+	fs.PutPoolTx(testTx("a"))
+	if err := ioutil.WriteFile(filepath.Join(root, "pool", "bad"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if txs, err := fs.PoolTxs(); err != nil || len(txs) != 1 {
+		t.Fatalf("file pool %v, %v", txs, err)
+	}
+
+	bs := newBolt(t, filepath.Join(root, "db"))
+	defer bs.Close()
+	bs.PutPoolTx(testTx("a"))
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(poolBucket).Put([]byte("bad"), []byte("{"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txs, err := bs.PoolTxs(); err != nil || len(txs) != 1 {
+		t.Fatalf("bolt pool %v, %v", txs, err)
+	}
+}
@@ -1,13 +1,12 @@
 package main
 
 import (
-	"github.com/RedactableBlockChain/path"
+	"github.com/RedactableBlockChain/store"
 	"log"
 
 	//"encoding/json"
 	"flag"
 	"fmt"
-	"github.com/RedactableBlockChain/data"
 	//raftc "github.com/RedactableBlockChain/raft"
 )
 
@@ -16,11 +15,15 @@ func init() {
 }
 
 func main() {
-	para, _, _, _ := data.GetGolbalChameleonParameter()
+	st, err := store.NewFileStore("./storage/config", "./storage/pool/", "./storage/block/")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	para, _, _, _ := store.ChameleonParameter(st)
 	height, txId := 2, 0
 
-	block := &data.BasicBlock{}
-	err := data.Load(block, path.GetBlockPath(height))
+	block, err := st.GetBlock(height)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -44,7 +47,7 @@ func main() {
 		return
 	}
 
-	err = data.Write(block, path.GetBlockPath(height))
+	err = st.PutBlock(block)
 	if err != nil {
 		fmt.Println(err)
 		return